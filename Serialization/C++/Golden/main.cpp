@@ -0,0 +1,63 @@
+// Generates the C++ golden files checked in under Tests/Go/<package>/testdata/cpp.
+// The Go tests read them and compare their own C++-format output against them.
+//
+// Build and run from this directory:
+//   g++ -std=c++17 -o golden main.cpp ../Array/Array.cpp ../DoubleList/DoubleList.cpp \
+//       ../ForwardList/ForwardList.cpp ../Queue/Queue.cpp ../Stack/Stack.cpp \
+//       ../ChainmapBucket/ChainMap.cpp ../BlackRedTree/BlackRedTree.cpp
+//   ./golden ../../../Tests/Go
+
+#include "../Array/Array.h"
+#include "../DoubleList/DoubleList.h"
+#include "../ForwardList/ForwardList.h"
+#include "../Queue/Queue.h"
+#include "../Stack/Stack.h"
+#include "../ChainmapBucket/ChainMap.h"
+#include "../BlackRedTree/BlackRedTree.h"
+
+template <typename T>
+void writeBoth(T& container, const string& dir, const string& name) {
+    container.writeBinary(dir + "/testdata/cpp/" + name + ".bin");
+    container.writeText(dir + "/testdata/cpp/" + name + ".txt");
+}
+
+int main(int argc, char* argv[]) {
+    if (argc != 2) {
+        cerr << "usage: golden <path to Tests/Go>" << endl;
+        return 1;
+    }
+    string root = argv[1];
+
+    Array array = {"alpha", "b c", "", "юникод"};
+    writeBoth(array, root + "/array", "array");
+
+    DoubleList doubleList = {"alpha", "b c", "юникод"};
+    writeBoth(doubleList, root + "/doublelist", "doublelist");
+
+    ForwardList forwardList = {"alpha", "b c", "юникод"};
+    writeBoth(forwardList, root + "/forwardlist", "forwardlist");
+
+    Queue queue = {"alpha", "b c", "", "юникод"};
+    writeBoth(queue, root + "/queue", "queue");
+
+    Stack stack = {"bottom", "b c", "top"};
+    writeBoth(stack, root + "/stack", "stack");
+
+    ChainMap chainMap(4);
+    chainMap.add("alpha", 1);
+    chainMap.add("b c", -2);
+    chainMap.add("юникод", 2147483647);
+    writeBoth(chainMap, root + "/hashmap", "chainmap");
+
+    ChainMap single(4);
+    single.add("key with spaces", -7);
+    writeBoth(single, root + "/hashmap", "chainmap_single");
+
+    RBTree tree;
+    for (int key : {50, 20, 80, 10, 30, 70, 90, 25, 35, -5}) {
+        tree.insert(key);
+    }
+    writeBoth(tree, root + "/redblack", "redblack");
+
+    return 0;
+}
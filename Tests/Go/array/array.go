@@ -2,57 +2,71 @@ package array
 
 import (
 	"bufio"
-	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"iter"
 	"os"
-	"strconv"
+
+	"Go/persist"
 )
 
-type Array struct {
-	data []string 
-	len  int      
-	cap  int      
+type Array[T any] struct {
+	data       []T
+	len        int
+	cap        int
+	codec      persist.Codec[T]
+	version    int
+	encodeOpts persist.EncodeOptions
+	decodeOpts persist.DecodeOptions
 }
 
-func NewArray(size int) (*Array, error) {
+func NewArray[T any](size int) (*Array[T], error) {
 	if size < 1 {
 		return nil, errors.New("cannot create array of zero size")
 	}
-	return &Array{
-		data: make([]string, size),
-		len:  0,
-		cap:  size,
+	return &Array[T]{
+		data:  make([]T, size),
+		len:   0,
+		cap:   size,
+		codec: persist.Default[T](),
 	}, nil
 }
 
-func NewArrayFromList(items []string) (*Array, error) {
+func NewArrayFromList[T any](items []T) (*Array[T], error) {
 	if len(items) < 1 {
-		return NewArray(1)
+		return NewArray[T](1)
 	}
-	a, _ := NewArray(len(items))
+	a, _ := NewArray[T](len(items))
 	for _, item := range items {
 		a.AddElementEnd(item)
 	}
 	return a, nil
 }
 
-func (a *Array) grow() {
+// SetCodec changes how elements are encoded by the Write*/Read* methods.
+func (a *Array[T]) SetCodec(codec persist.Codec[T]) {
+	a.codec = codec
+}
+
+func (a *Array[T]) grow() {
 	newCap := a.cap * 2
-	newData := make([]string, newCap)
+	newData := make([]T, newCap)
 	copy(newData, a.data[:a.len])
 	a.data = newData
 	a.cap = newCap
 }
 
-func (a *Array) GetElement(index int) (string, error) {
+func (a *Array[T]) GetElement(index int) (T, error) {
 	if index < 0 || index >= a.len {
-		return "", errors.New("index out of bounds")
+		var zero T
+		return zero, errors.New("index out of bounds")
 	}
 	return a.data[index], nil
 }
 
-func (a *Array) SetElement(key string, index int) error {
+func (a *Array[T]) SetElement(key T, index int) error {
 	if index < 0 || index >= a.len {
 		return errors.New("index out of bounds")
 	}
@@ -60,18 +74,21 @@ func (a *Array) SetElement(key string, index int) error {
 	return nil
 }
 
-func (a *Array) DeleteElement(index int) error {
+func (a *Array[T]) DeleteElement(index int) error {
 	if index < 0 || index >= a.len {
 		return errors.New("index out of bounds")
 	}
 	for i := index; i < a.len-1; i++ {
 		a.data[i] = a.data[i+1]
 	}
+	var zero T
+	a.data[a.len-1] = zero
 	a.len--
+	a.version++
 	return nil
 }
 
-func (a *Array) AddElementAtIndex(key string, index int) error {
+func (a *Array[T]) AddElementAtIndex(key T, index int) error {
 	if index < 0 || index > a.len {
 		return errors.New("index out of bounds")
 	}
@@ -83,35 +100,72 @@ func (a *Array) AddElementAtIndex(key string, index int) error {
 	}
 	a.data[index] = key
 	a.len++
+	a.version++
 	return nil
 }
 
-func (a *Array) AddElementEnd(key string) {
+func (a *Array[T]) AddElementEnd(key T) {
 	if a.len >= a.cap {
 		a.grow()
 	}
 	a.data[a.len] = key
 	a.len++
+	a.version++
 }
 
-func (a *Array) GetLength() int {
+func (a *Array[T]) GetLength() int {
 	return a.len
 }
 
-func (a *Array) GetCapacity() int {
+func (a *Array[T]) GetCapacity() int {
 	return a.cap
 }
 
-func (a *Array) IsInArray(key string) int {
+func IsInArray[T comparable](a *Array[T], key T) int {
+	return a.IndexFunc(func(v T) bool { return v == key })
+}
+
+func (a *Array[T]) IndexFunc(match func(T) bool) int {
 	for i := 0; i < a.len; i++ {
-		if a.data[i] == key {
+		if match(a.data[i]) {
 			return i
 		}
 	}
 	return -1
 }
 
-func (a *Array) Print() {
+// All yields the elements from first to last. Adding or deleting elements
+// while iterating panics.
+func (a *Array[T]) All() iter.Seq[T] {
+	return func(yield func(T) bool) {
+		version := a.version
+		for i := 0; i < a.len; i++ {
+			if !yield(a.data[i]) {
+				return
+			}
+			if a.version != version {
+				panic("array: array modified during iteration")
+			}
+		}
+	}
+}
+
+// Backward yields the elements from last to first.
+func (a *Array[T]) Backward() iter.Seq[T] {
+	return func(yield func(T) bool) {
+		version := a.version
+		for i := a.len - 1; i >= 0; i-- {
+			if !yield(a.data[i]) {
+				return
+			}
+			if a.version != version {
+				panic("array: array modified during iteration")
+			}
+		}
+	}
+}
+
+func (a *Array[T]) Print() {
 	for i := 0; i < a.len; i++ {
 		if i > 0 {
 			fmt.Print(" ")
@@ -121,118 +175,362 @@ func (a *Array) Print() {
 	fmt.Println()
 }
 
-func (a *Array) WriteBinary(filename string) error {
-	file, err := os.Create(filename)
-	if err != nil {
-		return fmt.Errorf("failed to open file for writing: %w", err)
+// WriteTo writes the array in its binary format.
+func (a *Array[T]) WriteTo(w io.Writer) (int64, error) {
+	enc := persist.NewEncoder(w)
+	if err := enc.WriteHeader(a.header()); err != nil {
+		return enc.Len(), err
+	}
+	if err := enc.Uint32(uint32(a.len)); err != nil {
+		return enc.Len(), err
 	}
-	defer file.Close()
 
-	if err := binary.Write(file, binary.LittleEndian, uint32(a.len)); err != nil {
-		return err
+	for i := 0; i < a.len; i++ {
+		if err := a.codec.Encode(enc, a.data[i]); err != nil {
+			return enc.Len(), err
+		}
+		if err := enc.EndRecord(); err != nil {
+			return enc.Len(), err
+		}
+	}
+	err := enc.Finish()
+	return enc.Len(), err
+}
+
+// ReadFrom replaces the contents of the array with the binary data in r.
+// The array is left unchanged if the data cannot be decoded.
+func (a *Array[T]) ReadFrom(r io.Reader) (int64, error) {
+	dec := persist.NewDecoder(r, a.decodeOpts)
+	if _, err := dec.ExpectHeader(a.header()); err != nil {
+		return dec.Offset(), err
+	}
+	return a.readBinary(dec)
+}
+
+// ReadLegacyFrom is like ReadFrom but reads the headerless format written
+// before the container header was introduced.
+func (a *Array[T]) ReadLegacyFrom(r io.Reader) (int64, error) {
+	return a.readBinary(persist.NewDecoder(r, a.decodeOpts))
+}
+
+// WriteCppTo writes the array in the layout of the C++ Array::writeBinary:
+// an int32 length followed by every element, formatted with the array's
+// codec, as a size_t-prefixed string.
+func (a *Array[T]) WriteCppTo(w io.Writer) (int64, error) {
+	enc := persist.NewEncoder(w)
+	if err := enc.Uint32(uint32(a.len)); err != nil {
+		return enc.Len(), err
 	}
 
 	for i := 0; i < a.len; i++ {
-		s := a.data[i]
-		length := uint32(len(s))
-		if err := binary.Write(file, binary.LittleEndian, length); err != nil {
-			return err
+		field, err := a.codec.Format(a.data[i])
+		if err != nil {
+			return enc.Len(), err
 		}
-		if _, err := file.Write([]byte(s)); err != nil {
-			return err
+		if err := persist.String64.Encode(enc, field); err != nil {
+			return enc.Len(), err
 		}
 	}
-	return nil
+	err := enc.Flush()
+	return enc.Len(), err
 }
 
-func (a *Array) ReadBinary(filename string) error {
-	file, err := os.Open(filename)
+// ReadCppFrom replaces the contents of the array with a file written by the
+// C++ Array::writeBinary, parsing every element with the array's codec.
+func (a *Array[T]) ReadCppFrom(r io.Reader) (int64, error) {
+	dec := persist.NewDecoder(r, a.decodeOpts)
+	rawLength, err := dec.Uint32()
 	if err != nil {
-		return fmt.Errorf("failed to open file: %w", err)
+		return dec.Offset(), err
+	}
+	length := int32(rawLength)
+	if length < 0 {
+		return dec.Offset(), fmt.Errorf("invalid length %d", length)
+	}
+	if err := dec.CheckElements(uint64(length)); err != nil {
+		return dec.Offset(), err
 	}
-	defer file.Close()
 
-	var length uint32
-	if err := binary.Read(file, binary.LittleEndian, &length); err != nil {
-		return err
+	data := make([]T, 0, min(int(length), 1024))
+	for i := 0; i < int(length); i++ {
+		field, err := persist.String64.Decode(dec)
+		if err != nil {
+			return dec.Offset(), err
+		}
+		value, err := a.codec.Parse(field)
+		if err != nil {
+			return dec.Offset(), fmt.Errorf("invalid element %d: %w", i, err)
+		}
+		data = append(data, value)
 	}
 
-	newCap := int(length)
-	if newCap == 0 {
-		newCap = 1
+	if length == 0 {
+		data = make([]T, 1)
+	}
+	a.replace(data, int(length))
+	return dec.Offset(), nil
+}
+
+// header describes the binary format written by WriteTo.
+func (a *Array[T]) header() persist.Header {
+	return persist.Header{Type: persist.TypeArray, Value: persist.EncodingOf(a.codec), Flags: a.encodeOpts.Flags()}
+}
+
+// SetEncodeOptions changes the optional parts of the binary format written by
+// WriteTo and WriteBinary. Its Compression also applies to WriteTextTo and
+// WriteText; readers detect compressed files on their own.
+func (a *Array[T]) SetEncodeOptions(opts persist.EncodeOptions) {
+	a.encodeOpts = opts
+}
+
+// SetDecodeOptions changes the resource limits enforced by every Read*
+// method. Input that goes over a limit fails with persist.ErrLimitExceeded.
+func (a *Array[T]) SetDecodeOptions(opts persist.DecodeOptions) {
+	a.decodeOpts = opts
+}
+
+func (a *Array[T]) readBinary(dec *persist.Decoder) (int64, error) {
+	length, err := dec.Uint32()
+	if err != nil {
+		return dec.Offset(), err
+	}
+	if err := dec.CheckElements(uint64(length)); err != nil {
+		return dec.Offset(), err
 	}
-	a.data = make([]string, newCap)
-	a.cap = newCap
-	a.len = 0
 
+	data := make([]T, 0, min(int(length), 1024))
 	for i := uint32(0); i < length; i++ {
-		var strLen uint32
-		if err := binary.Read(file, binary.LittleEndian, &strLen); err != nil {
-			return err
+		value, err := a.codec.Decode(dec)
+		if err != nil {
+			return dec.Offset(), err
 		}
-		buf := make([]byte, strLen)
-		if _, err := file.Read(buf); err != nil {
-			return err
+		if err := dec.EndRecord(); err != nil {
+			return dec.Offset(), err
 		}
-		a.data[i] = string(buf)
-		a.len++
+		data = append(data, value)
+	}
+
+	if err := dec.Finish(); err != nil {
+		return dec.Offset(), err
 	}
+	if length == 0 {
+		data = make([]T, 1)
+	}
+	a.replace(data, int(length))
+	return dec.Offset(), nil
+}
+
+func (a *Array[T]) replace(data []T, length int) {
+	a.data = data
+	a.cap = len(data)
+	a.len = length
+	a.version++
+}
+
+func (a *Array[T]) MarshalBinary() ([]byte, error) {
+	return persist.MarshalBinary(a.WriteTo)
+}
+
+func (a *Array[T]) UnmarshalBinary(data []byte) error {
+	return persist.UnmarshalBinary(data, a.ReadFrom)
+}
+
+// MarshalJSON encodes the array as a JSON array of its elements.
+func (a *Array[T]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.data[:a.len])
+}
+
+// UnmarshalJSON replaces the contents of the array with the elements of a
+// JSON array.
+func (a *Array[T]) UnmarshalJSON(data []byte) error {
+	var items []T
+	if err := json.Unmarshal(data, &items); err != nil {
+		return err
+	}
+	length := len(items)
+	if len(items) == 0 {
+		items = make([]T, 1)
+	}
+	a.replace(items, length)
 	return nil
 }
 
-func (a *Array) WriteText(filename string) error {
-	file, err := os.Create(filename)
+func (a *Array[T]) WriteBinary(filename string) error {
+	return persist.WriteFile(filename, a.WriteTo)
+}
+
+func (a *Array[T]) ReadBinary(filename string) error {
+	file, err := os.Open(filename)
 	if err != nil {
-		return fmt.Errorf("failed to open file for writing: %w", err)
+		return fmt.Errorf("failed to open file: %w", err)
 	}
 	defer file.Close()
 
-	writer := bufio.NewWriter(file)
-	defer writer.Flush()
+	_, err = a.ReadFrom(bufio.NewReader(file))
+	return err
+}
 
-	if _, err := fmt.Fprintf(writer, "%d\n", a.len); err != nil {
-		return err
+// ReadBinaryLegacy reads a file written before the container header was
+// introduced.
+func (a *Array[T]) ReadBinaryLegacy(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	_, err = a.ReadLegacyFrom(bufio.NewReader(file))
+	return err
+}
+
+// WriteTextTo writes the length and then one element per line. Elements
+// that cannot be written verbatim are quoted with persist.QuoteLine.
+func (a *Array[T]) WriteTextTo(w io.Writer) (int64, error) {
+	enc := persist.NewEncoder(w)
+	if err := enc.CompressText(a.encodeOpts); err != nil {
+		return enc.Len(), err
+	}
+	return a.writeText(enc, persist.QuotedLines)
+}
+
+// WriteCppTextTo writes the array in the format of the C++
+// Array::writeText. Elements whose text contains a newline cannot be
+// written.
+func (a *Array[T]) WriteCppTextTo(w io.Writer) (int64, error) {
+	return a.writeText(persist.NewEncoder(w), persist.CppLines)
+}
+
+func (a *Array[T]) writeText(enc *persist.Encoder, format persist.LineFormat) (int64, error) {
+	if _, err := fmt.Fprintf(enc, "%d\n", a.len); err != nil {
+		return enc.Len(), err
 	}
 
 	for i := 0; i < a.len; i++ {
-		if _, err := fmt.Fprintln(writer, a.data[i]); err != nil {
-			return err
+		line, err := a.codec.Format(a.data[i])
+		if err != nil {
+			return enc.Len(), err
+		}
+		if line, err = format.Quote(line); err != nil {
+			return enc.Len(), err
+		}
+		if _, err := fmt.Fprintln(enc, line); err != nil {
+			return enc.Len(), err
 		}
 	}
-	return nil
+	err := enc.Finish()
+	return enc.Len(), err
+}
+
+// ReadTextFrom replaces the contents of the array with the text data in r.
+func (a *Array[T]) ReadTextFrom(r io.Reader) (int64, error) {
+	dec := persist.NewDecoder(r, a.decodeOpts)
+	if err := dec.DetectCompression(); err != nil {
+		return dec.Offset(), err
+	}
+	return a.readText(dec, persist.QuotedLines)
+}
+
+// ReadCppTextFrom replaces the contents of the array with a file written by
+// the C++ Array::writeText.
+func (a *Array[T]) ReadCppTextFrom(r io.Reader) (int64, error) {
+	return a.readText(persist.NewDecoder(r, a.decodeOpts), persist.CppLines)
+}
+
+func (a *Array[T]) readText(dec *persist.Decoder, format persist.LineFormat) (int64, error) {
+	lines := persist.NewLineReader(dec)
+	if !lines.Scan() {
+		return dec.Offset(), persist.ScanFailure(lines, errors.New("empty file"))
+	}
+	length, err := dec.ParseCount(lines.Text())
+	if err != nil {
+		return dec.Offset(), err
+	}
+
+	data := make([]T, 0, min(length, 1024))
+	for i := 0; i < length; i++ {
+		if !lines.Scan() {
+			return dec.Offset(), persist.ScanFailure(lines, errors.New("unexpected EOF"))
+		}
+		line, err := format.Unquote(lines.Text())
+		if err != nil {
+			return dec.Offset(), persist.ScanFailure(lines, fmt.Errorf("invalid element on line %d: %w", i+2, err))
+		}
+		value, err := a.codec.Parse(line)
+		if err != nil {
+			return dec.Offset(), persist.ScanFailure(lines, fmt.Errorf("invalid element on line %d: %w", i+2, err))
+		}
+		data = append(data, value)
+	}
+
+	if err := dec.FinishText(lines); err != nil {
+		return dec.Offset(), err
+	}
+	if length == 0 {
+		data = make([]T, 1)
+	}
+
+	a.replace(data, length)
+	return dec.Offset(), nil
+}
+
+func (a *Array[T]) WriteText(filename string) error {
+	return persist.WriteFile(filename, a.WriteTextTo)
 }
 
-func (a *Array) ReadText(filename string) error {
+func (a *Array[T]) ReadText(filename string) error {
 	file, err := os.Open(filename)
 	if err != nil {
 		return fmt.Errorf("failed to open file: %w", err)
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	if !scanner.Scan() {
-		return errors.New("empty file")
+	_, err = a.ReadTextFrom(file)
+	return err
+}
+
+// ExportCSV writes the elements to w as a one-column CSV file, formatted
+// with the array's codec.
+func (a *Array[T]) ExportCSV(w io.Writer, opts persist.CSVOptions) error {
+	cw := persist.NewCSVWriter(w, opts)
+	if opts.Header {
+		if err := cw.Write([]string{"value"}); err != nil {
+			return err
+		}
 	}
-	lengthStr := scanner.Text()
-	length, err := strconv.Atoi(lengthStr)
-	if err != nil {
-		return fmt.Errorf("invalid length line: %w", err)
+	for i := 0; i < a.len; i++ {
+		field, err := a.codec.Format(a.data[i])
+		if err != nil {
+			return err
+		}
+		if err := cw.Write([]string{field}); err != nil {
+			return err
+		}
 	}
+	cw.Flush()
+	return cw.Error()
+}
 
-	newCap := length
-	if newCap == 0 {
-		newCap = 1
+// ImportCSV replaces the contents of the array with column opts.Column of
+// the CSV file in r, parsed with the array's codec.
+func (a *Array[T]) ImportCSV(r io.Reader, opts persist.CSVOptions) error {
+	dec := persist.NewDecoder(r, a.decodeOpts)
+	var data []T
+	err := persist.ReadCSV(dec, opts, opts.Column+1, func(record []string) error {
+		value, err := a.codec.Parse(record[opts.Column])
+		if err != nil {
+			return err
+		}
+		data = append(data, value)
+		return nil
+	})
+	if err != nil {
+		return err
 	}
-	a.data = make([]string, newCap)
-	a.cap = newCap
-	a.len = 0
 
-	for i := 0; i < length; i++ {
-		if !scanner.Scan() {
-			return errors.New("unexpected EOF")
-		}
-		a.data[i] = scanner.Text()
-		a.len++
+	length := len(data)
+	if length == 0 {
+		data = make([]T, 1)
 	}
+	a.replace(data, length)
 	return nil
-}
\ No newline at end of file
+}
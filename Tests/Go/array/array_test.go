@@ -3,11 +3,20 @@ package array
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"iter"
 	"os"
 	"path/filepath"
 	"reflect"
+	"slices"
 	"strconv"
+	"strings"
 	"testing"
+
+	"Go/persist"
+	"Go/persist/persisttest"
 )
 
 func captureOutput(f func()) string {
@@ -41,7 +50,7 @@ func TestConstructors(t *testing.T) {
 
 		for _, tt := range tests {
 			t.Run(tt.name, func(t *testing.T) {
-				a, err := NewArray(tt.size)
+				a, err := NewArray[string](tt.size)
 				if (err != nil) != tt.wantErr {
 					t.Errorf("NewArray() error = %v, wantErr %v", err, tt.wantErr)
 					return
@@ -121,7 +130,7 @@ func TestCoreOperations(t *testing.T) {
 		for _, tt := range tests {
 			t.Run(tt.name, func(t *testing.T) {
 				if tt.name == "Empty array" {
-					a, _ = NewArray(1)
+					a, _ = NewArray[string](1)
 				}
 
 				err := a.SetElement(tt.setVal, tt.index)
@@ -206,7 +215,7 @@ func TestCoreOperations(t *testing.T) {
 
 		for _, tt := range tests {
 			t.Run(tt.name, func(t *testing.T) {
-				a, _ := NewArray(1)
+				a, _ := NewArray[string](1)
 				for _, item := range tt.initial {
 					a.AddElementEnd(item)
 				}
@@ -246,7 +255,7 @@ func TestCoreOperations(t *testing.T) {
 	})
 
 	t.Run("GrowthBehavior", func(t *testing.T) {
-		a, _ := NewArray(2)
+		a, _ := NewArray[string](2)
 		a.AddElementEnd("a")
 		a.AddElementEnd("b")
 		
@@ -292,7 +301,7 @@ func TestCoreOperations(t *testing.T) {
 		for _, tt := range tests {
 			t.Run(tt.name, func(t *testing.T) {
 				a, _ := NewArrayFromList(tt.items)
-				if got := a.IsInArray(tt.key); got != tt.want {
+				if got := IsInArray(a, tt.key); got != tt.want {
 					t.Errorf("IsInArray() = %d, want %d", got, tt.want)
 				}
 			})
@@ -300,7 +309,7 @@ func TestCoreOperations(t *testing.T) {
 	})
 
 	t.Run("LengthAndCapacity", func(t *testing.T) {
-		a, _ := NewArray(3)
+		a, _ := NewArray[string](3)
 		if a.GetLength() != 0 {
 			t.Errorf("GetLength() = %d, want 0", a.GetLength())
 		}
@@ -356,7 +365,7 @@ func TestIOOperations(t *testing.T) {
 				t.Fatalf("WriteBinary() failed: %v", err)
 			}
 
-			binRead, _ := NewArray(1)
+			binRead, _ := NewArray[string](1)
 			if err := binRead.ReadBinary(binFile); err != nil {
 				t.Fatalf("ReadBinary() failed: %v", err)
 			}
@@ -371,12 +380,12 @@ func TestIOOperations(t *testing.T) {
 
 		t.Run("Empty array", func(t *testing.T) {
 			emptyFile := filepath.Join(tempDir, "empty.bin")
-			emptyArray, _ := NewArray(1)
+			emptyArray, _ := NewArray[string](1)
 			if err := emptyArray.WriteBinary(emptyFile); err != nil {
 				t.Fatalf("WriteBinary() failed: %v", err)
 			}
 
-			readArray, _ := NewArray(1)
+			readArray, _ := NewArray[string](1)
 			if err := readArray.ReadBinary(emptyFile); err != nil {
 				t.Fatalf("ReadBinary() failed: %v", err)
 			}
@@ -387,7 +396,7 @@ func TestIOOperations(t *testing.T) {
 
 		t.Run("File errors", func(t *testing.T) {
 			nonExistent := filepath.Join(tempDir, "nonexistent.bin")
-			a, _ := NewArray(1)
+			a, _ := NewArray[string](1)
 			if err := a.ReadBinary(nonExistent); err == nil {
 				t.Error("ReadBinary() expected error for non-existent file, got nil")
 			}
@@ -413,7 +422,7 @@ func TestIOOperations(t *testing.T) {
 				t.Fatalf("WriteText() failed: %v", err)
 			}
 
-			txtRead, _ := NewArray(1)
+			txtRead, _ := NewArray[string](1)
 			if err := txtRead.ReadText(txtFile); err != nil {
 				t.Fatalf("ReadText() failed: %v", err)
 			}
@@ -428,12 +437,12 @@ func TestIOOperations(t *testing.T) {
 
 		t.Run("Empty array", func(t *testing.T) {
 			emptyFile := filepath.Join(tempDir, "empty.txt")
-			emptyArray, _ := NewArray(1)
+			emptyArray, _ := NewArray[string](1)
 			if err := emptyArray.WriteText(emptyFile); err != nil {
 				t.Fatalf("WriteText() failed: %v", err)
 			}
 
-			readArray, _ := NewArray(1)
+			readArray, _ := NewArray[string](1)
 			if err := readArray.ReadText(emptyFile); err != nil {
 				t.Fatalf("ReadText() failed: %v", err)
 			}
@@ -444,7 +453,7 @@ func TestIOOperations(t *testing.T) {
 
 		t.Run("File errors", func(t *testing.T) {
 			nonExistent := filepath.Join(tempDir, "nonexistent.txt")
-			a, _ := NewArray(1)
+			a, _ := NewArray[string](1)
 			if err := a.ReadText(nonExistent); err == nil {
 				t.Error("ReadText() expected error for non-existent file, got nil")
 			}
@@ -471,7 +480,7 @@ func TestIOOperations(t *testing.T) {
 				t.Fatalf("WriteText() failed: %v", err)
 			}
 
-			readArray, _ := NewArray(1)
+			readArray, _ := NewArray[string](1)
 			if err := readArray.ReadText(edgeFile); err != nil {
 				t.Fatalf("ReadText() failed: %v", err)
 			}
@@ -491,19 +500,19 @@ func TestIOOperations(t *testing.T) {
 
 func TestErrorConditions(t *testing.T) {
 	t.Run("Constructor errors", func(t *testing.T) {
-		_, err := NewArray(0)
+		_, err := NewArray[string](0)
 		if err == nil {
 			t.Error("NewArray(0) expected error, got nil")
 		}
 		
-		_, err = NewArray(-5)
+		_, err = NewArray[string](-5)
 		if err == nil {
 			t.Error("NewArray(-5) expected error, got nil")
 		}
 	})
 
 	t.Run("Operation errors", func(t *testing.T) {
-		a, _ := NewArray(1)
+		a, _ := NewArray[string](1)
 		
 		_, err := a.GetElement(0)
 		if err == nil {
@@ -527,7 +536,7 @@ func TestErrorConditions(t *testing.T) {
 	})
 
 	t.Run("File operation errors", func(t *testing.T) {
-		a, _ := NewArray(1)
+		a, _ := NewArray[string](1)
 		
 		invalidPath := "/invalid/path/test.bin"
 		if err := a.WriteBinary(invalidPath); err == nil {
@@ -582,7 +591,7 @@ func TestErrorConditions(t *testing.T) {
 
 func TestEdgeCases(t *testing.T) {
 	t.Run("Zero-length strings", func(t *testing.T) {
-		a, _ := NewArray(3)
+		a, _ := NewArray[string](3)
 		a.AddElementEnd("")
 		a.AddElementEnd("")
 		a.AddElementEnd("")
@@ -603,7 +612,7 @@ func TestEdgeCases(t *testing.T) {
 	})
 
 	t.Run("Maximum growth", func(t *testing.T) {
-		a, _ := NewArray(1)
+		a, _ := NewArray[string](1)
 		for i := 0; i < 5; i++ {
 			a.AddElementEnd(strconv.Itoa(i))
 		}
@@ -621,7 +630,7 @@ func TestEdgeCases(t *testing.T) {
 	})
 
 	t.Run("Large string handling", func(t *testing.T) {
-		a, _ := NewArray(2)
+		a, _ := NewArray[string](2)
 		largeString := string(make([]byte, 10000))
 		a.AddElementEnd(largeString)
 		
@@ -634,4 +643,323 @@ func TestEdgeCases(t *testing.T) {
 			t.Errorf("Large string length = %d, want 10000", len(val))
 		}
 	})
-}
\ No newline at end of file
+}
+type point struct {
+	X, Y int
+	Tag  string
+}
+
+func TestGenericElements(t *testing.T) {
+	tempDir := t.TempDir()
+
+	t.Run("Ints", func(t *testing.T) {
+		a, _ := NewArrayFromList([]int{3, -1, 4, 1 << 40})
+		if IsInArray(a, 4) != 2 {
+			t.Errorf("IsInArray(4) = %d, want 2", IsInArray(a, 4))
+		}
+
+		binFile := filepath.Join(tempDir, "ints.bin")
+		if err := a.WriteBinary(binFile); err != nil {
+			t.Fatalf("WriteBinary() failed: %v", err)
+		}
+		binRead, _ := NewArray[int](1)
+		if err := binRead.ReadBinary(binFile); err != nil {
+			t.Fatalf("ReadBinary() failed: %v", err)
+		}
+		if !reflect.DeepEqual(binRead.data[:binRead.len], a.data[:a.len]) {
+			t.Errorf("ReadBinary() = %v, want %v", binRead.data[:binRead.len], a.data[:a.len])
+		}
+
+		txtFile := filepath.Join(tempDir, "ints.txt")
+		if err := a.WriteText(txtFile); err != nil {
+			t.Fatalf("WriteText() failed: %v", err)
+		}
+		content, _ := os.ReadFile(txtFile)
+		if string(content) != "4\n3\n-1\n4\n1099511627776\n" {
+			t.Errorf("WriteText() content = %q", content)
+		}
+		txtRead, _ := NewArray[int](1)
+		if err := txtRead.ReadText(txtFile); err != nil {
+			t.Fatalf("ReadText() failed: %v", err)
+		}
+		if !reflect.DeepEqual(txtRead.data[:txtRead.len], a.data[:a.len]) {
+			t.Errorf("ReadText() = %v, want %v", txtRead.data[:txtRead.len], a.data[:a.len])
+		}
+
+		bad := filepath.Join(tempDir, "bad_ints.txt")
+		os.WriteFile(bad, []byte("1\nnot a number\n"), 0644)
+		if err := txtRead.ReadText(bad); err == nil {
+			t.Error("ReadText() with non-numeric element expected error, got nil")
+		}
+	})
+
+	t.Run("Structs", func(t *testing.T) {
+		a, _ := NewArrayFromList([]point{{1, 2, "a"}, {-3, 4, "line\nbreak"}})
+		if IsInArray(a, point{-3, 4, "line\nbreak"}) != 1 {
+			t.Error("IsInArray() did not find struct element")
+		}
+
+		for _, name := range []string{"points.bin", "points.txt"} {
+			filename := filepath.Join(tempDir, name)
+			read, _ := NewArray[point](1)
+			var err error
+			if filepath.Ext(name) == ".bin" {
+				if err = a.WriteBinary(filename); err == nil {
+					err = read.ReadBinary(filename)
+				}
+			} else {
+				if err = a.WriteText(filename); err == nil {
+					err = read.ReadText(filename)
+				}
+			}
+			if err != nil {
+				t.Fatalf("%s round trip failed: %v", name, err)
+			}
+			if !reflect.DeepEqual(read.data[:read.len], a.data[:a.len]) {
+				t.Errorf("%s round trip = %v, want %v", name, read.data[:read.len], a.data[:a.len])
+			}
+		}
+	})
+
+	t.Run("ByteSlices", func(t *testing.T) {
+		a, _ := NewArrayFromList([][]byte{{0, 1, 2}, {}, []byte("\n\xff")})
+		if a.IndexFunc(func(b []byte) bool { return len(b) == 0 }) != 1 {
+			t.Error("IndexFunc() did not find the empty slice")
+		}
+
+		for _, name := range []string{"bytes.bin", "bytes.txt"} {
+			filename := filepath.Join(tempDir, name)
+			read, _ := NewArray[[]byte](1)
+			var err error
+			if filepath.Ext(name) == ".bin" {
+				if err = a.WriteBinary(filename); err == nil {
+					err = read.ReadBinary(filename)
+				}
+			} else {
+				if err = a.WriteText(filename); err == nil {
+					err = read.ReadText(filename)
+				}
+			}
+			if err != nil {
+				t.Fatalf("%s round trip failed: %v", name, err)
+			}
+			for i := 0; i < a.len; i++ {
+				if !bytes.Equal(read.data[i], a.data[i]) {
+					t.Errorf("%s element %d = %v, want %v", name, i, read.data[i], a.data[i])
+				}
+			}
+		}
+	})
+
+	t.Run("CustomCodec", func(t *testing.T) {
+		a, _ := NewArrayFromList([]string{"a", "bc"})
+		a.SetCodec(persist.String64)
+
+		filename := filepath.Join(tempDir, "custom.bin")
+		if err := a.WriteBinary(filename); err != nil {
+			t.Fatalf("WriteBinary() failed: %v", err)
+		}
+		content, _ := os.ReadFile(filename)
+		if want := persist.HeaderSize + 4 + 8 + 1 + 8 + 2 + persist.ChecksumSize; len(content) != want {
+			t.Errorf("WriteBinary() with String64 wrote %d bytes, want %d", len(content), want)
+		}
+
+		read, _ := NewArray[string](1)
+		read.SetCodec(persist.String64)
+		if err := read.ReadBinary(filename); err != nil {
+			t.Fatalf("ReadBinary() failed: %v", err)
+		}
+		if read.len != 2 || read.data[1] != "bc" {
+			t.Errorf("ReadBinary() = %v", read.data[:read.len])
+		}
+	})
+
+	t.Run("DeleteReleasesElement", func(t *testing.T) {
+		a, _ := NewArrayFromList([]*point{{X: 1}, {X: 2}})
+		a.DeleteElement(0)
+		if a.data[1] != nil {
+			t.Error("DeleteElement() left a stale reference past the end")
+		}
+	})
+}
+
+func TestIterators(t *testing.T) {
+	a, _ := NewArrayFromList([]string{"a", "b", "c"})
+
+	if got := slices.Collect(a.All()); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Errorf("All() = %v", got)
+	}
+	if got := slices.Collect(a.Backward()); !reflect.DeepEqual(got, []string{"c", "b", "a"}) {
+		t.Errorf("Backward() = %v", got)
+	}
+
+	var first []string
+	for v := range a.All() {
+		first = append(first, v)
+		break
+	}
+	if !reflect.DeepEqual(first, []string{"a"}) {
+		t.Errorf("All() with break = %v", first)
+	}
+
+	empty, _ := NewArray[string](4)
+	if got := slices.Collect(empty.All()); len(got) != 0 {
+		t.Errorf("All() on empty array = %v", got)
+	}
+
+	for v := range a.All() {
+		a.SetElement(v+v, 0)
+	}
+	if v, _ := a.GetElement(0); v != "cc" {
+		t.Errorf("SetElement() during iteration: element 0 = %q, want %q", v, "cc")
+	}
+
+	mutations := map[string]func(){
+		"AddElementEnd":     func() { a.AddElementEnd("x") },
+		"AddElementAtIndex": func() { a.AddElementAtIndex("x", 0) },
+		"DeleteElement":     func() { a.DeleteElement(0) },
+	}
+	for name, mutate := range mutations {
+		for _, seq := range []iter.Seq[string]{a.All(), a.Backward()} {
+			t.Run(name, func(t *testing.T) {
+				defer func() {
+					if recover() == nil {
+						t.Errorf("%s during iteration did not panic", name)
+					}
+				}()
+				for range seq {
+					mutate()
+				}
+			})
+		}
+	}
+}
+
+func TestReaderWriter(t *testing.T) {
+	persisttest.TestContainer(t, persisttest.Fixture[*Array[string]]{
+		New: func() *Array[string] {
+			a, _ := NewArray[string](1)
+			return a
+		},
+		Make: func(values []string) *Array[string] {
+			a, _ := NewArrayFromList(values)
+			return a
+		},
+		Contents: func(a *Array[string]) any { return slices.Collect(a.All()) },
+	})
+}
+
+func TestJSON(t *testing.T) {
+	a, _ := NewArrayFromList([]string{"a", "b\nc", ""})
+	data, err := json.Marshal(a)
+	if err != nil {
+		t.Fatalf("json.Marshal() failed: %v", err)
+	}
+	if string(data) != `["a","b\nc",""]` {
+		t.Errorf("json.Marshal() = %s", data)
+	}
+
+	loaded, _ := NewArray[string](1)
+	if err := json.Unmarshal(data, loaded); err != nil {
+		t.Fatalf("json.Unmarshal() failed: %v", err)
+	}
+	if got := slices.Collect(loaded.All()); !reflect.DeepEqual(got, []string{"a", "b\nc", ""}) {
+		t.Errorf("json.Unmarshal() loaded %q", got)
+	}
+
+	empty, _ := NewArray[int](1)
+	if data, _ := json.Marshal(empty); string(data) != "[]" {
+		t.Errorf("json.Marshal() of empty array = %s, want []", data)
+	}
+	if err := json.Unmarshal([]byte("[]"), loaded); err != nil || loaded.len != 0 || loaded.cap < 1 {
+		t.Errorf("json.Unmarshal([]) = %v, len %d, cap %d", err, loaded.len, loaded.cap)
+	}
+
+	ints, _ := NewArray[int](1)
+	if err := json.Unmarshal([]byte(`[1,"x"]`), ints); err == nil {
+		t.Error("json.Unmarshal() of a mistyped element returned nil error")
+	}
+}
+
+func TestCSV(t *testing.T) {
+	original, _ := NewArrayFromList([]int{3, -1, 40})
+	var buf bytes.Buffer
+	if err := original.ExportCSV(&buf, persist.CSVOptions{Header: true}); err != nil {
+		t.Fatalf("ExportCSV() failed: %v", err)
+	}
+	if want := "value\n3\n-1\n40\n"; buf.String() != want {
+		t.Errorf("ExportCSV() wrote %q, want %q", buf.String(), want)
+	}
+
+	loaded, _ := NewArray[int](1)
+	if err := loaded.ImportCSV(&buf, persist.CSVOptions{Header: true}); err != nil {
+		t.Fatalf("ImportCSV() failed: %v", err)
+	}
+	if got := slices.Collect(loaded.All()); !reflect.DeepEqual(got, []int{3, -1, 40}) {
+		t.Errorf("ImportCSV() loaded %v", got)
+	}
+
+	if err := loaded.ImportCSV(strings.NewReader("id,qty\na,1\nb,2\n"), persist.CSVOptions{Header: true, Column: 1}); err != nil {
+		t.Fatalf("ImportCSV() of column 1 failed: %v", err)
+	}
+	if got := slices.Collect(loaded.All()); !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Errorf("ImportCSV() of column 1 loaded %v", got)
+	}
+
+	var rowErr *persist.RowError
+	err := loaded.ImportCSV(strings.NewReader("1\n2\nx\n"), persist.CSVOptions{})
+	if !errors.As(err, &rowErr) || rowErr.Row != 3 {
+		t.Errorf("ImportCSV() of a bad element = %v, want an error for row 3", err)
+	}
+	if got := slices.Collect(loaded.All()); !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Errorf("failed ImportCSV() changed the array to %v", got)
+	}
+
+	if err := loaded.ImportCSV(strings.NewReader(""), persist.CSVOptions{}); err != nil || loaded.len != 0 {
+		t.Errorf("ImportCSV() of an empty file = %v, length %d", err, loaded.len)
+	}
+}
+
+// TestCppGolden checks the C++ formats against files written by the C++
+// Array; see Serialization/C++/Golden.
+func TestCppGolden(t *testing.T) {
+	want := []string{"alpha", "b c", "", "юникод"}
+	tests := []struct {
+		file  string
+		write func(*Array[string], io.Writer) (int64, error)
+		read  func(*Array[string], io.Reader) (int64, error)
+	}{
+		{"array.bin", (*Array[string]).WriteCppTo, (*Array[string]).ReadCppFrom},
+		{"array.txt", (*Array[string]).WriteCppTextTo, (*Array[string]).ReadCppTextFrom},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			golden, err := os.ReadFile(filepath.Join("testdata", "cpp", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			loaded, _ := NewArray[string](1)
+			if _, err := tt.read(loaded, bytes.NewReader(golden)); err != nil {
+				t.Fatalf("reading the C++ file failed: %v", err)
+			}
+			if got := slices.Collect(loaded.All()); !reflect.DeepEqual(got, want) {
+				t.Errorf("read %q, want %q", got, want)
+			}
+
+			original, _ := NewArrayFromList(want)
+			var buf bytes.Buffer
+			if _, err := tt.write(original, &buf); err != nil {
+				t.Fatalf("writing the C++ format failed: %v", err)
+			}
+			if !bytes.Equal(buf.Bytes(), golden) {
+				t.Errorf("wrote\n%q\nwant\n%q", buf.Bytes(), golden)
+			}
+		})
+	}
+
+	newline, _ := NewArrayFromList([]string{"a\nb"})
+	if _, err := newline.WriteCppTextTo(io.Discard); !errors.Is(err, persist.ErrCppNewline) {
+		t.Errorf("WriteCppTextTo() of a multi-line element = %v, want ErrCppNewline", err)
+	}
+}
@@ -0,0 +1,431 @@
+// Package deque provides a double-ended queue of strings.
+package deque
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+
+	"Go/persist"
+)
+
+// minCapacity is the smallest buffer a Deque allocates. Buffers are always a
+// power of two long so that indexes wrap with a mask.
+const minCapacity = 8
+
+var (
+	// ErrEmpty is returned when popping or peeking at an empty deque.
+	ErrEmpty = errors.New("deque is empty")
+	// ErrIndex is returned by At for an index outside the deque.
+	ErrIndex = errors.New("deque index out of range")
+)
+
+// Deque is a double-ended queue that keeps its values in a circular buffer.
+// Pushing and popping at either end take amortized constant time: the
+// buffer doubles when it is full and halves when it is a quarter full. At
+// reads any position in constant time.
+type Deque struct {
+	buf        []string
+	head       int
+	size       int
+	version    int
+	encodeOpts persist.EncodeOptions
+	decodeOpts persist.DecodeOptions
+}
+
+// NewDeque creates a deque holding items, front first.
+func NewDeque(items ...string) *Deque {
+	d := &Deque{}
+	for _, item := range items {
+		d.PushBack(item)
+	}
+	return d
+}
+
+// index returns the buffer index of the i-th value from the front.
+func (d *Deque) index(i int) int {
+	return (d.head + i) & (len(d.buf) - 1)
+}
+
+// resize moves the values into a buffer of the given length, which must be
+// a power of two that holds them all.
+func (d *Deque) resize(capacity int) {
+	buf := make([]string, capacity)
+	if d.size > 0 {
+		if end := d.head + d.size; end <= len(d.buf) {
+			copy(buf, d.buf[d.head:end])
+		} else {
+			n := copy(buf, d.buf[d.head:])
+			copy(buf[n:], d.buf[:end-len(d.buf)])
+		}
+	}
+	d.buf = buf
+	d.head = 0
+}
+
+// growIfFull makes room for one more value.
+func (d *Deque) growIfFull() {
+	if d.size == len(d.buf) {
+		d.resize(max(2*len(d.buf), minCapacity))
+	}
+}
+
+// shrinkIfSparse halves the buffer once it is no more than a quarter full,
+// so that a deque that held many values does not keep their memory.
+func (d *Deque) shrinkIfSparse() {
+	if len(d.buf) > minCapacity && d.size <= len(d.buf)/4 {
+		d.resize(len(d.buf) / 2)
+	}
+}
+
+// PushFront adds value in front of the first value.
+func (d *Deque) PushFront(value string) {
+	d.growIfFull()
+	d.head = (d.head - 1) & (len(d.buf) - 1)
+	d.buf[d.head] = value
+	d.size++
+	d.version++
+}
+
+// PushBack adds value behind the last value.
+func (d *Deque) PushBack(value string) {
+	d.growIfFull()
+	d.buf[d.index(d.size)] = value
+	d.size++
+	d.version++
+}
+
+// PopFront removes and returns the first value.
+func (d *Deque) PopFront() (string, error) {
+	if d.size == 0 {
+		return "", ErrEmpty
+	}
+	value := d.buf[d.head]
+	d.buf[d.head] = ""
+	d.head = d.index(1)
+	d.size--
+	d.version++
+	d.shrinkIfSparse()
+	return value, nil
+}
+
+// PopBack removes and returns the last value.
+func (d *Deque) PopBack() (string, error) {
+	if d.size == 0 {
+		return "", ErrEmpty
+	}
+	last := d.index(d.size - 1)
+	value := d.buf[last]
+	d.buf[last] = ""
+	d.size--
+	d.version++
+	d.shrinkIfSparse()
+	return value, nil
+}
+
+// PeekFront returns the first value without removing it.
+func (d *Deque) PeekFront() (string, error) {
+	if d.size == 0 {
+		return "", ErrEmpty
+	}
+	return d.buf[d.head], nil
+}
+
+// PeekBack returns the last value without removing it.
+func (d *Deque) PeekBack() (string, error) {
+	if d.size == 0 {
+		return "", ErrEmpty
+	}
+	return d.buf[d.index(d.size-1)], nil
+}
+
+// At returns the value at index i, counting from zero at the front.
+func (d *Deque) At(i int) (string, error) {
+	if i < 0 || i >= d.size {
+		return "", fmt.Errorf("%w: %d of %d", ErrIndex, i, d.size)
+	}
+	return d.buf[d.index(i)], nil
+}
+
+func (d *Deque) Len() int {
+	return d.size
+}
+
+func (d *Deque) IsEmpty() bool {
+	return d.size == 0
+}
+
+// Clear removes every value and releases the buffer.
+func (d *Deque) Clear() {
+	d.buf = nil
+	d.head = 0
+	d.size = 0
+	d.version++
+}
+
+// All yields the values from front to back. Pushing or popping while
+// iterating panics.
+func (d *Deque) All() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		version := d.version
+		for i := 0; i < d.size; i++ {
+			if !yield(d.buf[d.index(i)]) {
+				return
+			}
+			if d.version != version {
+				panic("deque: deque modified during iteration")
+			}
+		}
+	}
+}
+
+// Backward yields the values from back to front.
+func (d *Deque) Backward() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		version := d.version
+		for i := d.size - 1; i >= 0; i-- {
+			if !yield(d.buf[d.index(i)]) {
+				return
+			}
+			if d.version != version {
+				panic("deque: deque modified during iteration")
+			}
+		}
+	}
+}
+
+// WriteTo writes the deque in its binary format, which is the one of
+// doublelist.DoubleList under its own header: the length followed by each
+// value from front to back.
+func (d *Deque) WriteTo(w io.Writer) (int64, error) {
+	enc := persist.NewEncoder(w)
+	if err := enc.WriteHeader(d.header()); err != nil {
+		return enc.Len(), err
+	}
+	if err := enc.Uint64(uint64(d.size)); err != nil {
+		return enc.Len(), err
+	}
+
+	for value := range d.All() {
+		if err := persist.String64.Encode(enc, value); err != nil {
+			return enc.Len(), err
+		}
+		if err := enc.EndRecord(); err != nil {
+			return enc.Len(), err
+		}
+	}
+	err := enc.Finish()
+	return enc.Len(), err
+}
+
+// ReadFrom replaces the contents of the deque with the binary data in r. The
+// deque is left unchanged if the data cannot be decoded.
+func (d *Deque) ReadFrom(r io.Reader) (int64, error) {
+	dec := persist.NewDecoder(r, d.decodeOpts)
+	if _, err := dec.ExpectHeader(d.header()); err != nil {
+		return dec.Offset(), err
+	}
+
+	length, err := dec.Uint64()
+	if err != nil {
+		return dec.Offset(), err
+	}
+	if err := dec.CheckElements(length); err != nil {
+		return dec.Offset(), err
+	}
+
+	loaded := NewDeque()
+	for i := uint64(0); i < length; i++ {
+		value, err := persist.String64.Decode(dec)
+		if err != nil {
+			return dec.Offset(), err
+		}
+		if err := dec.EndRecord(); err != nil {
+			return dec.Offset(), err
+		}
+		loaded.PushBack(value)
+	}
+
+	if err := dec.Finish(); err != nil {
+		return dec.Offset(), err
+	}
+	d.replace(loaded)
+	return dec.Offset(), nil
+}
+
+// header describes the binary format written by WriteTo.
+func (d *Deque) header() persist.Header {
+	return persist.Header{Type: persist.TypeDeque, Value: persist.EncodingString64, Flags: d.encodeOpts.Flags()}
+}
+
+// SetEncodeOptions changes the optional parts of the binary format written by
+// WriteTo and WriteBinary. Its Compression also applies to WriteTextTo and
+// WriteText; readers detect compressed files on their own.
+func (d *Deque) SetEncodeOptions(opts persist.EncodeOptions) {
+	d.encodeOpts = opts
+}
+
+// SetDecodeOptions changes the resource limits enforced by every Read*
+// method. Input that goes over a limit fails with persist.ErrLimitExceeded.
+func (d *Deque) SetDecodeOptions(opts persist.DecodeOptions) {
+	d.decodeOpts = opts
+}
+
+func (d *Deque) replace(other *Deque) {
+	d.buf = other.buf
+	d.head = other.head
+	d.size = other.size
+	d.version++
+}
+
+func (d *Deque) MarshalBinary() ([]byte, error) {
+	return persist.MarshalBinary(d.WriteTo)
+}
+
+func (d *Deque) UnmarshalBinary(data []byte) error {
+	return persist.UnmarshalBinary(data, d.ReadFrom)
+}
+
+// MarshalJSON encodes the deque as a JSON array from front to back.
+func (d *Deque) MarshalJSON() ([]byte, error) {
+	values := make([]string, 0, d.size)
+	for value := range d.All() {
+		values = append(values, value)
+	}
+	return json.Marshal(values)
+}
+
+// UnmarshalJSON replaces the contents of the deque with the strings of a JSON
+// array, front first.
+func (d *Deque) UnmarshalJSON(data []byte) error {
+	var values []string
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	d.replace(NewDeque(values...))
+	return nil
+}
+
+func (d *Deque) WriteBinary(filename string) error {
+	return persist.WriteFile(filename, d.WriteTo)
+}
+
+func (d *Deque) ReadBinary(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	_, err = d.ReadFrom(bufio.NewReader(file))
+	return err
+}
+
+// WriteTextTo writes the length and then one value per line from front to
+// back. Values that cannot be written verbatim are quoted with
+// persist.QuoteLine.
+func (d *Deque) WriteTextTo(w io.Writer) (int64, error) {
+	enc := persist.NewEncoder(w)
+	if err := enc.CompressText(d.encodeOpts); err != nil {
+		return enc.Len(), err
+	}
+	if _, err := fmt.Fprintf(enc, "%d\n", d.size); err != nil {
+		return enc.Len(), err
+	}
+
+	for value := range d.All() {
+		if _, err := fmt.Fprintln(enc, persist.QuoteLine(value)); err != nil {
+			return enc.Len(), err
+		}
+	}
+	err := enc.Finish()
+	return enc.Len(), err
+}
+
+// ReadTextFrom replaces the contents of the deque with the text data in r.
+func (d *Deque) ReadTextFrom(r io.Reader) (int64, error) {
+	dec := persist.NewDecoder(r, d.decodeOpts)
+	if err := dec.DetectCompression(); err != nil {
+		return dec.Offset(), err
+	}
+
+	lines := persist.NewLineReader(dec)
+	if !lines.Scan() {
+		return dec.Offset(), persist.ScanFailure(lines, io.EOF)
+	}
+	length, err := dec.ParseCount(lines.Text())
+	if err != nil {
+		return dec.Offset(), err
+	}
+
+	loaded := NewDeque()
+	for i := 0; i < length; i++ {
+		if !lines.Scan() {
+			return dec.Offset(), persist.ScanFailure(lines, errors.New("unexpected EOF in file"))
+		}
+		value, err := persist.UnquoteLine(lines.Text())
+		if err != nil {
+			return dec.Offset(), fmt.Errorf("invalid value on line %d: %w", i+2, err)
+		}
+		loaded.PushBack(value)
+	}
+
+	if err := dec.FinishText(lines); err != nil {
+		return dec.Offset(), err
+	}
+	d.replace(loaded)
+	return dec.Offset(), nil
+}
+
+func (d *Deque) WriteText(filename string) error {
+	return persist.WriteFile(filename, d.WriteTextTo)
+}
+
+func (d *Deque) ReadText(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	_, err = d.ReadTextFrom(file)
+	return err
+}
+
+// ExportCSV writes the values to w as a one-column CSV file, from front to
+// back.
+func (d *Deque) ExportCSV(w io.Writer, opts persist.CSVOptions) error {
+	cw := persist.NewCSVWriter(w, opts)
+	if opts.Header {
+		if err := cw.Write([]string{"value"}); err != nil {
+			return err
+		}
+	}
+	for value := range d.All() {
+		if err := cw.Write([]string{value}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ImportCSV replaces the contents of the deque with column opts.Column of
+// the CSV file in r.
+func (d *Deque) ImportCSV(r io.Reader, opts persist.CSVOptions) error {
+	dec := persist.NewDecoder(r, d.decodeOpts)
+	loaded := NewDeque()
+	err := persist.ReadCSV(dec, opts, opts.Column+1, func(record []string) error {
+		loaded.PushBack(record[opts.Column])
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	d.replace(loaded)
+	return nil
+}
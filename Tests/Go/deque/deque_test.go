@@ -0,0 +1,326 @@
+package deque
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"Go/doublelist"
+	"Go/persist"
+	"Go/persist/persisttest"
+)
+
+// checkDeque fails the test unless d holds want, front first.
+func checkDeque(t *testing.T, d *Deque, want []string) {
+	t.Helper()
+	if got := slices.Collect(d.All()); !slices.Equal(got, want) {
+		t.Fatalf("deque holds %v, want %v", got, want)
+	}
+	backward := slices.Clone(want)
+	slices.Reverse(backward)
+	if got := slices.Collect(d.Backward()); !slices.Equal(got, backward) {
+		t.Fatalf("Backward() yields %v, want %v", got, backward)
+	}
+	if d.Len() != len(want) || d.IsEmpty() != (len(want) == 0) {
+		t.Fatalf("Len() = %d, IsEmpty() = %v for %d values", d.Len(), d.IsEmpty(), len(want))
+	}
+	for i, value := range want {
+		if got, err := d.At(i); err != nil || got != value {
+			t.Fatalf("At(%d) = %q, %v, want %q", i, got, err, value)
+		}
+	}
+}
+
+func TestDeque(t *testing.T) {
+	t.Run("Ends", func(t *testing.T) {
+		d := NewDeque("b", "c")
+		d.PushFront("a")
+		d.PushBack("d")
+		checkDeque(t, d, []string{"a", "b", "c", "d"})
+
+		if value, err := d.PeekFront(); err != nil || value != "a" {
+			t.Errorf("PeekFront() = %q, %v, want \"a\"", value, err)
+		}
+		if value, err := d.PeekBack(); err != nil || value != "d" {
+			t.Errorf("PeekBack() = %q, %v, want \"d\"", value, err)
+		}
+		if value, err := d.PopFront(); err != nil || value != "a" {
+			t.Errorf("PopFront() = %q, %v, want \"a\"", value, err)
+		}
+		if value, err := d.PopBack(); err != nil || value != "d" {
+			t.Errorf("PopBack() = %q, %v, want \"d\"", value, err)
+		}
+		checkDeque(t, d, []string{"b", "c"})
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		d := NewDeque()
+		for name, op := range map[string]func() (string, error){
+			"PopFront":  d.PopFront,
+			"PopBack":   d.PopBack,
+			"PeekFront": d.PeekFront,
+			"PeekBack":  d.PeekBack,
+		} {
+			if _, err := op(); !errors.Is(err, ErrEmpty) {
+				t.Errorf("%s() on an empty deque = %v, want ErrEmpty", name, err)
+			}
+		}
+		d.PushBack("x")
+		for _, i := range []int{-1, 1} {
+			if _, err := d.At(i); !errors.Is(err, ErrIndex) {
+				t.Errorf("At(%d) = %v, want ErrIndex", i, err)
+			}
+		}
+		d.Clear()
+		checkDeque(t, d, nil)
+	})
+
+	t.Run("Random", func(t *testing.T) {
+		rng := rand.New(rand.NewSource(1))
+		d := NewDeque()
+		var want []string
+		for i := 0; i < 20000; i++ {
+			value := strconv.Itoa(i)
+			// Lean towards pushing for the first half and popping for the
+			// second, so the buffer both grows and shrinks.
+			push := rng.Intn(10) < 6
+			if i >= 10000 {
+				push = !push
+			}
+			switch {
+			case push && rng.Intn(2) == 0:
+				d.PushFront(value)
+				want = slices.Insert(want, 0, value)
+			case push:
+				d.PushBack(value)
+				want = append(want, value)
+			case rng.Intn(2) == 0:
+				got, err := d.PopFront()
+				if len(want) == 0 {
+					if err == nil {
+						t.Fatal("PopFront() on an empty deque succeeded")
+					}
+					continue
+				}
+				if err != nil || got != want[0] {
+					t.Fatalf("PopFront() = %q, %v, want %q", got, err, want[0])
+				}
+				want = want[1:]
+			default:
+				got, err := d.PopBack()
+				if len(want) == 0 {
+					if err == nil {
+						t.Fatal("PopBack() on an empty deque succeeded")
+					}
+					continue
+				}
+				if err != nil || got != want[len(want)-1] {
+					t.Fatalf("PopBack() = %q, %v, want %q", got, err, want[len(want)-1])
+				}
+				want = want[:len(want)-1]
+			}
+			if i%500 == 0 {
+				checkDeque(t, d, want)
+			}
+		}
+		checkDeque(t, d, want)
+		if len(d.buf) > max(4*d.Len(), minCapacity) {
+			t.Errorf("buffer of %d slots holds only %d values", len(d.buf), d.Len())
+		}
+	})
+
+	t.Run("Allocations", func(t *testing.T) {
+		d := NewDeque()
+		for i := 0; i < 100; i++ {
+			d.PushBack("x")
+		}
+		if allocs := testing.AllocsPerRun(100, func() {
+			d.PushFront("y")
+			d.PopBack()
+		}); allocs != 0 {
+			t.Errorf("PushFront() and PopBack() allocate %.1f times", allocs)
+		}
+	})
+
+	t.Run("ModifiedDuringIteration", func(t *testing.T) {
+		d := NewDeque("a", "b")
+		defer func() {
+			if recover() == nil {
+				t.Error("pushing during All() did not panic")
+			}
+		}()
+		for value := range d.All() {
+			d.PushBack(value)
+		}
+	})
+}
+
+func TestDequeFiles(t *testing.T) {
+	values := []string{"", "plain", "two\nlines", `"quoted"`, " padded "}
+	newFilled := func() *Deque {
+		d := NewDeque(values[1:]...)
+		d.PushFront(values[0])
+		return d
+	}
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		dir := t.TempDir()
+		for name, opts := range map[string]persist.EncodeOptions{
+			"Plain":      {},
+			"Checksums":  {RecordChecksums: true},
+			"Compressed": {Compression: persist.CompressionGzip},
+		} {
+			d := newFilled()
+			d.SetEncodeOptions(opts)
+
+			binary := filepath.Join(dir, name+".bin")
+			if err := d.WriteBinary(binary); err != nil {
+				t.Fatalf("%s: WriteBinary() failed: %v", name, err)
+			}
+			loaded := NewDeque("old")
+			if err := loaded.ReadBinary(binary); err != nil {
+				t.Fatalf("%s: ReadBinary() failed: %v", name, err)
+			}
+			checkDeque(t, loaded, values)
+
+			text := filepath.Join(dir, name+".txt")
+			if err := d.WriteText(text); err != nil {
+				t.Fatalf("%s: WriteText() failed: %v", name, err)
+			}
+			loaded = NewDeque("old")
+			if err := loaded.ReadText(text); err != nil {
+				t.Fatalf("%s: ReadText() failed: %v", name, err)
+			}
+			checkDeque(t, loaded, values)
+		}
+	})
+
+	t.Run("SameAsDoubleList", func(t *testing.T) {
+		d := newFilled()
+		dl := doublelist.NewDoubleList(values...)
+
+		var got, want bytes.Buffer
+		if _, err := d.WriteTo(&got); err != nil {
+			t.Fatalf("WriteTo() failed: %v", err)
+		}
+		if _, err := dl.WriteTo(&want); err != nil {
+			t.Fatalf("DoubleList.WriteTo() failed: %v", err)
+		}
+		// Only the container type in the header and so the checksum over it
+		// differ.
+		gotBytes, wantBytes := got.Bytes(), want.Bytes()
+		if gotBytes[5] != byte(persist.TypeDeque) {
+			t.Errorf("header type = %d, want %d", gotBytes[5], persist.TypeDeque)
+		}
+		end := len(wantBytes) - persist.ChecksumSize
+		if len(gotBytes) != len(wantBytes) || !bytes.Equal(gotBytes[6:end], wantBytes[6:end]) {
+			t.Errorf("WriteTo() wrote %x, DoubleList wrote %x", gotBytes, wantBytes)
+		}
+
+		got.Reset()
+		want.Reset()
+		d.WriteTextTo(&got)
+		dl.WriteTextTo(&want)
+		if got.String() != want.String() {
+			t.Errorf("WriteTextTo() wrote %q, DoubleList wrote %q", got.String(), want.String())
+		}
+
+		jsonData, err := d.MarshalJSON()
+		if err != nil {
+			t.Fatalf("MarshalJSON() failed: %v", err)
+		}
+		if dlJSON, _ := dl.MarshalJSON(); !bytes.Equal(jsonData, dlJSON) {
+			t.Errorf("MarshalJSON() = %s, DoubleList gives %s", jsonData, dlJSON)
+		}
+		loaded := NewDeque()
+		if err := loaded.UnmarshalJSON(jsonData); err != nil {
+			t.Fatalf("UnmarshalJSON() failed: %v", err)
+		}
+		checkDeque(t, loaded, values)
+	})
+
+	t.Run("CSV", func(t *testing.T) {
+		// A lone empty value would be a blank line, which CSV skips.
+		d := newFilled()
+		d.PopFront()
+
+		var buf bytes.Buffer
+		opts := persist.CSVOptions{Header: true}
+		if err := d.ExportCSV(&buf, opts); err != nil {
+			t.Fatalf("ExportCSV() failed: %v", err)
+		}
+		loaded := NewDeque()
+		if err := loaded.ImportCSV(&buf, opts); err != nil {
+			t.Fatalf("ImportCSV() failed: %v", err)
+		}
+		checkDeque(t, loaded, values[1:])
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		data, err := newFilled().MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary() failed: %v", err)
+		}
+		loaded := NewDeque("kept")
+		if err := loaded.UnmarshalBinary(data[:len(data)-1]); err == nil {
+			t.Error("UnmarshalBinary() of truncated data succeeded")
+		}
+		var typeErr *persist.TypeError
+		listData, _ := doublelist.NewDoubleList(values...).MarshalBinary()
+		if err := loaded.UnmarshalBinary(listData); !errors.As(err, &typeErr) {
+			t.Errorf("UnmarshalBinary() of a DoubleList = %v, want TypeError", err)
+		}
+		if _, err := loaded.ReadTextFrom(strings.NewReader("2\nonly one\n")); err == nil {
+			t.Error("ReadTextFrom() of a short file succeeded")
+		}
+		if err := loaded.ReadBinary(filepath.Join(t.TempDir(), "missing.bin")); err == nil {
+			t.Error("ReadBinary() of a missing file succeeded")
+		}
+		truncated := filepath.Join(t.TempDir(), "truncated.bin")
+		if err := os.WriteFile(truncated, data[:len(data)-1], 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := loaded.ReadBinary(truncated); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("ReadBinary() of a truncated file = %v, want io.ErrUnexpectedEOF", err)
+		}
+		checkDeque(t, loaded, []string{"kept"})
+	})
+}
+
+func BenchmarkDeque(b *testing.B) {
+	b.Run("Deque", func(b *testing.B) {
+		d := NewDeque()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			d.PushBack("value")
+			d.PushFront("value")
+			d.PopBack()
+			d.PopFront()
+		}
+	})
+	b.Run("DoubleList", func(b *testing.B) {
+		dl := doublelist.NewDoubleList()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			dl.AddTail("value")
+			dl.AddHead("value")
+			dl.DeleteTail()
+			dl.DeleteHead()
+		}
+	})
+}
+
+func TestReaderWriter(t *testing.T) {
+	persisttest.TestContainer(t, persisttest.Fixture[*Deque]{
+		New:      func() *Deque { return NewDeque() },
+		Make:     func(values []string) *Deque { return NewDeque(values...) },
+		Contents: func(d *Deque) any { return slices.Collect(d.All()) },
+	})
+}
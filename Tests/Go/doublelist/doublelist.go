@@ -2,13 +2,14 @@ package doublelist
 
 import (
 	"bufio"
-	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"iter"
 	"os"
-	"strconv"
-	"strings"
+
+	"Go/persist"
 )
 
 type DFNode struct {
@@ -18,9 +19,12 @@ type DFNode struct {
 }
 
 type DoubleList struct {
-	head   *DFNode
-	tail   *DFNode
-	length int
+	head       *DFNode
+	tail       *DFNode
+	length     int
+	version    int
+	encodeOpts persist.EncodeOptions
+	decodeOpts persist.DecodeOptions
 }
 
 func NewDoubleList(items ...string) *DoubleList {
@@ -84,6 +88,7 @@ func (dl *DoubleList) AddAfter(key string, index int) error {
 	current.next = newNode
 
 	dl.length++
+	dl.version++
 	return nil
 }
 
@@ -105,6 +110,7 @@ func (dl *DoubleList) AddHead(key string) error {
 	}
 	dl.head = newNode
 	dl.length++
+	dl.version++
 	return nil
 }
 
@@ -119,6 +125,7 @@ func (dl *DoubleList) AddTail(key string) error {
 	}
 	dl.tail = newNode
 	dl.length++
+	dl.version++
 	return nil
 }
 
@@ -142,6 +149,7 @@ func (dl *DoubleList) DeleteAt(index int) error {
 	toDelete.prev.next = toDelete.next
 	toDelete.next.prev = toDelete.prev
 	dl.length--
+	dl.version++
 	return nil
 }
 
@@ -159,6 +167,7 @@ func (dl *DoubleList) DeleteHead() error {
 		dl.tail = nil
 	}
 	dl.length--
+	dl.version++
 	return nil
 }
 
@@ -176,6 +185,7 @@ func (dl *DoubleList) DeleteTail() error {
 		dl.head = nil
 	}
 	dl.length--
+	dl.version++
 	return nil
 }
 
@@ -235,87 +245,260 @@ func (dl *DoubleList) clear() {
 	dl.head = nil
 	dl.tail = nil
 	dl.length = 0
+	dl.version++
 }
 
-func (dl *DoubleList) WriteBinary(filename string) error {
-	file, err := os.Create(filename)
-	if err != nil {
-		return fmt.Errorf("Не удалось открыть файл для записи: %w", err)
+// WriteTo writes the list in its binary format: the length followed by each
+// key from head to tail.
+func (dl *DoubleList) WriteTo(w io.Writer) (int64, error) {
+	enc := persist.NewEncoder(w)
+	if err := enc.WriteHeader(dl.header()); err != nil {
+		return enc.Len(), err
 	}
-	defer file.Close()
+	return dl.writeBinary(enc)
+}
 
-	if err := binary.Write(file, binary.LittleEndian, uint64(dl.length)); err != nil {
-		return err
+// WriteCppTo writes the list in the layout of the C++
+// DoubleList::writeBinary, which is the headerless layout read by
+// ReadLegacyFrom.
+func (dl *DoubleList) WriteCppTo(w io.Writer) (int64, error) {
+	return dl.writeBinary(persist.NewEncoder(w))
+}
+
+func (dl *DoubleList) writeBinary(enc *persist.Encoder) (int64, error) {
+	if err := enc.Uint64(uint64(dl.length)); err != nil {
+		return enc.Len(), err
 	}
 
 	current := dl.head
 	for current != nil {
-		keyLength := uint64(len(current.key))
-		if err := binary.Write(file, binary.LittleEndian, keyLength); err != nil {
-			return err
+		if err := persist.String64.Encode(enc, current.key); err != nil {
+			return enc.Len(), err
 		}
-		if _, err := file.Write([]byte(current.key)); err != nil {
-			return err
+		if err := enc.EndRecord(); err != nil {
+			return enc.Len(), err
 		}
 		current = current.next
 	}
-	return nil
+	err := enc.Finish()
+	return enc.Len(), err
 }
 
-func (dl *DoubleList) ReadBinary(filename string) error {
-	file, err := os.Open(filename)
-	if err != nil {
-		return fmt.Errorf("Не удалось открыть файл: %w", err)
+// ReadFrom replaces the contents of the list with the binary data in r. The
+// list is left unchanged if the data cannot be decoded.
+func (dl *DoubleList) ReadFrom(r io.Reader) (int64, error) {
+	dec := persist.NewDecoder(r, dl.decodeOpts)
+	if _, err := dec.ExpectHeader(dl.header()); err != nil {
+		return dec.Offset(), err
 	}
-	defer file.Close()
+	return dl.readBinary(dec)
+}
 
-	dl.clear()
+// ReadLegacyFrom is like ReadFrom but reads the headerless format written
+// before the container header was introduced.
+func (dl *DoubleList) ReadLegacyFrom(r io.Reader) (int64, error) {
+	return dl.readBinary(persist.NewDecoder(r, dl.decodeOpts))
+}
 
-	var newLength uint64
-	if err := binary.Read(file, binary.LittleEndian, &newLength); err != nil {
-		return err
+// ReadCppFrom replaces the contents of the list with a file written by the
+// C++ DoubleList::writeBinary.
+func (dl *DoubleList) ReadCppFrom(r io.Reader) (int64, error) {
+	return dl.ReadLegacyFrom(r)
+}
+
+// header describes the binary format written by WriteTo.
+func (dl *DoubleList) header() persist.Header {
+	return persist.Header{Type: persist.TypeDoubleList, Value: persist.EncodingString64, Flags: dl.encodeOpts.Flags()}
+}
+
+// SetEncodeOptions changes the optional parts of the binary format written by
+// WriteTo and WriteBinary. Its Compression also applies to WriteTextTo and
+// WriteText; readers detect compressed files on their own.
+func (dl *DoubleList) SetEncodeOptions(opts persist.EncodeOptions) {
+	dl.encodeOpts = opts
+}
+
+// SetDecodeOptions changes the resource limits enforced by every Read*
+// method. Input that goes over a limit fails with persist.ErrLimitExceeded.
+func (dl *DoubleList) SetDecodeOptions(opts persist.DecodeOptions) {
+	dl.decodeOpts = opts
+}
+
+func (dl *DoubleList) readBinary(dec *persist.Decoder) (int64, error) {
+	newLength, err := dec.Uint64()
+	if err != nil {
+		return dec.Offset(), err
+	}
+	if err := dec.CheckElements(newLength); err != nil {
+		return dec.Offset(), err
 	}
 
+	loaded := NewDoubleList()
 	for i := uint64(0); i < newLength; i++ {
-		var keyLength uint64
-		if err := binary.Read(file, binary.LittleEndian, &keyLength); err != nil {
-			return err
+		key, err := persist.String64.Decode(dec)
+		if err != nil {
+			return dec.Offset(), err
 		}
-
-		keyBytes := make([]byte, keyLength)
-		if _, err := io.ReadFull(file, keyBytes); err != nil {
-			return err
+		if err := dec.EndRecord(); err != nil {
+			return dec.Offset(), err
 		}
+		loaded.AddTail(key)
+	}
 
-		if err := dl.AddTail(string(keyBytes)); err != nil {
-			return err
-		}
+	if err := dec.Finish(); err != nil {
+		return dec.Offset(), err
+	}
+	dl.replace(loaded)
+	return dec.Offset(), nil
+}
+
+func (dl *DoubleList) replace(other *DoubleList) {
+	dl.head = other.head
+	dl.tail = other.tail
+	dl.length = other.length
+	dl.version++
+}
+
+func (dl *DoubleList) MarshalBinary() ([]byte, error) {
+	return persist.MarshalBinary(dl.WriteTo)
+}
+
+func (dl *DoubleList) UnmarshalBinary(data []byte) error {
+	return persist.UnmarshalBinary(data, dl.ReadFrom)
+}
+
+// MarshalJSON encodes the list as a JSON array from head to tail.
+func (dl *DoubleList) MarshalJSON() ([]byte, error) {
+	keys := make([]string, 0, dl.length)
+	for key := range dl.All() {
+		keys = append(keys, key)
 	}
+	return json.Marshal(keys)
+}
+
+// UnmarshalJSON replaces the contents of the list with the strings of a JSON
+// array, head first.
+func (dl *DoubleList) UnmarshalJSON(data []byte) error {
+	var keys []string
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return err
+	}
+	dl.replace(NewDoubleList(keys...))
 	return nil
 }
 
-func (dl *DoubleList) WriteText(filename string) error {
-	file, err := os.Create(filename)
+func (dl *DoubleList) WriteBinary(filename string) error {
+	return persist.WriteFile(filename, dl.WriteTo)
+}
+
+func (dl *DoubleList) ReadBinary(filename string) error {
+	file, err := os.Open(filename)
 	if err != nil {
-		return fmt.Errorf("Не удалось открыть файл для записи: %w", err)
+		return fmt.Errorf("Не удалось открыть файл: %w", err)
 	}
 	defer file.Close()
 
-	writer := bufio.NewWriter(file)
-	defer writer.Flush()
+	_, err = dl.ReadFrom(bufio.NewReader(file))
+	return err
+}
 
-	if _, err := fmt.Fprintf(writer, "%d\n", dl.length); err != nil {
-		return err
+// ReadBinaryLegacy reads a file written before the container header was
+// introduced.
+func (dl *DoubleList) ReadBinaryLegacy(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("Не удалось открыть файл: %w", err)
+	}
+	defer file.Close()
+
+	_, err = dl.ReadLegacyFrom(bufio.NewReader(file))
+	return err
+}
+
+// WriteTextTo writes the length and then one key per line. Keys that
+// cannot be written verbatim are quoted with persist.QuoteLine.
+func (dl *DoubleList) WriteTextTo(w io.Writer) (int64, error) {
+	enc := persist.NewEncoder(w)
+	if err := enc.CompressText(dl.encodeOpts); err != nil {
+		return enc.Len(), err
+	}
+	return dl.writeText(enc, persist.QuotedLines)
+}
+
+// WriteCppTextTo writes the list in the format of the C++
+// DoubleList::writeText. Keys containing a newline cannot be written.
+func (dl *DoubleList) WriteCppTextTo(w io.Writer) (int64, error) {
+	return dl.writeText(persist.NewEncoder(w), persist.CppLines)
+}
+
+func (dl *DoubleList) writeText(enc *persist.Encoder, format persist.LineFormat) (int64, error) {
+	if _, err := fmt.Fprintf(enc, "%d\n", dl.length); err != nil {
+		return enc.Len(), err
 	}
 
 	current := dl.head
 	for current != nil {
-		if _, err := fmt.Fprintln(writer, current.key); err != nil {
-			return err
+		line, err := format.Quote(current.key)
+		if err != nil {
+			return enc.Len(), err
+		}
+		if _, err := fmt.Fprintln(enc, line); err != nil {
+			return enc.Len(), err
 		}
 		current = current.next
 	}
-	return nil
+	err := enc.Finish()
+	return enc.Len(), err
+}
+
+// ReadTextFrom replaces the contents of the list with the text data in r.
+func (dl *DoubleList) ReadTextFrom(r io.Reader) (int64, error) {
+	dec := persist.NewDecoder(r, dl.decodeOpts)
+	if err := dec.DetectCompression(); err != nil {
+		return dec.Offset(), err
+	}
+	return dl.readText(dec, persist.QuotedLines)
+}
+
+// ReadCppTextFrom replaces the contents of the list with a file written by
+// the C++ DoubleList::writeText.
+func (dl *DoubleList) ReadCppTextFrom(r io.Reader) (int64, error) {
+	return dl.readText(persist.NewDecoder(r, dl.decodeOpts), persist.CppLines)
+}
+
+func (dl *DoubleList) readText(dec *persist.Decoder, format persist.LineFormat) (int64, error) {
+	lines := persist.NewLineReader(dec)
+	if !lines.Scan() {
+		return dec.Offset(), persist.ScanFailure(lines, io.EOF)
+	}
+
+	newLength, err := dec.ParseCount(lines.Text())
+	if err != nil {
+		return dec.Offset(), err
+	}
+
+	loaded := NewDoubleList()
+	for i := 0; i < newLength; i++ {
+		if !lines.Scan() {
+			return dec.Offset(), persist.ScanFailure(lines, errors.New("unexpected EOF in file"))
+		}
+		key, err := format.Unquote(lines.Text())
+		if err != nil {
+			return dec.Offset(), fmt.Errorf("invalid key on line %d: %w", i+2, err)
+		}
+		loaded.AddTail(key)
+	}
+
+	if err := dec.FinishText(lines); err != nil {
+		return dec.Offset(), err
+	}
+
+	dl.replace(loaded)
+	return dec.Offset(), nil
+}
+
+func (dl *DoubleList) WriteText(filename string) error {
+	return persist.WriteFile(filename, dl.WriteTextTo)
 }
 
 func (dl *DoubleList) ReadText(filename string) error {
@@ -325,29 +508,72 @@ func (dl *DoubleList) ReadText(filename string) error {
 	}
 	defer file.Close()
 
-	dl.clear()
+	_, err = dl.ReadTextFrom(file)
+	return err
+}
 
-	scanner := bufio.NewScanner(file)
-	if !scanner.Scan() {
-		return io.EOF
+// ExportCSV writes the keys to w as a one-column CSV file, from head to tail.
+func (dl *DoubleList) ExportCSV(w io.Writer, opts persist.CSVOptions) error {
+	cw := persist.NewCSVWriter(w, opts)
+	if opts.Header {
+		if err := cw.Write([]string{"key"}); err != nil {
+			return err
+		}
 	}
+	for key := range dl.All() {
+		if err := cw.Write([]string{key}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
 
-	lengthStr := strings.TrimSpace(scanner.Text())
-	newLength, err := strconv.Atoi(lengthStr)
+// ImportCSV replaces the contents of the list with column opts.Column of the
+// CSV file in r.
+func (dl *DoubleList) ImportCSV(r io.Reader, opts persist.CSVOptions) error {
+	dec := persist.NewDecoder(r, dl.decodeOpts)
+	loaded := NewDoubleList()
+	err := persist.ReadCSV(dec, opts, opts.Column+1, func(record []string) error {
+		loaded.AddTail(record[opts.Column])
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("invalid length line: %w", err)
+		return err
 	}
+	dl.replace(loaded)
+	return nil
+}
 
-	for i := 0; i < newLength; i++ {
-		if !scanner.Scan() {
-			return errors.New("unexpected EOF in file")
+// All yields the keys from head to tail. Adding or deleting elements while
+// iterating panics.
+func (dl *DoubleList) All() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		version := dl.version
+		for current := dl.head; current != nil; current = current.next {
+			if !yield(current.key) {
+				return
+			}
+			if dl.version != version {
+				panic("doublelist: list modified during iteration")
+			}
 		}
-		key := scanner.Text()
-		if err := dl.AddTail(key); err != nil {
-			return err
+	}
+}
+
+// Backward yields the keys from tail to head.
+func (dl *DoubleList) Backward() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		version := dl.version
+		for current := dl.tail; current != nil; current = current.prev {
+			if !yield(current.key) {
+				return
+			}
+			if dl.version != version {
+				panic("doublelist: list modified during iteration")
+			}
 		}
 	}
-	return nil
 }
 
 func (dl *DoubleList) Print() {
@@ -2,11 +2,20 @@ package doublelist
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
 	"os"
 	"path/filepath"
 	"encoding/binary"
+	"reflect"
+	"slices"
 	"strconv"
+	"strings"
 	"testing"
+
+	"Go/persist"
+	"Go/persist/persisttest"
 )
 
 func captureOutput(f func()) string {
@@ -773,4 +782,170 @@ func TestOutput(t *testing.T) {
 			})
 		}
 	})
-}
\ No newline at end of file
+}
+
+func TestIterators(t *testing.T) {
+	dl := NewDoubleList("a", "b", "c")
+
+	if got := slices.Collect(dl.All()); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Errorf("All() = %v", got)
+	}
+	if got := slices.Collect(dl.Backward()); !reflect.DeepEqual(got, []string{"c", "b", "a"}) {
+		t.Errorf("Backward() = %v", got)
+	}
+	if got := slices.Collect(NewDoubleList().All()); len(got) != 0 {
+		t.Errorf("All() on empty list = %v", got)
+	}
+
+	var visited []string
+	for v := range dl.Backward() {
+		visited = append(visited, v)
+		if v == "b" {
+			break
+		}
+	}
+	if !reflect.DeepEqual(visited, []string{"c", "b"}) {
+		t.Errorf("Backward() with break = %v", visited)
+	}
+
+	mutations := map[string]func(dl *DoubleList){
+		"AddHead":       func(dl *DoubleList) { dl.AddHead("x") },
+		"AddTail":       func(dl *DoubleList) { dl.AddTail("x") },
+		"AddAfter":      func(dl *DoubleList) { dl.AddAfter("x", 0) },
+		"DeleteAt":      func(dl *DoubleList) { dl.DeleteAt(1) },
+		"DeleteHead":    func(dl *DoubleList) { dl.DeleteHead() },
+		"DeleteTail":    func(dl *DoubleList) { dl.DeleteTail() },
+		"DeleteByValue": func(dl *DoubleList) { dl.DeleteByValue("b") },
+	}
+	for name, mutate := range mutations {
+		t.Run(name, func(t *testing.T) {
+			dl := NewDoubleList("a", "b", "c")
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s during iteration did not panic", name)
+				}
+			}()
+			for range dl.All() {
+				mutate(dl)
+			}
+		})
+	}
+}
+
+func TestReaderWriter(t *testing.T) {
+	persisttest.TestContainer(t, persisttest.Fixture[*DoubleList]{
+		New:      func() *DoubleList { return NewDoubleList() },
+		Make:     func(values []string) *DoubleList { return NewDoubleList(values...) },
+		Contents: func(dl *DoubleList) any { return slices.Collect(dl.All()) },
+	})
+}
+
+func TestJSON(t *testing.T) {
+	dl := NewDoubleList("a", "b c", "")
+	data, err := json.Marshal(dl)
+	if err != nil {
+		t.Fatalf("json.Marshal() failed: %v", err)
+	}
+	if string(data) != `["a","b c",""]` {
+		t.Errorf("json.Marshal() = %s", data)
+	}
+
+	loaded := NewDoubleList("old")
+	if err := json.Unmarshal(data, loaded); err != nil {
+		t.Fatalf("json.Unmarshal() failed: %v", err)
+	}
+	if got := slices.Collect(loaded.Backward()); !reflect.DeepEqual(got, []string{"", "b c", "a"}) {
+		t.Errorf("json.Unmarshal() loaded %q backwards", got)
+	}
+
+	if data, _ := json.Marshal(NewDoubleList()); string(data) != "[]" {
+		t.Errorf("json.Marshal() of empty list = %s, want []", data)
+	}
+	if err := json.Unmarshal([]byte(`{"a":1}`), loaded); err == nil {
+		t.Error("json.Unmarshal() of an object returned nil error")
+	}
+}
+
+func TestCSV(t *testing.T) {
+	original := NewDoubleList()
+	for _, key := range []string{"a", "b,c", "d \"e\"", "f\ng"} {
+		original.AddTail(key)
+	}
+	var buf bytes.Buffer
+	if err := original.ExportCSV(&buf, persist.CSVOptions{}); err != nil {
+		t.Fatalf("ExportCSV() failed: %v", err)
+	}
+	if want := "a\n\"b,c\"\n\"d \"\"e\"\"\"\n\"f\ng\"\n"; buf.String() != want {
+		t.Errorf("ExportCSV() wrote %q, want %q", buf.String(), want)
+	}
+
+	loaded := NewDoubleList()
+	if err := loaded.ImportCSV(&buf, persist.CSVOptions{}); err != nil {
+		t.Fatalf("ImportCSV() failed: %v", err)
+	}
+	if got, want := slices.Collect(loaded.All()), slices.Collect(original.All()); !reflect.DeepEqual(got, want) {
+		t.Errorf("ImportCSV() loaded %q, want %q", got, want)
+	}
+
+	input := "id;name\n1;x\n2;y\n"
+	if err := loaded.ImportCSV(strings.NewReader(input), persist.CSVOptions{Header: true, Column: 1, Comma: ';'}); err != nil {
+		t.Fatalf("ImportCSV() of column 1 failed: %v", err)
+	}
+	if got := slices.Collect(loaded.All()); !reflect.DeepEqual(got, []string{"x", "y"}) {
+		t.Errorf("ImportCSV() of column 1 loaded %q", got)
+	}
+
+	var rowErr *persist.RowError
+	err := loaded.ImportCSV(strings.NewReader("1,a\n2,b\n3\n"), persist.CSVOptions{Column: 1})
+	if !errors.As(err, &rowErr) || rowErr.Row != 3 {
+		t.Errorf("ImportCSV() of a short row = %v, want an error for row 3", err)
+	}
+	if got := slices.Collect(loaded.All()); !reflect.DeepEqual(got, []string{"x", "y"}) {
+		t.Errorf("failed ImportCSV() changed the list to %q", got)
+	}
+}
+
+// TestCppGolden checks the C++ formats against files written by the C++
+// DoubleList; see Serialization/C++/Golden.
+func TestCppGolden(t *testing.T) {
+	want := []string{"alpha", "b c", "юникод"}
+	tests := []struct {
+		file  string
+		write func(*DoubleList, io.Writer) (int64, error)
+		read  func(*DoubleList, io.Reader) (int64, error)
+	}{
+		{"doublelist.bin", (*DoubleList).WriteCppTo, (*DoubleList).ReadCppFrom},
+		{"doublelist.txt", (*DoubleList).WriteCppTextTo, (*DoubleList).ReadCppTextFrom},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			golden, err := os.ReadFile(filepath.Join("testdata", "cpp", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			loaded := NewDoubleList()
+			if _, err := tt.read(loaded, bytes.NewReader(golden)); err != nil {
+				t.Fatalf("reading the C++ file failed: %v", err)
+			}
+			if got := slices.Collect(loaded.All()); !reflect.DeepEqual(got, want) {
+				t.Errorf("read %q, want %q", got, want)
+			}
+
+			original := func() *DoubleList {
+		dl := NewDoubleList()
+		for _, key := range want {
+			dl.AddTail(key)
+		}
+		return dl
+	}()
+			var buf bytes.Buffer
+			if _, err := tt.write(original, &buf); err != nil {
+				t.Fatalf("writing the C++ format failed: %v", err)
+			}
+			if !bytes.Equal(buf.Bytes(), golden) {
+				t.Errorf("wrote\n%q\nwant\n%q", buf.Bytes(), golden)
+			}
+		})
+	}
+}
@@ -2,11 +2,14 @@ package forwardlist
 
 import (
 	"bufio"
-	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"iter"
 	"os"
-	"strconv"
+
+	"Go/persist"
 )
 
 type node struct {
@@ -15,9 +18,12 @@ type node struct {
 }
 
 type ForwardList struct {
-	head *node
-	tail *node
-	size int
+	head       *node
+	tail       *node
+	size       int
+	version    int
+	encodeOpts persist.EncodeOptions
+	decodeOpts persist.DecodeOptions
 }
 
 func NewForwardList(items ...string) *ForwardList {
@@ -60,6 +66,7 @@ func (fl *ForwardList) PushBack(key string) {
 		fl.tail = newNode
 	}
 	fl.size++
+	fl.version++
 }
 
 func (fl *ForwardList) PushFront(key string) {
@@ -69,6 +76,7 @@ func (fl *ForwardList) PushFront(key string) {
 	}
 	fl.head = newNode
 	fl.size++
+	fl.version++
 }
 
 func (fl *ForwardList) InsertBefore(key string, position int) error {
@@ -89,6 +97,7 @@ func (fl *ForwardList) InsertBefore(key string, position int) error {
 		fl.tail = newNode
 	}
 	fl.size++
+	fl.version++
 	return nil
 }
 
@@ -107,6 +116,7 @@ func (fl *ForwardList) InsertAfter(key string, position int) error {
 	newNode := &node{key: key, next: current.next}
 	current.next = newNode
 	fl.size++
+	fl.version++
 	return nil
 }
 
@@ -119,6 +129,7 @@ func (fl *ForwardList) PopFront() error {
 		fl.tail = nil
 	}
 	fl.size--
+	fl.version++
 	return nil
 }
 
@@ -130,6 +141,7 @@ func (fl *ForwardList) PopBack() error {
 		fl.head = nil
 		fl.tail = nil
 		fl.size = 0
+		fl.version++
 		return nil
 	}
 	current := fl.head
@@ -139,6 +151,7 @@ func (fl *ForwardList) PopBack() error {
 	current.next = nil
 	fl.tail = current
 	fl.size--
+	fl.version++
 	return nil
 }
 
@@ -161,6 +174,7 @@ func (fl *ForwardList) RemoveByValue(value string) bool {
 			fl.tail = prev
 		}
 		fl.size--
+		fl.version++
 		return true
 	}
 	return false
@@ -200,80 +214,259 @@ func (fl *ForwardList) Clear() {
 	fl.head = nil
 	fl.tail = nil
 	fl.size = 0
+	fl.version++
 }
 
-func (fl *ForwardList) WriteBinary(filename string) error {
-	file, err := os.Create(filename)
-	if err != nil {
-		return fmt.Errorf("failed to open file for writing: %w", err)
+// WriteTo writes the list in its binary format: the size followed by each
+// key from front to back.
+func (fl *ForwardList) WriteTo(w io.Writer) (int64, error) {
+	enc := persist.NewEncoder(w)
+	if err := enc.WriteHeader(fl.header()); err != nil {
+		return enc.Len(), err
 	}
-	defer file.Close()
+	return fl.writeBinary(enc)
+}
+
+// WriteCppTo writes the list in the layout of the C++
+// ForwardList::writeBinary, which is the headerless layout read by
+// ReadLegacyFrom.
+func (fl *ForwardList) WriteCppTo(w io.Writer) (int64, error) {
+	return fl.writeBinary(persist.NewEncoder(w))
+}
 
-	if err := binary.Write(file, binary.LittleEndian, uint64(fl.size)); err != nil {
-		return fmt.Errorf("failed to write size: %w", err)
+func (fl *ForwardList) writeBinary(enc *persist.Encoder) (int64, error) {
+	if err := enc.Uint64(uint64(fl.size)); err != nil {
+		return enc.Len(), fmt.Errorf("failed to write size: %w", err)
 	}
 
 	current := fl.head
 	for current != nil {
-		keyLength := uint64(len(current.key))
-		if err := binary.Write(file, binary.LittleEndian, keyLength); err != nil {
-			return fmt.Errorf("failed to write key length: %w", err)
+		if err := persist.String64.Encode(enc, current.key); err != nil {
+			return enc.Len(), fmt.Errorf("failed to write key: %w", err)
 		}
-		if _, err := file.Write([]byte(current.key)); err != nil {
-			return fmt.Errorf("failed to write key: %w", err)
+		if err := enc.EndRecord(); err != nil {
+			return enc.Len(), err
 		}
 		current = current.next
 	}
-	return nil
+	err := enc.Finish()
+	return enc.Len(), err
 }
 
-func (fl *ForwardList) ReadBinary(filename string) error {
-	file, err := os.Open(filename)
-	if err != nil {
-		return fmt.Errorf("failed to open file: %w", err)
+// ReadFrom replaces the contents of the list with the binary data in r. The
+// list is left unchanged if the data cannot be decoded.
+func (fl *ForwardList) ReadFrom(r io.Reader) (int64, error) {
+	dec := persist.NewDecoder(r, fl.decodeOpts)
+	if _, err := dec.ExpectHeader(fl.header()); err != nil {
+		return dec.Offset(), err
 	}
-	defer file.Close()
+	return fl.readBinary(dec)
+}
+
+// ReadLegacyFrom is like ReadFrom but reads the headerless format written
+// before the container header was introduced.
+func (fl *ForwardList) ReadLegacyFrom(r io.Reader) (int64, error) {
+	return fl.readBinary(persist.NewDecoder(r, fl.decodeOpts))
+}
+
+// ReadCppFrom replaces the contents of the list with a file written by the
+// C++ ForwardList::writeBinary.
+func (fl *ForwardList) ReadCppFrom(r io.Reader) (int64, error) {
+	return fl.ReadLegacyFrom(r)
+}
+
+// header describes the binary format written by WriteTo.
+func (fl *ForwardList) header() persist.Header {
+	return persist.Header{Type: persist.TypeForwardList, Value: persist.EncodingString64, Flags: fl.encodeOpts.Flags()}
+}
+
+// SetEncodeOptions changes the optional parts of the binary format written by
+// WriteTo and WriteBinary. Its Compression also applies to WriteTextTo and
+// WriteText; readers detect compressed files on their own.
+func (fl *ForwardList) SetEncodeOptions(opts persist.EncodeOptions) {
+	fl.encodeOpts = opts
+}
 
-	fl.Clear()
+// SetDecodeOptions changes the resource limits enforced by every Read*
+// method. Input that goes over a limit fails with persist.ErrLimitExceeded.
+func (fl *ForwardList) SetDecodeOptions(opts persist.DecodeOptions) {
+	fl.decodeOpts = opts
+}
 
-	var size uint64
-	if err := binary.Read(file, binary.LittleEndian, &size); err != nil {
-		return fmt.Errorf("failed to read size: %w", err)
+func (fl *ForwardList) readBinary(dec *persist.Decoder) (int64, error) {
+	size, err := dec.Uint64()
+	if err != nil {
+		return dec.Offset(), fmt.Errorf("failed to read size: %w", err)
+	}
+	if err := dec.CheckElements(size); err != nil {
+		return dec.Offset(), err
 	}
 
+	loaded := NewForwardList()
 	for i := uint64(0); i < size; i++ {
-		var keyLength uint64
-		if err := binary.Read(file, binary.LittleEndian, &keyLength); err != nil {
-			return fmt.Errorf("failed to read key length: %w", err)
+		key, err := persist.String64.Decode(dec)
+		if err != nil {
+			return dec.Offset(), fmt.Errorf("failed to read key: %w", err)
 		}
-		keyBytes := make([]byte, keyLength)
-		if _, err := file.Read(keyBytes); err != nil {
-			return fmt.Errorf("failed to read key: %w", err)
+		if err := dec.EndRecord(); err != nil {
+			return dec.Offset(), err
 		}
-		fl.PushBack(string(keyBytes))
+		loaded.PushBack(key)
 	}
+
+	if err := dec.Finish(); err != nil {
+		return dec.Offset(), err
+	}
+	fl.replace(loaded)
+	return dec.Offset(), nil
+}
+
+func (fl *ForwardList) replace(other *ForwardList) {
+	fl.head = other.head
+	fl.tail = other.tail
+	fl.size = other.size
+	fl.version++
+}
+
+func (fl *ForwardList) MarshalBinary() ([]byte, error) {
+	return persist.MarshalBinary(fl.WriteTo)
+}
+
+func (fl *ForwardList) UnmarshalBinary(data []byte) error {
+	return persist.UnmarshalBinary(data, fl.ReadFrom)
+}
+
+// MarshalJSON encodes the list as a JSON array from front to back.
+func (fl *ForwardList) MarshalJSON() ([]byte, error) {
+	keys := make([]string, 0, fl.size)
+	for key := range fl.All() {
+		keys = append(keys, key)
+	}
+	return json.Marshal(keys)
+}
+
+// UnmarshalJSON replaces the contents of the list with the strings of a JSON
+// array, front first.
+func (fl *ForwardList) UnmarshalJSON(data []byte) error {
+	var keys []string
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return err
+	}
+	fl.replace(NewForwardList(keys...))
 	return nil
 }
 
-func (fl *ForwardList) WriteText(filename string) error {
-	file, err := os.Create(filename)
+func (fl *ForwardList) WriteBinary(filename string) error {
+	return persist.WriteFile(filename, fl.WriteTo)
+}
+
+func (fl *ForwardList) ReadBinary(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	_, err = fl.ReadFrom(bufio.NewReader(file))
+	return err
+}
+
+// ReadBinaryLegacy reads a file written before the container header was
+// introduced.
+func (fl *ForwardList) ReadBinaryLegacy(filename string) error {
+	file, err := os.Open(filename)
 	if err != nil {
-		return fmt.Errorf("failed to open file for writing: %w", err)
+		return fmt.Errorf("failed to open file: %w", err)
 	}
 	defer file.Close()
 
-	if _, err := fmt.Fprintf(file, "%d\n", fl.size); err != nil {
-		return fmt.Errorf("failed to write size: %w", err)
+	_, err = fl.ReadLegacyFrom(bufio.NewReader(file))
+	return err
+}
+
+// WriteTextTo writes the size and then one key per line. Keys that cannot
+// be written verbatim are quoted with persist.QuoteLine.
+func (fl *ForwardList) WriteTextTo(w io.Writer) (int64, error) {
+	enc := persist.NewEncoder(w)
+	if err := enc.CompressText(fl.encodeOpts); err != nil {
+		return enc.Len(), err
+	}
+	return fl.writeText(enc, persist.QuotedLines)
+}
+
+// WriteCppTextTo writes the list in the format of the C++
+// ForwardList::writeText. Keys containing a newline cannot be written.
+func (fl *ForwardList) WriteCppTextTo(w io.Writer) (int64, error) {
+	return fl.writeText(persist.NewEncoder(w), persist.CppLines)
+}
+
+func (fl *ForwardList) writeText(enc *persist.Encoder, format persist.LineFormat) (int64, error) {
+	if _, err := fmt.Fprintf(enc, "%d\n", fl.size); err != nil {
+		return enc.Len(), fmt.Errorf("failed to write size: %w", err)
 	}
 
 	current := fl.head
 	for current != nil {
-		if _, err := fmt.Fprintln(file, current.key); err != nil {
-			return fmt.Errorf("failed to write element: %w", err)
+		line, err := format.Quote(current.key)
+		if err != nil {
+			return enc.Len(), err
+		}
+		if _, err := fmt.Fprintln(enc, line); err != nil {
+			return enc.Len(), fmt.Errorf("failed to write element: %w", err)
 		}
 		current = current.next
 	}
-	return nil
+	err := enc.Finish()
+	return enc.Len(), err
+}
+
+// ReadTextFrom replaces the contents of the list with the text data in r.
+func (fl *ForwardList) ReadTextFrom(r io.Reader) (int64, error) {
+	dec := persist.NewDecoder(r, fl.decodeOpts)
+	if err := dec.DetectCompression(); err != nil {
+		return dec.Offset(), err
+	}
+	return fl.readText(dec, persist.QuotedLines)
+}
+
+// ReadCppTextFrom replaces the contents of the list with a file written by
+// the C++ ForwardList::writeText.
+func (fl *ForwardList) ReadCppTextFrom(r io.Reader) (int64, error) {
+	return fl.readText(persist.NewDecoder(r, fl.decodeOpts), persist.CppLines)
+}
+
+func (fl *ForwardList) readText(dec *persist.Decoder, format persist.LineFormat) (int64, error) {
+	lines := persist.NewLineReader(dec)
+	if !lines.Scan() {
+		return dec.Offset(), persist.ScanFailure(lines, errors.New("file is empty"))
+	}
+	size, err := dec.ParseCount(lines.Text())
+	if err != nil {
+		return dec.Offset(), err
+	}
+
+	loaded := NewForwardList()
+	for i := 0; i < size; i++ {
+		if !lines.Scan() {
+			return dec.Offset(), persist.ScanFailure(lines, errors.New("unexpected end of file"))
+		}
+		key, err := format.Unquote(lines.Text())
+		if err != nil {
+			return dec.Offset(), fmt.Errorf("invalid key on line %d: %w", i+2, err)
+		}
+		loaded.PushBack(key)
+	}
+
+	if err := dec.FinishText(lines); err != nil {
+		return dec.Offset(), fmt.Errorf("error reading file: %w", err)
+	}
+
+	fl.replace(loaded)
+	return dec.Offset(), nil
+}
+
+func (fl *ForwardList) WriteText(filename string) error {
+	return persist.WriteFile(filename, fl.WriteTextTo)
 }
 
 func (fl *ForwardList) ReadText(filename string) error {
@@ -283,29 +476,77 @@ func (fl *ForwardList) ReadText(filename string) error {
 	}
 	defer file.Close()
 
-	fl.Clear()
+	_, err = fl.ReadTextFrom(file)
+	return err
+}
 
-	scanner := bufio.NewScanner(file)
-	if !scanner.Scan() {
-		return errors.New("file is empty")
+// ExportCSV writes the keys to w as a one-column CSV file, from front to back.
+func (fl *ForwardList) ExportCSV(w io.Writer, opts persist.CSVOptions) error {
+	cw := persist.NewCSVWriter(w, opts)
+	if opts.Header {
+		if err := cw.Write([]string{"key"}); err != nil {
+			return err
+		}
 	}
-	sizeStr := scanner.Text()
-	size, err := strconv.Atoi(sizeStr)
+	for key := range fl.All() {
+		if err := cw.Write([]string{key}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ImportCSV replaces the contents of the list with column opts.Column of the
+// CSV file in r.
+func (fl *ForwardList) ImportCSV(r io.Reader, opts persist.CSVOptions) error {
+	dec := persist.NewDecoder(r, fl.decodeOpts)
+	loaded := NewForwardList()
+	err := persist.ReadCSV(dec, opts, opts.Column+1, func(record []string) error {
+		loaded.PushBack(record[opts.Column])
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("invalid size format: %w", err)
+		return err
 	}
+	fl.replace(loaded)
+	return nil
+}
 
-	for i := 0; i < size; i++ {
-		if !scanner.Scan() {
-			return errors.New("unexpected end of file")
+// All yields the keys from front to back. Adding or removing elements while
+// iterating panics.
+func (fl *ForwardList) All() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		version := fl.version
+		for current := fl.head; current != nil; current = current.next {
+			if !yield(current.key) {
+				return
+			}
+			if fl.version != version {
+				panic("forwardlist: list modified during iteration")
+			}
 		}
-		fl.PushBack(scanner.Text())
 	}
+}
 
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("error reading file: %w", err)
+// Backward yields the keys from back to front. The list has no back links,
+// so the keys are copied before the first one is yielded.
+func (fl *ForwardList) Backward() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		version := fl.version
+		keys := make([]string, 0, fl.size)
+		for current := fl.head; current != nil; current = current.next {
+			keys = append(keys, current.key)
+		}
+		for i := len(keys) - 1; i >= 0; i-- {
+			if !yield(keys[i]) {
+				return
+			}
+			if fl.version != version {
+				panic("forwardlist: list modified during iteration")
+			}
+		}
 	}
-	return nil
 }
 
 func (fl *ForwardList) Print() {
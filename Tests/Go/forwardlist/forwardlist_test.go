@@ -2,11 +2,20 @@ package forwardlist
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
 	"strconv"
+	"strings"
 	"testing"
 	"encoding/binary"
+
+	"Go/persist"
+	"Go/persist/persisttest"
 )
 
 func captureOutput(f func()) string {
@@ -787,4 +796,174 @@ func TestErrorConditions(t *testing.T) {
 			t.Errorf("Head after InsertBefore at start = %s, want 'a'", fl.head.key)
 		}
 	})
-}
\ No newline at end of file
+}
+
+func TestIterators(t *testing.T) {
+	fl := NewForwardList("a", "b", "c")
+
+	if got := slices.Collect(fl.All()); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Errorf("All() = %v", got)
+	}
+	if got := slices.Collect(fl.Backward()); !reflect.DeepEqual(got, []string{"c", "b", "a"}) {
+		t.Errorf("Backward() = %v", got)
+	}
+	if got := slices.Collect(NewForwardList().Backward()); len(got) != 0 {
+		t.Errorf("Backward() on empty list = %v", got)
+	}
+
+	for v := range fl.All() {
+		if v != "a" {
+			t.Errorf("All() with break yielded %q first", v)
+		}
+		break
+	}
+	for v := range fl.Backward() {
+		if v != "c" {
+			t.Errorf("Backward() with break yielded %q first", v)
+		}
+		break
+	}
+
+	mutations := map[string]func(fl *ForwardList){
+		"PushBack":      func(fl *ForwardList) { fl.PushBack("x") },
+		"PushFront":     func(fl *ForwardList) { fl.PushFront("x") },
+		"InsertBefore":  func(fl *ForwardList) { fl.InsertBefore("x", 1) },
+		"InsertAfter":   func(fl *ForwardList) { fl.InsertAfter("x", 0) },
+		"PopFront":      func(fl *ForwardList) { fl.PopFront() },
+		"PopBack":       func(fl *ForwardList) { fl.PopBack() },
+		"RemoveByValue": func(fl *ForwardList) { fl.RemoveByValue("b") },
+		"Clear":         func(fl *ForwardList) { fl.Clear() },
+	}
+	for name, mutate := range mutations {
+		for _, backward := range []bool{false, true} {
+			t.Run(name, func(t *testing.T) {
+				fl := NewForwardList("a", "b", "c")
+				seq := fl.All()
+				if backward {
+					seq = fl.Backward()
+				}
+				defer func() {
+					if recover() == nil {
+						t.Errorf("%s during iteration did not panic", name)
+					}
+				}()
+				for range seq {
+					mutate(fl)
+				}
+			})
+		}
+	}
+}
+
+func TestReaderWriter(t *testing.T) {
+	persisttest.TestContainer(t, persisttest.Fixture[*ForwardList]{
+		New:      func() *ForwardList { return NewForwardList() },
+		Make:     func(values []string) *ForwardList { return NewForwardList(values...) },
+		Contents: func(fl *ForwardList) any { return slices.Collect(fl.All()) },
+	})
+}
+
+func TestJSON(t *testing.T) {
+	fl := NewForwardList("a", "b c", "")
+	data, err := json.Marshal(fl)
+	if err != nil {
+		t.Fatalf("json.Marshal() failed: %v", err)
+	}
+	if string(data) != `["a","b c",""]` {
+		t.Errorf("json.Marshal() = %s", data)
+	}
+
+	loaded := NewForwardList("old")
+	if err := json.Unmarshal(data, loaded); err != nil {
+		t.Fatalf("json.Unmarshal() failed: %v", err)
+	}
+	if got := slices.Collect(loaded.All()); !reflect.DeepEqual(got, []string{"a", "b c", ""}) {
+		t.Errorf("json.Unmarshal() loaded %q", got)
+	}
+	loaded.PushBack("tail")
+	if loaded.tail.key != "tail" || loaded.size != 4 {
+		t.Error("list loaded from JSON has a stale tail or size")
+	}
+
+	if data, _ := json.Marshal(NewForwardList()); string(data) != "[]" {
+		t.Errorf("json.Marshal() of empty list = %s, want []", data)
+	}
+	if err := json.Unmarshal([]byte(`[1]`), loaded); err == nil {
+		t.Error("json.Unmarshal() of a number returned nil error")
+	}
+}
+
+func TestCSV(t *testing.T) {
+	original := NewForwardList("a", "b,c", "d \"e\"", "f\ng")
+	var buf bytes.Buffer
+	if err := original.ExportCSV(&buf, persist.CSVOptions{}); err != nil {
+		t.Fatalf("ExportCSV() failed: %v", err)
+	}
+	if want := "a\n\"b,c\"\n\"d \"\"e\"\"\"\n\"f\ng\"\n"; buf.String() != want {
+		t.Errorf("ExportCSV() wrote %q, want %q", buf.String(), want)
+	}
+
+	loaded := NewForwardList()
+	if err := loaded.ImportCSV(&buf, persist.CSVOptions{}); err != nil {
+		t.Fatalf("ImportCSV() failed: %v", err)
+	}
+	if got, want := slices.Collect(loaded.All()), slices.Collect(original.All()); !reflect.DeepEqual(got, want) {
+		t.Errorf("ImportCSV() loaded %q, want %q", got, want)
+	}
+
+	input := "id;name\n1;x\n2;y\n"
+	if err := loaded.ImportCSV(strings.NewReader(input), persist.CSVOptions{Header: true, Column: 1, Comma: ';'}); err != nil {
+		t.Fatalf("ImportCSV() of column 1 failed: %v", err)
+	}
+	if got := slices.Collect(loaded.All()); !reflect.DeepEqual(got, []string{"x", "y"}) {
+		t.Errorf("ImportCSV() of column 1 loaded %q", got)
+	}
+
+	var rowErr *persist.RowError
+	err := loaded.ImportCSV(strings.NewReader("1,a\n2,b\n3\n"), persist.CSVOptions{Column: 1})
+	if !errors.As(err, &rowErr) || rowErr.Row != 3 {
+		t.Errorf("ImportCSV() of a short row = %v, want an error for row 3", err)
+	}
+	if got := slices.Collect(loaded.All()); !reflect.DeepEqual(got, []string{"x", "y"}) {
+		t.Errorf("failed ImportCSV() changed the list to %q", got)
+	}
+}
+
+// TestCppGolden checks the C++ formats against files written by the C++
+// ForwardList; see Serialization/C++/Golden.
+func TestCppGolden(t *testing.T) {
+	want := []string{"alpha", "b c", "юникод"}
+	tests := []struct {
+		file  string
+		write func(*ForwardList, io.Writer) (int64, error)
+		read  func(*ForwardList, io.Reader) (int64, error)
+	}{
+		{"forwardlist.bin", (*ForwardList).WriteCppTo, (*ForwardList).ReadCppFrom},
+		{"forwardlist.txt", (*ForwardList).WriteCppTextTo, (*ForwardList).ReadCppTextFrom},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			golden, err := os.ReadFile(filepath.Join("testdata", "cpp", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			loaded := NewForwardList()
+			if _, err := tt.read(loaded, bytes.NewReader(golden)); err != nil {
+				t.Fatalf("reading the C++ file failed: %v", err)
+			}
+			if got := slices.Collect(loaded.All()); !reflect.DeepEqual(got, want) {
+				t.Errorf("read %q, want %q", got, want)
+			}
+
+			original := NewForwardList(want...)
+			var buf bytes.Buffer
+			if _, err := tt.write(original, &buf); err != nil {
+				t.Fatalf("writing the C++ format failed: %v", err)
+			}
+			if !bytes.Equal(buf.Bytes(), golden) {
+				t.Errorf("wrote\n%q\nwant\n%q", buf.Bytes(), golden)
+			}
+		})
+	}
+}
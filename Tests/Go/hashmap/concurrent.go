@@ -0,0 +1,173 @@
+package hashmap
+
+import (
+	"iter"
+	"runtime"
+	"sync"
+)
+
+// concurrentShard is one independently locked part of a ConcurrentChainMap.
+// The padding keeps the locks of neighbouring shards off the same cache
+// line.
+type concurrentShard[K comparable, V any] struct {
+	mu sync.RWMutex
+	m  *ChainMap[K, V]
+	_  [32]byte
+}
+
+// ConcurrentChainMap is a ChainMap that is safe for concurrent use. Keys are
+// spread over a fixed number of shards, each an ordinary ChainMap behind its
+// own lock, so goroutines working on different shards do not wait for each
+// other. Its methods follow sync.Map.
+type ConcurrentChainMap[K comparable, V any] struct {
+	shards []concurrentShard[K, V]
+	hasher Hasher[K]
+}
+
+// NewConcurrentChainMap creates a map with the given number of shards that
+// has room for about initialCapacity keys in total. A shard count below 1
+// selects four shards per GOMAXPROCS. The hasher and options are those of
+// NewChainMap and are shared by every shard.
+func NewConcurrentChainMap[K comparable, V any](initialCapacity, shardCount int, hasher Hasher[K], opts ...Options) *ConcurrentChainMap[K, V] {
+	if shardCount < 1 {
+		shardCount = 4 * runtime.GOMAXPROCS(0)
+	}
+	perShard := max((initialCapacity+shardCount-1)/shardCount, 1)
+
+	first := NewChainMap[K, V](perShard, hasher, opts...)
+	cm := &ConcurrentChainMap[K, V]{
+		shards: make([]concurrentShard[K, V], shardCount),
+		hasher: first.hasher,
+	}
+	cm.shards[0].m = first
+	for i := 1; i < shardCount; i++ {
+		cm.shards[i].m = NewChainMap[K, V](perShard, first.hasher, opts...)
+	}
+	return cm
+}
+
+// shard returns the shard of key. The hash is mixed before it is reduced,
+// because each shard reduces the same hash modulo its own bucket count and
+// the two must not pick the same bits.
+func (cm *ConcurrentChainMap[K, V]) shard(key K) *concurrentShard[K, V] {
+	return &cm.shards[mix64(cm.hasher(key))%uint64(len(cm.shards))]
+}
+
+// Load returns the value stored for key, if any.
+func (cm *ConcurrentChainMap[K, V]) Load(key K) (value V, ok bool) {
+	shard := cm.shard(key)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	if node := shard.m.findNode(key); node != nil {
+		return node.Data, true
+	}
+	return value, false
+}
+
+// Store sets the value for key.
+func (cm *ConcurrentChainMap[K, V]) Store(key K, value V) {
+	shard := cm.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	shard.m.Add(key, value)
+}
+
+// LoadOrStore returns the existing value for key if there is one.
+// Otherwise it stores and returns value. loaded reports which happened.
+func (cm *ConcurrentChainMap[K, V]) LoadOrStore(key K, value V) (actual V, loaded bool) {
+	shard := cm.shard(key)
+	// Most calls for a key after the first find it, so try a shared lock
+	// first.
+	shard.mu.RLock()
+	if node := shard.m.findNode(key); node != nil {
+		actual = node.Data
+		shard.mu.RUnlock()
+		return actual, true
+	}
+	shard.mu.RUnlock()
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if node := shard.m.findNode(key); node != nil {
+		return node.Data, true
+	}
+	shard.m.Add(key, value)
+	return value, false
+}
+
+// LoadAndDelete deletes the value for key and returns it, if there was one.
+func (cm *ConcurrentChainMap[K, V]) LoadAndDelete(key K) (value V, loaded bool) {
+	shard := cm.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	node := shard.m.findNode(key)
+	if node == nil {
+		return value, false
+	}
+	value = node.Data
+	shard.m.Del(key)
+	return value, true
+}
+
+// Delete deletes the value for key.
+func (cm *ConcurrentChainMap[K, V]) Delete(key K) {
+	shard := cm.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	shard.m.Del(key)
+}
+
+// Len returns the number of keys. Other goroutines may change it before it
+// returns.
+func (cm *ConcurrentChainMap[K, V]) Len() int {
+	n := 0
+	for i := range cm.shards {
+		shard := &cm.shards[i]
+		shard.mu.RLock()
+		n += shard.m.size
+		shard.mu.RUnlock()
+	}
+	return n
+}
+
+// Range calls f for every key and value until f returns false. Like
+// sync.Map.Range it does not see a consistent snapshot of the whole map:
+// each shard is copied under its lock and f is called without holding any,
+// so f may call any method of the map.
+func (cm *ConcurrentChainMap[K, V]) Range(f func(key K, value V) bool) {
+	var keys []K
+	var values []V
+	for i := range cm.shards {
+		shard := &cm.shards[i]
+		keys, values = keys[:0], values[:0]
+		shard.mu.RLock()
+		for key, value := range shard.m.All() {
+			keys = append(keys, key)
+			values = append(values, value)
+		}
+		shard.mu.RUnlock()
+
+		for j := range keys {
+			if !f(keys[j], values[j]) {
+				return
+			}
+		}
+	}
+}
+
+// All yields every key and value the way Range visits them.
+func (cm *ConcurrentChainMap[K, V]) All() iter.Seq2[K, V] {
+	return cm.Range
+}
+
+// Stats returns the Stats of every shard.
+func (cm *ConcurrentChainMap[K, V]) Stats() []Stats {
+	stats := make([]Stats, len(cm.shards))
+	for i := range cm.shards {
+		shard := &cm.shards[i]
+		shard.mu.RLock()
+		stats[i] = shard.m.Stats()
+		shard.mu.RUnlock()
+	}
+	return stats
+}
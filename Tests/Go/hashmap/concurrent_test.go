@@ -0,0 +1,212 @@
+package hashmap
+
+import (
+	"fmt"
+	"maps"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestConcurrentChainMap(t *testing.T) {
+	t.Run("Semantics", func(t *testing.T) {
+		cm := NewConcurrentChainMap[string, int](0, 4, nil)
+		if _, ok := cm.Load("a"); ok {
+			t.Error("Load() of a missing key succeeded")
+		}
+		cm.Store("a", 1)
+		cm.Store("a", 2)
+		if v, ok := cm.Load("a"); !ok || v != 2 {
+			t.Errorf("Load(\"a\") = %d, %v, want 2", v, ok)
+		}
+		if v, loaded := cm.LoadOrStore("a", 3); !loaded || v != 2 {
+			t.Errorf("LoadOrStore() of a stored key = %d, %v", v, loaded)
+		}
+		if v, loaded := cm.LoadOrStore("b", 3); loaded || v != 3 {
+			t.Errorf("LoadOrStore() of a new key = %d, %v", v, loaded)
+		}
+		if v, loaded := cm.LoadAndDelete("b"); !loaded || v != 3 {
+			t.Errorf("LoadAndDelete() = %d, %v", v, loaded)
+		}
+		if _, loaded := cm.LoadAndDelete("b"); loaded {
+			t.Error("LoadAndDelete() of a deleted key succeeded")
+		}
+		cm.Delete("a")
+		cm.Delete("missing")
+		if cm.Len() != 0 {
+			t.Errorf("Len() = %d after deleting everything", cm.Len())
+		}
+	})
+
+	t.Run("Shards", func(t *testing.T) {
+		cm := NewConcurrentChainMap[int, int](1000, 8, nil)
+		want := map[int]int{}
+		for i := 0; i < 1000; i++ {
+			cm.Store(i, i)
+			want[i] = i
+		}
+		if got := maps.Collect(cm.All()); !maps.Equal(got, want) {
+			t.Errorf("All() yielded %d keys, want %d", len(got), len(want))
+		}
+		for i, stats := range cm.Stats() {
+			if stats.Size < 1000/8/2 || stats.Size > 1000/8*2 {
+				t.Errorf("shard %d holds %d of 1000 keys", i, stats.Size)
+			}
+			// Shard and bucket must not be picked from the same bits of the
+			// hash, or each shard would use a fraction of its buckets.
+			used := -stats.EmptyBuckets
+			for _, count := range stats.ChainLengths {
+				used += count
+			}
+			if float64(stats.Size)/float64(used) > 2 {
+				t.Errorf("shard %d spreads %d keys over %d buckets", i, stats.Size, used)
+			}
+		}
+
+		visited := 0
+		cm.Range(func(int, int) bool {
+			visited++
+			return visited < 10
+		})
+		if visited != 10 {
+			t.Errorf("Range() went on after f returned false: %d calls", visited)
+		}
+		if n := len(NewConcurrentChainMap[int, int](0, 0, nil).shards); n < 4 {
+			t.Errorf("default shard count = %d", n)
+		}
+	})
+
+	t.Run("RangeCallsMethods", func(t *testing.T) {
+		cm := NewConcurrentChainMap[int, int](0, 2, nil)
+		for i := 0; i < 100; i++ {
+			cm.Store(i, i)
+		}
+		// f may use the map without deadlocking.
+		cm.Range(func(key, value int) bool {
+			cm.Store(key, value+1)
+			cm.Delete(key + 1000)
+			cm.Load(key)
+			return true
+		})
+		for i := 0; i < 100; i++ {
+			if v, _ := cm.Load(i); v != i+1 {
+				t.Fatalf("Load(%d) = %d, want %d", i, v, i+1)
+			}
+		}
+	})
+
+	t.Run("Parallel", func(t *testing.T) {
+		const goroutines, keys = 8, 500
+		cm := NewConcurrentChainMap[int, int](0, 4, nil)
+		var stored atomic.Int64
+		var wg sync.WaitGroup
+		for g := 0; g < goroutines; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < keys; i++ {
+					key := i
+					if _, loaded := cm.LoadOrStore(key, g); !loaded {
+						stored.Add(1)
+					}
+					cm.Store(keys+g*keys+i, i)
+					if v, ok := cm.Load(keys + g*keys + i); !ok || v != i {
+						t.Errorf("Load() of own key = %d, %v", v, ok)
+						return
+					}
+					if i%2 == 0 {
+						cm.Delete(keys + g*keys + i)
+					}
+					if i%50 == 0 {
+						cm.Range(func(int, int) bool { return true })
+						cm.Len()
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		if stored.Load() != keys {
+			t.Errorf("LoadOrStore() stored %d times for %d keys", stored.Load(), keys)
+		}
+		if want := keys + goroutines*keys/2; cm.Len() != want {
+			t.Errorf("Len() = %d, want %d", cm.Len(), want)
+		}
+	})
+}
+
+// mutexChainMap is the obvious alternative to ConcurrentChainMap: one lock
+// around one ChainMap.
+type mutexChainMap struct {
+	mu sync.RWMutex
+	m  *ChainMap[string, int]
+}
+
+func (mm *mutexChainMap) Load(key string) (int, bool) {
+	mm.mu.RLock()
+	defer mm.mu.RUnlock()
+	v, err := mm.m.Find(key)
+	return v, err == nil
+}
+
+func (mm *mutexChainMap) Store(key string, value int) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	mm.m.Add(key, value)
+}
+
+type syncMap struct{ sync.Map }
+
+func (sm *syncMap) Load(key string) (int, bool) {
+	v, ok := sm.Map.Load(key)
+	if !ok {
+		return 0, false
+	}
+	return v.(int), true
+}
+
+func (sm *syncMap) Store(key string, value int) {
+	sm.Map.Store(key, value)
+}
+
+type concurrentBenchMap interface {
+	Load(key string) (int, bool)
+	Store(key string, value int)
+}
+
+// BenchmarkConcurrentMap runs a mix of loads and stores from every
+// GOMAXPROCS goroutine at once. writes is the share of stores in percent.
+func BenchmarkConcurrentMap(b *testing.B) {
+	keys := benchKeys(100_000)
+	impls := []struct {
+		name string
+		new  func() concurrentBenchMap
+	}{
+		{"Mutex", func() concurrentBenchMap { return &mutexChainMap{m: NewChainMap[string, int](16, nil)} }},
+		{"Sharded", func() concurrentBenchMap { return NewConcurrentChainMap[string, int](0, 0, nil) }},
+		{"SyncMap", func() concurrentBenchMap { return &syncMap{} }},
+	}
+	for _, writes := range []int{1, 10, 50} {
+		for _, impl := range impls {
+			m := impl.new()
+			for i, key := range keys {
+				m.Store(key, i)
+			}
+			b.Run(fmt.Sprintf("Writes%d/%s", writes, impl.name), func(b *testing.B) {
+				var next atomic.Uint64
+				b.RunParallel(func(pb *testing.PB) {
+					i := int(next.Add(1) * 7919)
+					for pb.Next() {
+						i++
+						key := keys[i%len(keys)]
+						if i%100 < writes {
+							m.Store(key, i)
+						} else {
+							m.Load(key)
+						}
+					}
+				})
+			})
+		}
+	}
+}
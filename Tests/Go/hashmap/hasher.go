@@ -0,0 +1,135 @@
+package hashmap
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"hash/maphash"
+	"reflect"
+)
+
+// Hasher maps a key to a hash value; ChainMap reduces it modulo its number
+// of buckets. Equal keys must produce equal hashes.
+type Hasher[K comparable] func(key K) uint64
+
+// FNV hashes a string with 32-bit FNV-1a, the function ChainMap used for
+// string keys before maps were seeded.
+func FNV(key string) uint64 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return uint64(h.Sum32())
+}
+
+func fnvUint64(v uint64) uint64 {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	h := fnv.New32a()
+	h.Write(buf[:])
+	return uint64(h.Sum32())
+}
+
+// hashableForm converts keys of the types the default hashers support to a
+// string or a uint64. At most one of the results is non-nil; both are nil for
+// other key types.
+func hashableForm[K comparable]() (asString func(K) string, asUint func(K) uint64) {
+	if f, ok := any(func(s string) string { return s }).(func(K) string); ok {
+		return f, nil
+	}
+
+	switch reflect.TypeFor[K]().Kind() {
+	case reflect.String:
+		return func(key K) string {
+			return reflect.ValueOf(key).String()
+		}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return nil, func(key K) uint64 {
+			return uint64(reflect.ValueOf(key).Int())
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return nil, func(key K) uint64 {
+			return reflect.ValueOf(key).Uint()
+		}
+	}
+	return nil, nil
+}
+
+// DefaultHasher returns FNV for string keys and an FNV hash of the value for
+// integer keys. It returns nil for any other key type; such maps need an
+// explicit Hasher. Its hashes never change, which also makes them easy to
+// attack: maps created without a hasher use SeededHasher instead.
+func DefaultHasher[K comparable]() Hasher[K] {
+	asString, asUint := hashableForm[K]()
+	switch {
+	case asString != nil:
+		return func(key K) uint64 {
+			return FNV(asString(key))
+		}
+	case asUint != nil:
+		return func(key K) uint64 {
+			return fnvUint64(asUint(key))
+		}
+	}
+	return nil
+}
+
+// SeededHasher returns a hasher for the key types DefaultHasher supports
+// whose hashes depend on seed, so that keys chosen to collide in one map do
+// not collide in another. A zero seed draws a random one with hash/maphash,
+// which is what maps created without a hasher do. Any other seed gives the
+// same hashes in every process: that makes bucket order reproducible in
+// tests, but anyone who knows the seed can find collisions again. It returns
+// nil for other key types.
+func SeededHasher[K comparable](seed uint64) Hasher[K] {
+	asString, asUint := hashableForm[K]()
+	if seed == 0 {
+		mapSeed := maphash.MakeSeed()
+		switch {
+		case asString != nil:
+			return func(key K) uint64 {
+				return maphash.String(mapSeed, asString(key))
+			}
+		case asUint != nil:
+			return func(key K) uint64 {
+				return maphash.Comparable(mapSeed, asUint(key))
+			}
+		}
+		return nil
+	}
+
+	seed = mix64(seed)
+	switch {
+	case asString != nil:
+		return func(key K) uint64 {
+			return pinnedStringHash(seed, asString(key))
+		}
+	case asUint != nil:
+		return func(key K) uint64 {
+			return mix64(asUint(key) ^ seed)
+		}
+	}
+	return nil
+}
+
+// pinnedStringHash is 64-bit FNV-1a started from a seeded offset basis, with
+// the result mixed so that every bit depends on the seed.
+func pinnedStringHash(seed uint64, s string) uint64 {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+	h := uint64(offset64) ^ seed
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= prime64
+	}
+	return mix64(h)
+}
+
+// mix64 is the finalizer of splitmix64.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,164 @@
+package hashmap
+
+import (
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"slices"
+	"testing"
+)
+
+type userID int64
+
+type compositeKey struct {
+	Tenant string
+	ID     int
+}
+
+func TestFNV(t *testing.T) {
+	for _, key := range []string{"", "a", "key1", "ключ"} {
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		if got, want := FNV(key), uint64(h.Sum32()); got != want {
+			t.Errorf("FNV(%q) = %d, want %d", key, got, want)
+		}
+	}
+}
+
+func TestDefaultHasher(t *testing.T) {
+	t.Run("String", func(t *testing.T) {
+		h := DefaultHasher[string]()
+		if h("abc") != FNV("abc") {
+			t.Error("DefaultHasher[string]() does not use FNV")
+		}
+	})
+
+	t.Run("NamedString", func(t *testing.T) {
+		type name string
+		h := DefaultHasher[name]()
+		if h == nil || h("abc") != FNV("abc") {
+			t.Error("DefaultHasher[name]() does not hash like FNV")
+		}
+	})
+
+	t.Run("Integers", func(t *testing.T) {
+		if h := DefaultHasher[int](); h(1) == h(2) || h(42) != h(42) {
+			t.Error("DefaultHasher[int]() is not a usable hash")
+		}
+		if h := DefaultHasher[userID](); h == nil || h(7) != DefaultHasher[int]()(7) {
+			t.Error("DefaultHasher[userID]() differs from the int hash")
+		}
+		if h := DefaultHasher[uint16](); h == nil || h(7) != DefaultHasher[int]()(7) {
+			t.Error("DefaultHasher[uint16]() differs from the int hash")
+		}
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		if DefaultHasher[compositeKey]() != nil {
+			t.Error("DefaultHasher[compositeKey]() != nil")
+		}
+		defer func() {
+			if recover() == nil {
+				t.Error("NewChainMap without a hasher for a struct key did not panic")
+			}
+		}()
+		NewChainMap[compositeKey, int](4, nil)
+	})
+}
+
+func TestSeededHasher(t *testing.T) {
+	// Keys that all land in bucket 0 of a 64-bucket table under FNV, as an
+	// attacker who knows the unseeded hash would pick them.
+	var colliding []string
+	for i := 0; len(colliding) < 32; i++ {
+		if key := fmt.Sprint(i); FNV(key)%64 == 0 {
+			colliding = append(colliding, key)
+		}
+	}
+
+	t.Run("Random", func(t *testing.T) {
+		a, b := SeededHasher[string](0), SeededHasher[string](0)
+		buckets := map[uint64]bool{}
+		differ := false
+		for _, key := range colliding {
+			if a(key) != a(key) {
+				t.Fatalf("hash of %q is not stable", key)
+			}
+			differ = differ || a(key) != b(key)
+			buckets[a(key)%64] = true
+		}
+		if !differ {
+			t.Error("two random seeds hash every key alike")
+		}
+		if len(buckets) < 8 {
+			t.Errorf("FNV collisions use only %d of 64 buckets under a random seed", len(buckets))
+		}
+	})
+
+	t.Run("Pinned", func(t *testing.T) {
+		// Pinned hashes must not change between releases, or tests that rely
+		// on them would break.
+		if got := SeededHasher[string](42)("abc"); got != 17934232012558829943 {
+			t.Errorf("SeededHasher[string](42)(\"abc\") = %d", got)
+		}
+		if got := SeededHasher[int](42)(7); got != 17042263512453037798 {
+			t.Errorf("SeededHasher[int](42)(7) = %d", got)
+		}
+		if SeededHasher[string](1)("abc") == SeededHasher[string](2)("abc") {
+			t.Error("different pinned seeds give the same hash")
+		}
+		if h := SeededHasher[userID](42); h == nil || h(7) != SeededHasher[int](42)(7) {
+			t.Error("SeededHasher[userID]() differs from the int hash")
+		}
+		if SeededHasher[compositeKey](42) != nil || SeededHasher[compositeKey](0) != nil {
+			t.Error("SeededHasher[compositeKey]() != nil")
+		}
+	})
+
+	t.Run("ChainMap", func(t *testing.T) {
+		order := func(seed uint64) []string {
+			cm := NewChainMap[string, int](64, nil, Options{Seed: seed})
+			for i, key := range colliding {
+				cm.Add(key, i)
+			}
+			return slices.Collect(cm.Keys())
+		}
+		if a, b := order(7), order(7); !slices.Equal(a, b) {
+			t.Errorf("maps with the same pinned seed iterate as %v and %v", a, b)
+		}
+
+		cm := NewChainMap[string, int](64, nil)
+		for i, key := range colliding {
+			cm.Add(key, i)
+		}
+		for i, bucket := range cm.table {
+			chain := 0
+			for node := bucket.Head; node != nil; node = node.Next {
+				chain++
+			}
+			if chain == len(colliding) {
+				t.Errorf("FNV collisions all share bucket %d of a seeded map", i)
+			}
+		}
+
+		// Files do not depend on the seed.
+		data, err := cm.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary() failed: %v", err)
+		}
+		for _, seed := range []uint64{0, 1, 99} {
+			loaded := NewChainMap[string, int](1, nil, Options{Seed: seed})
+			if err := loaded.UnmarshalBinary(data); err != nil {
+				t.Fatalf("UnmarshalBinary() with seed %d failed: %v", seed, err)
+			}
+			if got, want := maps.Collect(loaded.All()), maps.Collect(cm.All()); !maps.Equal(got, want) {
+				t.Errorf("map with seed %d loaded %v, want %v", seed, got, want)
+			}
+			for i, key := range colliding {
+				if got, err := loaded.Find(key); err != nil || got != i {
+					t.Errorf("Find(%q) with seed %d = %d, %v", key, seed, got, err)
+				}
+			}
+		}
+	})
+}
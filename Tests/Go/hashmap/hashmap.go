@@ -2,368 +2,1006 @@ package hashmap
 
 import (
 	"bufio"
-	"encoding/binary"
+	"encoding/json"
 	"fmt"
-	"hash/fnv"
 	"io"
+	"iter"
+	"math"
 	"os"
 	"strconv"
 	"strings"
+
+	"Go/persist"
 )
 
-type ChainNode struct {
-	Key  string
-	Data int
-	Next *ChainNode
+type ChainNode[K comparable, V any] struct {
+	Key  K
+	Data V
+	Next *ChainNode[K, V]
 }
 
-func NewChainNode(key string, data int) *ChainNode {
-	return &ChainNode{
+func NewChainNode[K comparable, V any](key K, data V) *ChainNode[K, V] {
+	return &ChainNode[K, V]{
 		Key:  key,
 		Data: data,
 		Next: nil,
 	}
 }
 
-type Bucket struct {
-	Head *ChainNode
+type Bucket[K comparable, V any] struct {
+	Head *ChainNode[K, V]
 }
 
-func NewBucket() *Bucket {
-	return &Bucket{Head: nil}
+func NewBucket[K comparable, V any]() *Bucket[K, V] {
+	return &Bucket[K, V]{Head: nil}
 }
 
-type ChainMap struct {
-	table    []*Bucket
-	capacity int
-	size     int
+// find returns the node holding key, or nil.
+func (b *Bucket[K, V]) find(key K) *ChainNode[K, V] {
+	for current := b.Head; current != nil; current = current.Next {
+		if current.Key == key {
+			return current
+		}
+	}
+	return nil
 }
 
-func NewChainMap(initialCapacity int) *ChainMap {
-	table := make([]*Bucket, initialCapacity)
-	for i := range table {
-		table[i] = NewBucket()
+// remove unlinks the node holding key and reports whether there was one.
+func (b *Bucket[K, V]) remove(key K) bool {
+	var prevNode *ChainNode[K, V]
+	for currentNode := b.Head; currentNode != nil; currentNode = currentNode.Next {
+		if currentNode.Key == key {
+			if prevNode == nil {
+				b.Head = currentNode.Next
+			} else {
+				prevNode.Next = currentNode.Next
+			}
+			return true
+		}
+		prevNode = currentNode
 	}
-	return &ChainMap{
-		table:    table,
-		capacity: initialCapacity,
-		size:     0,
+	return false
+}
+
+// ChainMap is a hash map with separate chaining. It doubles when Add takes
+// it over Options.GrowAt keys per bucket and halves when Del takes it below
+// Options.ShrinkAt. Either way it resizes incrementally: the old bucket table
+// is kept next to the new one and every Add or Del of a key moves a few of
+// its buckets over, so no single call has to move the whole map. Lookups
+// search both tables until the move is done.
+type ChainMap[K comparable, V any] struct {
+	table      []*Bucket[K, V]
+	capacity   int
+	size       int
+	hasher     Hasher[K]
+	keyCodec   persist.Codec[K]
+	valueCodec persist.Codec[V]
+	version    int
+	encodeOpts persist.EncodeOptions
+	decodeOpts persist.DecodeOptions
+
+	// old is the table being moved into table while the map is resized,
+	// and rehashIndex the first of its buckets that has not been moved yet.
+	old         []*Bucket[K, V]
+	rehashIndex int
+	opts        Options
+	// minCapacity is the smallest table Del shrinks to.
+	minCapacity int
+	// rehashes counts the resizes started so far.
+	rehashes int
+}
+
+// Options controls when a ChainMap resizes. A zero field takes its value from
+// DefaultOptions, and a negative ShrinkAt disables shrinking.
+type Options struct {
+	// GrowAt is the load factor, in keys per bucket, at which Add doubles
+	// the table.
+	GrowAt float64
+	// ShrinkAt is the load factor below which Del halves the table. It must
+	// be less than half of GrowAt, or a halved table would grow again at
+	// once.
+	ShrinkAt float64
+	// Seed pins the seed of the hasher a map gets when it is given none; see
+	// SeededHasher. Zero gives every map a random seed. Files do not record
+	// the seed, so they load into maps with any other.
+	Seed uint64
+}
+
+// DefaultOptions holds the thresholds used when none are configured.
+var DefaultOptions = Options{GrowAt: 0.75, ShrinkAt: 0.1}
+
+// withDefaults fills zero fields from DefaultOptions.
+func (o Options) withDefaults() Options {
+	if o.GrowAt == 0 {
+		o.GrowAt = DefaultOptions.GrowAt
+	}
+	if o.ShrinkAt == 0 {
+		o.ShrinkAt = DefaultOptions.ShrinkAt
 	}
+	return o
 }
 
-func (cm *ChainMap) hashFunction(key string) int {
-	h := fnv.New32a()
-	h.Write([]byte(key))
-	return int(h.Sum32()) % cm.capacity
+func (o Options) validate() error {
+	if !(o.GrowAt > 0) {
+		return fmt.Errorf("GrowAt %v не больше нуля", o.GrowAt)
+	}
+	if o.ShrinkAt >= o.GrowAt/2 {
+		return fmt.Errorf("ShrinkAt %v не меньше половины GrowAt %v", o.ShrinkAt, o.GrowAt)
+	}
+	return nil
 }
 
-func (cm *ChainMap) rehash() {
-	newCapacity := cm.capacity * 2
-	newTable := make([]*Bucket, newCapacity)
-	for i := range newTable {
-		newTable[i] = NewBucket()
+// NewChainMap creates a map with the given number of buckets, which is also
+// the smallest size Del shrinks it to. A nil hasher selects a SeededHasher
+// seeded by Options.Seed, which panics for key types it cannot hash. Without
+// options the map uses DefaultOptions; with several, only the first is used.
+// Invalid options panic.
+func NewChainMap[K comparable, V any](initialCapacity int, hasher Hasher[K], opts ...Options) *ChainMap[K, V] {
+	var options Options
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+	options = options.withDefaults()
+	if err := options.validate(); err != nil {
+		panic(fmt.Sprintf("hashmap: неверные параметры: %v", err))
+	}
+	if hasher == nil {
+		hasher = SeededHasher[K](options.Seed)
+	}
+	if hasher == nil {
+		var zero K
+		panic(fmt.Sprintf("hashmap: нет хеш-функции по умолчанию для ключей типа %T", zero))
+	}
+	return &ChainMap[K, V]{
+		table:       newTable[K, V](initialCapacity),
+		capacity:    initialCapacity,
+		size:        0,
+		hasher:      hasher,
+		keyCodec:    defaultKeyCodec[K](),
+		valueCodec:  defaultValueCodec[V](),
+		opts:        options,
+		minCapacity: initialCapacity,
 	}
+}
 
-	for i := 0; i < cm.capacity; i++ {
-		currentNode := cm.table[i].Head
+func newTable[K comparable, V any](capacity int) []*Bucket[K, V] {
+	table := make([]*Bucket[K, V], capacity)
+	for i := range table {
+		table[i] = NewBucket[K, V]()
+	}
+	return table
+}
+
+// defaultKeyCodec keeps string keys in the original format: a 64-bit length
+// followed by the key bytes.
+func defaultKeyCodec[K comparable]() persist.Codec[K] {
+	if c, ok := any(persist.String64).(persist.Codec[K]); ok {
+		return c
+	}
+	return persist.Default[K]()
+}
+
+// defaultValueCodec keeps int values in the original 32-bit format.
+func defaultValueCodec[V any]() persist.Codec[V] {
+	if c, ok := any(persist.Int32).(persist.Codec[V]); ok {
+		return c
+	}
+	return persist.Default[V]()
+}
+
+// SetCodecs changes how keys and values are encoded by the Write*/Read*
+// methods.
+func (cm *ChainMap[K, V]) SetCodecs(keyCodec persist.Codec[K], valueCodec persist.Codec[V]) {
+	cm.keyCodec = keyCodec
+	cm.valueCodec = valueCodec
+}
+
+func (cm *ChainMap[K, V]) hashFunction(key K) int {
+	return int(cm.hasher(key) % uint64(cm.capacity))
+}
+
+// rehashStep is the number of non-empty old buckets moved by every Add or
+// Del while the map is resized, and rehashEmptyVisits how many empty buckets
+// each of them may skip on top. Moving several per call makes sure the move
+// is over long before the new table needs resizing again, even when a
+// sparse table is shrinking.
+const (
+	rehashStep        = 4
+	rehashEmptyVisits = 10
+)
+
+// resize starts moving the map into a table with the given number of
+// buckets. The buckets of the old one are moved over by later calls to Add
+// and Del.
+func (cm *ChainMap[K, V]) resize(capacity int) {
+	cm.finishRehash()
+	cm.old = cm.table
+	cm.rehashIndex = 0
+	cm.capacity = capacity
+	cm.table = newTable[K, V](cm.capacity)
+	cm.rehashes++
+	cm.version++
+}
+
+// moveBuckets moves up to n non-empty buckets from the old table into the
+// current one, passing over at most rehashEmptyVisits empty buckets for each.
+func (cm *ChainMap[K, V]) moveBuckets(n int) {
+	emptyVisits := n * rehashEmptyVisits
+	for n > 0 && cm.old != nil {
+		bucket := cm.old[cm.rehashIndex]
+		if bucket.Head == nil {
+			emptyVisits--
+		} else {
+			n--
+		}
+		currentNode := bucket.Head
 		for currentNode != nil {
 			nextNode := currentNode.Next
 
-			h := fnv.New32a()
-			h.Write([]byte(currentNode.Key))
-			newIndex := int(h.Sum32()) % newCapacity
-
-			currentNode.Next = newTable[newIndex].Head
-			newTable[newIndex].Head = currentNode
+			newIndex := cm.hashFunction(currentNode.Key)
+			currentNode.Next = cm.table[newIndex].Head
+			cm.table[newIndex].Head = currentNode
 
 			currentNode = nextNode
 		}
-	}
+		bucket.Head = nil
 
-	cm.table = newTable
-	cm.capacity = newCapacity
+		cm.rehashIndex++
+		if cm.rehashIndex == len(cm.old) {
+			cm.old = nil
+			cm.rehashIndex = 0
+		}
+		if emptyVisits == 0 {
+			return
+		}
+	}
 }
 
-func (cm *ChainMap) Add(key string, data int) {
-	if float64(cm.size) >= float64(cm.capacity)*0.75 {
-		cm.rehash()
+// finishRehash moves whatever is left of the old table.
+func (cm *ChainMap[K, V]) finishRehash() {
+	for cm.old != nil {
+		cm.moveBuckets(len(cm.old))
 	}
+}
 
-	index := cm.hashFunction(key)
-	currentNode := cm.table[index].Head
+// buckets returns the bucket of key in the current table and, while the map
+// grows, its bucket in the old table if that has not been moved yet.
+func (cm *ChainMap[K, V]) buckets(key K) (current, old *Bucket[K, V]) {
+	current = cm.table[cm.hashFunction(key)]
+	if cm.old != nil {
+		if index := int(cm.hasher(key) % uint64(len(cm.old))); index >= cm.rehashIndex {
+			old = cm.old[index]
+		}
+	}
+	return current, old
+}
 
-	for currentNode != nil {
-		if currentNode.Key == key {
-			currentNode.Data = data
-			return
+func (cm *ChainMap[K, V]) findNode(key K) *ChainNode[K, V] {
+	current, old := cm.buckets(key)
+	if old != nil {
+		if node := old.find(key); node != nil {
+			return node
 		}
-		currentNode = currentNode.Next
 	}
+	return current.find(key)
+}
 
+func (cm *ChainMap[K, V]) Add(key K, data V) {
+	if node := cm.findNode(key); node != nil {
+		node.Data = data
+		return
+	}
+
+	if float64(cm.size) >= float64(cm.capacity)*cm.opts.GrowAt {
+		cm.resize(cm.capacity * 2)
+	}
+	cm.moveBuckets(rehashStep)
+
+	index := cm.hashFunction(key)
 	newNode := NewChainNode(key, data)
 	newNode.Next = cm.table[index].Head
 	cm.table[index].Head = newNode
 	cm.size++
+	cm.version++
 }
 
-func (cm *ChainMap) Del(key string) {
-	index := cm.hashFunction(key)
-	currentNode := cm.table[index].Head
-	var prevNode *ChainNode
-
-	for currentNode != nil {
-		if currentNode.Key == key {
-			if prevNode == nil {
-				cm.table[index].Head = currentNode.Next
-			} else {
-				prevNode.Next = currentNode.Next
-			}
-			cm.size--
-			return
-		}
-		prevNode = currentNode
-		currentNode = currentNode.Next
+func (cm *ChainMap[K, V]) Del(key K) {
+	current, old := cm.buckets(key)
+	if (old == nil || !old.remove(key)) && !current.remove(key) {
+		return
 	}
+	cm.size--
+	cm.version++
+	if cm.shouldShrink() {
+		cm.resize(max(cm.capacity/2, cm.minCapacity))
+	}
+	cm.moveBuckets(rehashStep)
 }
 
-func (cm *ChainMap) IsContain(key string) bool {
-	index := cm.hashFunction(key)
-	current := cm.table[index].Head
+// shouldShrink reports whether the load factor has dropped below ShrinkAt.
+// The map does not shrink while it is still moving into its current table,
+// which keeps Del from ever having to finish that move at once.
+func (cm *ChainMap[K, V]) shouldShrink() bool {
+	return cm.old == nil && cm.opts.ShrinkAt >= 0 && cm.capacity > cm.minCapacity &&
+		float64(cm.size) < float64(cm.capacity)*cm.opts.ShrinkAt
+}
 
-	for current != nil {
-		if current.Key == key {
-			return true
-		}
-		current = current.Next
+// fitCapacity returns the smallest number of buckets that holds n keys
+// without growing.
+func (cm *ChainMap[K, V]) fitCapacity(n int) int {
+	return max(int(math.Floor(float64(n-1)/cm.opts.GrowAt))+1, 1)
+}
+
+// Reserve makes room for n keys, so that adding up to that many does not
+// grow the map, and keeps Del from shrinking it below that room. Unlike
+// growing, it moves every key at once.
+func (cm *ChainMap[K, V]) Reserve(n int) {
+	capacity := cm.fitCapacity(n)
+	cm.minCapacity = max(cm.minCapacity, capacity)
+	if capacity > cm.capacity {
+		cm.resize(capacity)
+		cm.finishRehash()
 	}
+}
 
-	return false
+// ShrinkToFit shrinks the table to the smallest size that holds the current
+// keys, which also becomes the smallest size Del shrinks it to. It moves
+// every key at once.
+func (cm *ChainMap[K, V]) ShrinkToFit() {
+	capacity := cm.fitCapacity(cm.size)
+	cm.minCapacity = capacity
+	if capacity < cm.capacity {
+		cm.resize(capacity)
+	}
+	cm.finishRehash()
 }
 
-func (cm *ChainMap) Find(key string) (int, error) {
-	index := cm.hashFunction(key)
-	current := cm.table[index].Head
+// LoadFactor returns the number of keys per bucket.
+func (cm *ChainMap[K, V]) LoadFactor() float64 {
+	return float64(cm.size) / float64(cm.capacity)
+}
 
-	for current != nil {
-		if current.Key == key {
-			return current.Data, nil
-		}
-		current = current.Next
+func (cm *ChainMap[K, V]) IsContain(key K) bool {
+	return cm.findNode(key) != nil
+}
+
+func (cm *ChainMap[K, V]) Find(key K) (V, error) {
+	if node := cm.findNode(key); node != nil {
+		return node.Data, nil
 	}
 
-	return 0, fmt.Errorf("в словаре нет такого ключа")
+	var zero V
+	return zero, fmt.Errorf("в словаре нет такого ключа")
 }
 
-func (cm *ChainMap) GetAllKeys(result *ChainMap) {
-	for i := 0; i < cm.capacity; i++ {
-		currentNode := cm.table[i].Head
-		for currentNode != nil {
-			result.Add(currentNode.Key, 1)
-			currentNode = currentNode.Next
-		}
+func (cm *ChainMap[K, V]) GetAllKeys(result *ChainMap[K, int]) {
+	for currentNode := range cm.nodes() {
+		result.Add(currentNode.Key, 1)
 	}
 }
 
-func (cm *ChainMap) GetAllKeysAsString() string {
+func (cm *ChainMap[K, V]) GetAllKeysAsString() string {
 	var result strings.Builder
-	tempKeys := NewChainMap(cm.capacity)
+	tempKeys := NewChainMap[K, int](cm.capacity, cm.hasher)
 	cm.GetAllKeys(tempKeys)
 
-	for i := 0; i < tempKeys.capacity; i++ {
-		currentNode := tempKeys.table[i].Head
-		for currentNode != nil {
-			result.WriteString(currentNode.Key)
-			currentNode = currentNode.Next
-		}
+	for currentNode := range tempKeys.nodes() {
+		fmt.Fprint(&result, currentNode.Key)
 	}
 
 	return result.String()
 }
 
-func (cm *ChainMap) PrintContents() {
+// nodes yields every node in bucket order: first the buckets of the old
+// table that have not been moved yet, then the current table. It does not
+// move any buckets itself.
+func (cm *ChainMap[K, V]) nodes() iter.Seq[*ChainNode[K, V]] {
+	return func(yield func(*ChainNode[K, V]) bool) {
+		if cm.old != nil {
+			for i := cm.rehashIndex; i < len(cm.old); i++ {
+				for currentNode := cm.old[i].Head; currentNode != nil; currentNode = currentNode.Next {
+					if !yield(currentNode) {
+						return
+					}
+				}
+			}
+		}
+		for i := 0; i < cm.capacity; i++ {
+			for currentNode := cm.table[i].Head; currentNode != nil; currentNode = currentNode.Next {
+				if !yield(currentNode) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// All yields every key/value pair in bucket order. Adding or deleting keys
+// while iterating panics; updating the value of an existing key does not.
+// Since only Add and Del move buckets while the map grows, iterating in the
+// middle of a move sees every key exactly once.
+func (cm *ChainMap[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		version := cm.version
+		for currentNode := range cm.nodes() {
+			if !yield(currentNode.Key, currentNode.Data) {
+				return
+			}
+			if cm.version != version {
+				panic("hashmap: словарь изменён во время обхода")
+			}
+		}
+	}
+}
+
+func (cm *ChainMap[K, V]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		for key := range cm.All() {
+			if !yield(key) {
+				return
+			}
+		}
+	}
+}
+
+func (cm *ChainMap[K, V]) Values() iter.Seq[V] {
+	return func(yield func(V) bool) {
+		for _, data := range cm.All() {
+			if !yield(data) {
+				return
+			}
+		}
+	}
+}
+
+// PrintContents prints every bucket. A pending rehash is finished first so
+// that every key shows up in its bucket.
+func (cm *ChainMap[K, V]) PrintContents() {
+	cm.finishRehash()
 	fmt.Println("Содержимое хеш-таблицы:")
 	for i := 0; i < cm.capacity; i++ {
 		fmt.Printf("[%d]: ", i)
 		currentNode := cm.table[i].Head
 		if currentNode != nil {
 			for currentNode.Next != nil {
-				fmt.Printf("%s -> %d, ", currentNode.Key, currentNode.Data)
+				fmt.Printf("%v -> %v, ", currentNode.Key, currentNode.Data)
 				currentNode = currentNode.Next
 			}
-			fmt.Printf("%s -> %d", currentNode.Key, currentNode.Data)
+			fmt.Printf("%v -> %v", currentNode.Key, currentNode.Data)
 		}
 		fmt.Println()
 	}
 	fmt.Println()
 }
 
-func (cm *ChainMap) appendNode(index int, node *ChainNode) {
-    bucket := cm.table[index]
-    if bucket.Head == nil {
-        bucket.Head = node
-        return
-    }
-    cur := bucket.Head
-    for cur.Next != nil {
-        cur = cur.Next
-    }
-    cur.Next = node
+// maxLoadedBucketsPerKey bounds the capacity a read allocates for every key
+// in the file, so that a file cannot declare a huge table for a few keys.
+const maxLoadedBucketsPerKey = 16
+
+// loadCapacity returns the capacity a map read from a file starts with: the
+// capacity the file declares, but no more than maxLoadedBucketsPerKey buckets
+// per key and no less than size keys need to stay under GrowAt.
+func (cm *ChainMap[K, V]) loadCapacity(declared uint64, size int) int {
+	bound := uint64(maxLoadedBucketsPerKey * max(size, 1))
+	return max(int(min(declared, bound)), cm.fitCapacity(size))
 }
 
-func (cm *ChainMap) WriteBinary(filename string) error {
-	file, err := os.Create(filename)
-	if err != nil {
-		return fmt.Errorf("не удалось открыть файл для записи: %s", filename)
+// load returns a map like cm holding the nodes read from a file that
+// declared the given capacity. Readers collect the nodes first so that the
+// table is sized by the keys the file holds rather than the count it
+// declares. A key the file repeats is an error rather than an update.
+func (cm *ChainMap[K, V]) load(declared uint64, nodes []*ChainNode[K, V]) (*ChainMap[K, V], error) {
+	loaded := cm.emptyCopy(cm.loadCapacity(declared, len(nodes)))
+	for _, node := range nodes {
+		bucket := loaded.table[loaded.hashFunction(node.Key)]
+		if bucket.find(node.Key) != nil {
+			return nil, fmt.Errorf("повторяющийся ключ %v", node.Key)
+		}
+		node.Next = bucket.Head
+		bucket.Head = node
+		loaded.size++
 	}
-	defer file.Close()
+	return loaded, nil
+}
 
-	if err := binary.Write(file, binary.LittleEndian, int64(cm.capacity)); err != nil {
-		return err
-	}
-	if err := binary.Write(file, binary.LittleEndian, int64(cm.size)); err != nil {
-		return err
+// WriteTo writes the map in its binary format: the capacity and size followed
+// by every key/value pair in bucket order.
+func (cm *ChainMap[K, V]) WriteTo(w io.Writer) (int64, error) {
+	enc := persist.NewEncoder(w)
+	if err := enc.WriteHeader(cm.header()); err != nil {
+		return enc.Len(), err
 	}
+	return cm.writeBinary(enc)
+}
 
-	for i := 0; i < cm.capacity; i++ {
-		currentNode := cm.table[i].Head
-		for currentNode != nil {
-			keyLength := int64(len(currentNode.Key))
-			if err := binary.Write(file, binary.LittleEndian, keyLength); err != nil {
-				return err
-			}
-			if _, err := file.Write([]byte(currentNode.Key)); err != nil {
-				return err
-			}
+// WriteCppTo writes the map in the layout of the C++ ChainMap::writeBinary,
+// which is the headerless layout read by ReadLegacyFrom. The C++ map holds
+// string keys and int values, so the map must use the default String64 and
+// Int32 codecs.
+func (cm *ChainMap[K, V]) WriteCppTo(w io.Writer) (int64, error) {
+	if err := cm.checkCppCodecs(); err != nil {
+		return 0, err
+	}
+	return cm.writeBinary(persist.NewEncoder(w))
+}
 
-			if err := binary.Write(file, binary.LittleEndian, int32(currentNode.Data)); err != nil {
-				return err
-			}
+func (cm *ChainMap[K, V]) writeBinary(enc *persist.Encoder) (int64, error) {
+	if err := enc.Uint64(uint64(cm.capacity)); err != nil {
+		return enc.Len(), err
+	}
+	if err := enc.Uint64(uint64(cm.size)); err != nil {
+		return enc.Len(), err
+	}
 
-			currentNode = currentNode.Next
+	for currentNode := range cm.nodes() {
+		if err := cm.keyCodec.Encode(enc, currentNode.Key); err != nil {
+			return enc.Len(), err
+		}
+		if err := cm.valueCodec.Encode(enc, currentNode.Data); err != nil {
+			return enc.Len(), err
+		}
+		if err := enc.EndRecord(); err != nil {
+			return enc.Len(), err
 		}
 	}
 
-	return nil
+	err := enc.Finish()
+	return enc.Len(), err
 }
 
-func (cm *ChainMap) ReadBinary(filename string) error {
-	file, err := os.Open(filename)
-	if err != nil {
-		return fmt.Errorf("не удалось открыть файл: %s", filename)
+// ReadFrom replaces the contents of the map with the binary data in r. The map
+// is left unchanged if the data cannot be decoded.
+func (cm *ChainMap[K, V]) ReadFrom(r io.Reader) (int64, error) {
+	dec := persist.NewDecoder(r, cm.decodeOpts)
+	if _, err := dec.ExpectHeader(cm.header()); err != nil {
+		return dec.Offset(), err
 	}
-	defer file.Close()
+	return cm.readBinary(dec)
+}
 
-	cm.table = nil
+// ReadLegacyFrom is like ReadFrom but reads the headerless format written
+// before the container header was introduced.
+func (cm *ChainMap[K, V]) ReadLegacyFrom(r io.Reader) (int64, error) {
+	return cm.readBinary(persist.NewDecoder(r, cm.decodeOpts))
+}
 
-	var capacity, size int64
-	if err := binary.Read(file, binary.LittleEndian, &capacity); err != nil {
-		return err
+// ReadCppFrom replaces the contents of the map with a file written by the
+// C++ ChainMap::writeBinary. Like WriteCppTo it needs the default codecs.
+func (cm *ChainMap[K, V]) ReadCppFrom(r io.Reader) (int64, error) {
+	if err := cm.checkCppCodecs(); err != nil {
+		return 0, err
 	}
-	if err := binary.Read(file, binary.LittleEndian, &size); err != nil {
-		return err
+	return cm.ReadLegacyFrom(r)
+}
+
+// checkCppCodecs reports an error unless keys and values are encoded the way
+// the C++ ChainMap stores its string keys and int values.
+func (cm *ChainMap[K, V]) checkCppCodecs() error {
+	key, value := persist.EncodingOf(cm.keyCodec), persist.EncodingOf(cm.valueCodec)
+	if key != persist.EncodingString64 || value != persist.EncodingInt32 {
+		return fmt.Errorf("формату C++ нужны ключи %v и значения %v, а не %v и %v",
+			persist.EncodingString64, persist.EncodingInt32, key, value)
 	}
+	return nil
+}
 
-	cm.capacity = int(capacity)
-	cm.size = int(size)
+// header describes the binary format written by WriteTo.
+func (cm *ChainMap[K, V]) header() persist.Header {
+	return chainMapHeader(cm.keyCodec, cm.valueCodec, cm.encodeOpts)
+}
 
-	cm.table = make([]*Bucket, cm.capacity)
-	for i := range cm.table {
-		cm.table[i] = NewBucket()
+// chainMapHeader describes the ChainMap binary format for the given codecs
+// and options. RobinHoodMap writes the same format, so it uses it too.
+func chainMapHeader[K comparable, V any](keyCodec persist.Codec[K], valueCodec persist.Codec[V], opts persist.EncodeOptions) persist.Header {
+	return persist.Header{
+		Type:  persist.TypeChainMap,
+		Key:   persist.EncodingOf(keyCodec),
+		Value: persist.EncodingOf(valueCodec),
+		Flags: opts.Flags(),
 	}
+}
 
-	for i := 0; i < int(size); i++ {
-		var keyLength int64
-		if err := binary.Read(file, binary.LittleEndian, &keyLength); err != nil {
-			return err
-		}
+// SetEncodeOptions changes the optional parts of the binary format written by
+// WriteTo and WriteBinary. Its Compression also applies to WriteTextTo and
+// WriteText; readers detect compressed files on their own.
+func (cm *ChainMap[K, V]) SetEncodeOptions(opts persist.EncodeOptions) {
+	cm.encodeOpts = opts
+}
 
-		keyBytes := make([]byte, keyLength)
-		if _, err := io.ReadFull(file, keyBytes); err != nil {
-			return err
-		}
-		key := string(keyBytes)
+// SetDecodeOptions changes the resource limits enforced by every Read*
+// method. Input that goes over a limit fails with persist.ErrLimitExceeded.
+func (cm *ChainMap[K, V]) SetDecodeOptions(opts persist.DecodeOptions) {
+	cm.decodeOpts = opts
+}
 
-		var data int32
-		if err := binary.Read(file, binary.LittleEndian, &data); err != nil {
-			return err
-		}
+func (cm *ChainMap[K, V]) readBinary(dec *persist.Decoder) (int64, error) {
+	capacity, err := dec.Uint64()
+	if err != nil {
+		return dec.Offset(), err
+	}
+	size, err := dec.Uint64()
+	if err != nil {
+		return dec.Offset(), err
+	}
+	if int64(capacity) < 1 {
+		return dec.Offset(), fmt.Errorf("неверная ёмкость в файле: %d", int64(capacity))
+	}
+	if err := dec.CheckCapacity(capacity); err != nil {
+		return dec.Offset(), err
+	}
+	if err := dec.CheckElements(size); err != nil {
+		return dec.Offset(), err
+	}
 
-		index := cm.hashFunction(key)
-		newNode := NewChainNode(key, int(data))
-		cm.appendNode(index, newNode)
+	nodes := make([]*ChainNode[K, V], 0, min(size, 1024))
+	for i := uint64(0); i < size; i++ {
+		key, err := cm.keyCodec.Decode(dec)
+		if err != nil {
+			return dec.Offset(), err
+		}
+		data, err := cm.valueCodec.Decode(dec)
+		if err != nil {
+			return dec.Offset(), err
+		}
+		if err := dec.EndRecord(); err != nil {
+			return dec.Offset(), err
+		}
+		nodes = append(nodes, NewChainNode(key, data))
 	}
 
-	return nil
+	if err := dec.Finish(); err != nil {
+		return dec.Offset(), err
+	}
+	loaded, err := cm.load(capacity, nodes)
+	if err != nil {
+		return dec.Offset(), &persist.CorruptionError{Offset: dec.Offset(), Err: err}
+	}
+	cm.replace(loaded)
+	return dec.Offset(), nil
 }
 
-func (cm *ChainMap) WriteText(filename string) error {
-	file, err := os.Create(filename)
-	if err != nil {
-		return fmt.Errorf("не удалось открыть файл для записи: %s", filename)
+// emptyCopy returns an empty map with the given capacity that shares the
+// hasher, codecs and options of cm.
+func (cm *ChainMap[K, V]) emptyCopy(capacity int) *ChainMap[K, V] {
+	return &ChainMap[K, V]{
+		table:       newTable[K, V](capacity),
+		capacity:    capacity,
+		hasher:      cm.hasher,
+		keyCodec:    cm.keyCodec,
+		valueCodec:  cm.valueCodec,
+		opts:        cm.opts,
+		minCapacity: cm.minCapacity,
 	}
-	defer file.Close()
+}
 
-	fmt.Fprintf(file, "%d %d\n", cm.capacity, cm.size)
+func (cm *ChainMap[K, V]) replace(other *ChainMap[K, V]) {
+	cm.table = other.table
+	cm.capacity = other.capacity
+	cm.size = other.size
+	cm.old = other.old
+	cm.rehashIndex = other.rehashIndex
+	cm.version++
+}
 
-	for i := 0; i < cm.capacity; i++ {
-		currentNode := cm.table[i].Head
-		for currentNode != nil {
-			fmt.Fprintf(file, "%s %d\n", currentNode.Key, currentNode.Data)
-			currentNode = currentNode.Next
-		}
+func (cm *ChainMap[K, V]) MarshalBinary() ([]byte, error) {
+	return persist.MarshalBinary(cm.WriteTo)
+}
+
+func (cm *ChainMap[K, V]) UnmarshalBinary(data []byte) error {
+	return persist.UnmarshalBinary(data, cm.ReadFrom)
+}
+
+// MarshalJSON encodes the map as a JSON object. Keys must be strings,
+// integers or implement encoding.TextMarshaler.
+func (cm *ChainMap[K, V]) MarshalJSON() ([]byte, error) {
+	pairs := make(map[K]V, cm.size)
+	for key, data := range cm.All() {
+		pairs[key] = data
+	}
+	return json.Marshal(pairs)
+}
+
+// UnmarshalJSON replaces the contents of the map with the members of a JSON
+// object. The map keeps its capacity and grows as usual.
+func (cm *ChainMap[K, V]) UnmarshalJSON(data []byte) error {
+	var pairs map[K]V
+	if err := json.Unmarshal(data, &pairs); err != nil {
+		return err
 	}
 
+	loaded := cm.emptyCopy(cm.capacity)
+	for key, value := range pairs {
+		loaded.Add(key, value)
+	}
+	cm.replace(loaded)
 	return nil
 }
 
-func (cm *ChainMap) ReadText(filename string) error {
+func (cm *ChainMap[K, V]) WriteBinary(filename string) error {
+	return persist.WriteFile(filename, cm.WriteTo)
+}
+
+func (cm *ChainMap[K, V]) ReadBinary(filename string) error {
 	file, err := os.Open(filename)
 	if err != nil {
 		return fmt.Errorf("не удалось открыть файл: %s", filename)
 	}
 	defer file.Close()
 
-	cm.table = nil
+	_, err = cm.ReadFrom(bufio.NewReader(file))
+	return err
+}
+
+// ReadBinaryLegacy reads a file written before the container header was
+// introduced.
+func (cm *ChainMap[K, V]) ReadBinaryLegacy(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("не удалось открыть файл: %s", filename)
+	}
+	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
+	_, err = cm.ReadLegacyFrom(bufio.NewReader(file))
+	return err
+}
 
-	if !scanner.Scan() {
-		return fmt.Errorf("неверный формат файла")
+// WriteTextTo writes a "capacity size" header and then one "key value" line
+// per pair in bucket order. Keys and values are quoted with
+// persist.QuoteField when they contain a space or cannot be written verbatim.
+func (cm *ChainMap[K, V]) WriteTextTo(w io.Writer) (int64, error) {
+	enc := persist.NewEncoder(w)
+	if err := enc.CompressText(cm.encodeOpts); err != nil {
+		return enc.Len(), err
 	}
-	fields := strings.Fields(scanner.Text())
-	if len(fields) != 2 {
-		return fmt.Errorf("неверный формат файла")
+	return cm.writeText(enc, quotedPairs)
+}
+
+// WriteCppTextTo writes the map in the format of the C++
+// ChainMap::writeText. It needs the same codecs as WriteCppTo, and keys
+// containing a newline cannot be written.
+func (cm *ChainMap[K, V]) WriteCppTextTo(w io.Writer) (int64, error) {
+	if err := cm.checkCppCodecs(); err != nil {
+		return 0, err
 	}
+	return cm.writeText(persist.NewEncoder(w), cppPairs)
+}
 
-	cm.capacity, _ = strconv.Atoi(fields[0])
-	cm.size, _ = strconv.Atoi(fields[1])
+func (cm *ChainMap[K, V]) writeText(enc *persist.Encoder, format pairFormat) (int64, error) {
+	if _, err := fmt.Fprintf(enc, "%d %d\n", cm.capacity, cm.size); err != nil {
+		return enc.Len(), err
+	}
 
-	cm.table = make([]*Bucket, cm.capacity)
-	for i := range cm.table {
-		cm.table[i] = NewBucket()
+	for currentNode := range cm.nodes() {
+		key, err := cm.keyCodec.Format(currentNode.Key)
+		if err != nil {
+			return enc.Len(), err
+		}
+		data, err := cm.valueCodec.Format(currentNode.Data)
+		if err != nil {
+			return enc.Len(), err
+		}
+		line, err := format.join(key, data)
+		if err != nil {
+			return enc.Len(), err
+		}
+		if _, err := fmt.Fprintln(enc, line); err != nil {
+			return enc.Len(), err
+		}
+	}
+
+	err := enc.Finish()
+	return enc.Len(), err
+}
+
+// ReadTextFrom replaces the contents of the map with the text data in r.
+func (cm *ChainMap[K, V]) ReadTextFrom(r io.Reader) (int64, error) {
+	dec := persist.NewDecoder(r, cm.decodeOpts)
+	if err := dec.DetectCompression(); err != nil {
+		return dec.Offset(), err
 	}
+	return cm.readText(dec, quotedPairs)
+}
+
+// ReadCppTextFrom replaces the contents of the map with a file written by
+// the C++ ChainMap::writeText, which splits every line on its last space.
+func (cm *ChainMap[K, V]) ReadCppTextFrom(r io.Reader) (int64, error) {
+	if err := cm.checkCppCodecs(); err != nil {
+		return 0, err
+	}
+	return cm.readText(persist.NewDecoder(r, cm.decodeOpts), cppPairs)
+}
 
-	for scanner.Scan() {
-		line := scanner.Text()
+func (cm *ChainMap[K, V]) readText(dec *persist.Decoder, format pairFormat) (int64, error) {
+	lines := persist.NewLineReader(dec)
+
+	if !lines.Scan() {
+		return dec.Offset(), persist.ScanFailure(lines, fmt.Errorf("неверный формат файла"))
+	}
+	fields := strings.Fields(lines.Text())
+	if len(fields) != 2 {
+		return dec.Offset(), persist.ScanFailure(lines, fmt.Errorf("неверный формат файла: заголовок %q вместо \"ёмкость размер\"", lines.Text()))
+	}
+
+	capacity, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return dec.Offset(), &persist.CorruptionError{Offset: dec.Offset(), Err: fmt.Errorf("неверная ёмкость в файле: %w", err)}
+	}
+	if capacity < 1 {
+		return dec.Offset(), &persist.CorruptionError{Offset: dec.Offset(), Err: fmt.Errorf("неверная ёмкость в файле: %d", capacity)}
+	}
+	if err := dec.CheckCapacity(capacity); err != nil {
+		return dec.Offset(), err
+	}
+	size, err := dec.ParseCount(fields[1])
+	if err != nil {
+		return dec.Offset(), err
+	}
+
+	nodes := make([]*ChainNode[K, V], 0, min(size, 1024))
+	for lines.Scan() {
+		line := lines.Text()
 		if line == "" {
 			continue
 		}
 
-		spacePos := strings.LastIndex(line, " ")
-		if spacePos == -1 {
-			return fmt.Errorf("неверный формат файла")
+		keyText, dataText, err := format.split(line)
+		if err != nil {
+			return dec.Offset(), persist.ScanFailure(lines, fmt.Errorf("неверный формат файла: %w", err))
 		}
 
-		key := line[:spacePos]
-		data, err := strconv.Atoi(line[spacePos+1:])
+		key, err := cm.keyCodec.Parse(keyText)
+		if err != nil {
+			return dec.Offset(), persist.ScanFailure(lines, fmt.Errorf("неверный ключ в файле: %w", err))
+		}
+		data, err := cm.valueCodec.Parse(dataText)
 		if err != nil {
-			return fmt.Errorf("неверный формат файла")
+			return dec.Offset(), persist.ScanFailure(lines, fmt.Errorf("неверное значение в файле: %w", err))
 		}
 
-		index := cm.hashFunction(key)
-		newNode := NewChainNode(key, data)
-		cm.appendNode(index, newNode)
+		if len(nodes) == size {
+			return dec.Offset(), &persist.CorruptionError{Offset: dec.Offset(), Err: fmt.Errorf("в файле больше %d пар", size)}
+		}
+		nodes = append(nodes, NewChainNode(key, data))
 	}
 
-	return scanner.Err()
-}
\ No newline at end of file
+	if err := dec.FinishText(lines); err != nil {
+		return dec.Offset(), err
+	}
+	if len(nodes) != size {
+		return dec.Offset(), &persist.CorruptionError{Offset: dec.Offset(), Err: fmt.Errorf("в файле %d пар вместо %d", len(nodes), size)}
+	}
+	loaded, err := cm.load(capacity, nodes)
+	if err != nil {
+		return dec.Offset(), &persist.CorruptionError{Offset: dec.Offset(), Err: err}
+	}
+
+	cm.replace(loaded)
+	return dec.Offset(), nil
+}
+
+// pairFormat puts the key and value of a pair on one line of a text file
+// and takes them apart again.
+type pairFormat struct {
+	join  func(key, value string) (string, error)
+	split func(line string) (key, value string, err error)
+}
+
+var (
+	quotedPairs = pairFormat{join: joinQuotedPair, split: splitTextPair}
+	cppPairs    = pairFormat{join: joinCppPair, split: splitLastSpace}
+)
+
+func joinQuotedPair(key, value string) (string, error) {
+	return persist.QuoteField(key) + " " + persist.QuoteField(value), nil
+}
+
+func joinCppPair(key, value string) (string, error) {
+	return persist.CppLines.Quote(key + " " + value)
+}
+
+// splitTextPair splits a "key value" line written by WriteTextTo. Keys and
+// values containing spaces are quoted; lines from files written before
+// quoting existed have a bare key that may contain spaces and a value that
+// does not, so anything else is split on the last space.
+func splitTextPair(line string) (key, value string, err error) {
+	if quoted, qerr := strconv.QuotedPrefix(line); qerr == nil {
+		if rest, ok := strings.CutPrefix(line[len(quoted):], " "); ok {
+			if value, err := splitTextValue(rest); err == nil {
+				key, _ = strconv.Unquote(quoted)
+				return key, value, nil
+			}
+		}
+	} else if key, rest, ok := strings.Cut(line, " "); ok {
+		if value, err := splitTextValue(rest); err == nil {
+			return key, value, nil
+		}
+	}
+	return splitLastSpace(line)
+}
+
+// splitTextValue parses the value field of a text line, which must be the
+// rest of the line.
+func splitTextValue(rest string) (string, error) {
+	if strings.HasPrefix(rest, `"`) {
+		return persist.UnquoteLine(rest)
+	}
+	if strings.Contains(rest, " ") {
+		return "", fmt.Errorf("значение %q без кавычек содержит пробел", rest)
+	}
+	return rest, nil
+}
+
+// splitLastSpace splits a line the way the C++ ChainMap::readText does.
+func splitLastSpace(line string) (key, value string, err error) {
+	spacePos := strings.LastIndex(line, " ")
+	if spacePos == -1 {
+		return "", "", fmt.Errorf("в строке %q нет значения", line)
+	}
+	return line[:spacePos], line[spacePos+1:], nil
+}
+
+func (cm *ChainMap[K, V]) WriteText(filename string) error {
+	return persist.WriteFile(filename, cm.WriteTextTo)
+}
+
+func (cm *ChainMap[K, V]) ReadText(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("не удалось открыть файл: %s", filename)
+	}
+	defer file.Close()
+
+	_, err = cm.ReadTextFrom(file)
+	return err
+}
+
+// ExportCSV writes the pairs to w as a two-column key,value CSV file in
+// bucket order, formatted with the map's codecs.
+func (cm *ChainMap[K, V]) ExportCSV(w io.Writer, opts persist.CSVOptions) error {
+	cw := persist.NewCSVWriter(w, opts)
+	if opts.Header {
+		if err := cw.Write([]string{"key", "value"}); err != nil {
+			return err
+		}
+	}
+	for key, data := range cm.All() {
+		keyField, err := cm.keyCodec.Format(key)
+		if err != nil {
+			return err
+		}
+		valueField, err := cm.valueCodec.Format(data)
+		if err != nil {
+			return err
+		}
+		if err := cw.Write([]string{keyField, valueField}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ImportCSV replaces the contents of the map with the key,value rows of the
+// CSV file in r, parsed with the map's codecs. Later rows win over earlier
+// ones with the same key. The map keeps its capacity and grows as usual.
+func (cm *ChainMap[K, V]) ImportCSV(r io.Reader, opts persist.CSVOptions) error {
+	dec := persist.NewDecoder(r, cm.decodeOpts)
+	loaded := cm.emptyCopy(cm.capacity)
+	err := persist.ReadCSV(dec, opts, 2, func(record []string) error {
+		key, err := cm.keyCodec.Parse(record[0])
+		if err != nil {
+			return fmt.Errorf("неверный ключ: %w", err)
+		}
+		data, err := cm.valueCodec.Parse(record[1])
+		if err != nil {
+			return fmt.Errorf("неверное значение: %w", err)
+		}
+		loaded.Add(key, data)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	cm.replace(loaded)
+	return nil
+}
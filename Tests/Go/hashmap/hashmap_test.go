@@ -2,11 +2,22 @@ package hashmap
 
 import (
 	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
+
+	"Go/persist"
+	"Go/persist/persisttest"
 )
 
 func captureOutput(f func()) string {
@@ -27,7 +38,7 @@ func captureOutput(f func()) string {
 
 func TestConstructors(t *testing.T) {
 	t.Run("NewChainMap", func(t *testing.T) {
-		cm := NewChainMap(5)
+		cm := NewChainMap[string, int](5, nil)
 		if cm.capacity != 5 {
 			t.Errorf("NewChainMap(5) capacity = %d, want 5", cm.capacity)
 		}
@@ -53,7 +64,7 @@ func TestConstructors(t *testing.T) {
 	})
 
 	t.Run("NewBucket", func(t *testing.T) {
-		bucket := NewBucket()
+		bucket := NewBucket[string, int]()
 		if bucket.Head != nil {
 			t.Errorf("NewBucket head = %v, want nil", bucket.Head)
 		}
@@ -61,7 +72,7 @@ func TestConstructors(t *testing.T) {
 }
 
 func TestHashFunction(t *testing.T) {
-	cm := NewChainMap(10)
+	cm := NewChainMap[string, int](10, nil)
 	
 	for i := 0; i < 100; i++ {
 		key := fmt.Sprintf("key%d", i)
@@ -83,7 +94,7 @@ func TestHashFunction(t *testing.T) {
 
 func TestCoreOperations(t *testing.T) {
 	t.Run("Add", func(t *testing.T) {
-		cm := NewChainMap(5)
+		cm := NewChainMap[string, int](5, nil)
 		
 		cm.Add("key1", 10)
 		cm.Add("key2", 20)
@@ -116,7 +127,7 @@ func TestCoreOperations(t *testing.T) {
 	})
 
 	t.Run("Del", func(t *testing.T) {
-		cm := NewChainMap(5)
+		cm := NewChainMap[string, int](5, nil)
 		cm.Add("key1", 10)
 		cm.Add("key2", 20)
 		cm.Add("key3", 30)
@@ -144,7 +155,7 @@ func TestCoreOperations(t *testing.T) {
 	})
 
 	t.Run("Find", func(t *testing.T) {
-		cm := NewChainMap(5)
+		cm := NewChainMap[string, int](5, nil)
 		cm.Add("key1", 10)
 		cm.Add("key2", 20)
 		
@@ -163,7 +174,7 @@ func TestCoreOperations(t *testing.T) {
 	})
 
 	t.Run("IsContain", func(t *testing.T) {
-		cm := NewChainMap(5)
+		cm := NewChainMap[string, int](5, nil)
 		cm.Add("key1", 10)
 		
 		if !cm.IsContain("key1") {
@@ -176,7 +187,7 @@ func TestCoreOperations(t *testing.T) {
 	})
 
 	t.Run("Rehashing", func(t *testing.T) {
-		cm := NewChainMap(2)
+		cm := NewChainMap[string, int](2, nil)
 		
 		for i := 0; i < 2; i++ {
 			cm.Add(fmt.Sprintf("key%d", i), i)
@@ -202,7 +213,7 @@ func TestCoreOperations(t *testing.T) {
 }
 
 func TestCollisionHandling(t *testing.T) {
-	cm := NewChainMap(3)
+	cm := NewChainMap[string, int](3, nil)
 	
 	keys := []string{"abc", "def", "ghi", "jkl", "mno"}
 	for i, key := range keys {
@@ -238,12 +249,12 @@ func TestCollisionHandling(t *testing.T) {
 }
 
 func TestGetAllKeys(t *testing.T) {
-	cm := NewChainMap(5)
+	cm := NewChainMap[string, int](5, nil)
 	cm.Add("key1", 10)
 	cm.Add("key2", 20)
 	cm.Add("key3", 30)
 	
-	result := NewChainMap(5)
+	result := NewChainMap[string, int](5, nil)
 	cm.GetAllKeys(result)
 	
 	if result.size != 3 {
@@ -259,7 +270,7 @@ func TestGetAllKeys(t *testing.T) {
 }
 
 func TestGetAllKeysAsString(t *testing.T) {
-	cm := NewChainMap(5)
+	cm := NewChainMap[string, int](5, nil)
 	cm.Add("key1", 10)
 	cm.Add("key2", 20)
 	cm.Add("key3", 30)
@@ -280,7 +291,7 @@ func TestFileOperations(t *testing.T) {
 	t.Run("BinaryFileOperations", func(t *testing.T) {
 		binFile := filepath.Join(tempDir, "test.bin")
 		
-		original := NewChainMap(5)
+		original := NewChainMap[string, int](5, nil)
 		original.Add("key1", 10)
 		original.Add("key2", 20)
 		original.Add("key3", 30)
@@ -291,7 +302,7 @@ func TestFileOperations(t *testing.T) {
 			t.Fatalf("WriteBinary() failed: %v", err)
 		}
 		
-		readMap := NewChainMap(1)
+		readMap := NewChainMap[string, int](1, nil)
 		if err := readMap.ReadBinary(binFile); err != nil {
 			t.Fatalf("ReadBinary() failed: %v", err)
 		}
@@ -320,7 +331,7 @@ func TestFileOperations(t *testing.T) {
 	t.Run("TextFileOperations", func(t *testing.T) {
 		txtFile := filepath.Join(tempDir, "test.txt")
 		
-		original := NewChainMap(5)
+		original := NewChainMap[string, int](5, nil)
 		original.Add("key1", 10)
 		original.Add("key2", 20)
 		original.Add("key3", 30)
@@ -331,7 +342,7 @@ func TestFileOperations(t *testing.T) {
 			t.Fatalf("WriteText() failed: %v", err)
 		}
 		
-		readMap := NewChainMap(1)
+		readMap := NewChainMap[string, int](1, nil)
 		if err := readMap.ReadText(txtFile); err != nil {
 			t.Fatalf("ReadText() failed: %v", err)
 		}
@@ -360,7 +371,7 @@ func TestFileOperations(t *testing.T) {
 
 func TestEdgeCases(t *testing.T) {
 	t.Run("EmptyMap", func(t *testing.T) {
-		cm := NewChainMap(5)
+		cm := NewChainMap[string, int](5, nil)
 		
 		if cm.size != 0 {
 			t.Errorf("Empty map size = %d, want 0", cm.size)
@@ -382,7 +393,7 @@ func TestEdgeCases(t *testing.T) {
 	})
 	
 	t.Run("LargeValues", func(t *testing.T) {
-		cm := NewChainMap(5)
+		cm := NewChainMap[string, int](5, nil)
 		
 		cm.Add("large", 2147483647)
 		data, err := cm.Find("large")
@@ -404,7 +415,7 @@ func TestEdgeCases(t *testing.T) {
 	})
 	
 	t.Run("EmptyStrings", func(t *testing.T) {
-		cm := NewChainMap(5)
+		cm := NewChainMap[string, int](5, nil)
 		
 		cm.Add("", 42)
 		if !cm.IsContain("") {
@@ -430,7 +441,7 @@ func TestEdgeCases(t *testing.T) {
 	})
 	
 	t.Run("CollisionHandling", func(t *testing.T) {
-		cm := NewChainMap(1)
+		cm := NewChainMap[string, int](1, nil)
 		
 		for i := 0; i < 10; i++ {
 			key := fmt.Sprintf("key%d", i)
@@ -470,7 +481,7 @@ func TestEdgeCases(t *testing.T) {
 }
 
 func TestPrintContents(t *testing.T) {
-	cm := NewChainMap(3)
+	cm := NewChainMap[string, int](3, nil)
 	cm.Add("key1", 10)
 	cm.Add("key2", 20)
 	cm.Add("key3", 30)
@@ -495,7 +506,7 @@ func TestPrintContents(t *testing.T) {
 }
 
 func TestAppendNode(t *testing.T) {
-	cm := NewChainMap(1)
+	cm := NewChainMap[string, int](1, nil)
 	
 	cm.Add("key1", 10)
 	cm.Add("key2", 20)
@@ -507,7 +518,7 @@ func TestAppendNode(t *testing.T) {
 }
 
 func TestFindError(t *testing.T) {
-	cm := NewChainMap(5)
+	cm := NewChainMap[string, int](5, nil)
 	
 	_, err := cm.Find("nonexistent")
 	if err == nil {
@@ -521,7 +532,7 @@ func TestFindError(t *testing.T) {
 }
 
 func TestRehashingComplex(t *testing.T) {
-	cm := NewChainMap(2)
+	cm := NewChainMap[string, int](2, nil)
 	
 	for i := 0; i < 5; i++ {
 		cm.Add(fmt.Sprintf("key%d", i), i)
@@ -555,4 +566,769 @@ func TestRehashingComplex(t *testing.T) {
 			t.Errorf("Find('%s') = %d, want %d", kv.key, data, kv.value)
 		}
 	}
-}
\ No newline at end of file
+}
+
+// checkContents compares the map against want through every lookup method
+// and through iteration.
+func checkContents(t *testing.T, cm *ChainMap[int, int], want map[int]int) {
+	t.Helper()
+	if cm.size != len(want) {
+		t.Fatalf("size = %d, want %d", cm.size, len(want))
+	}
+	for key, value := range want {
+		if got, err := cm.Find(key); err != nil || got != value {
+			t.Fatalf("Find(%d) = %d, %v, want %d", key, got, err, value)
+		}
+	}
+	if got := maps.Collect(cm.All()); !maps.Equal(got, want) {
+		t.Fatalf("All() yielded %v, want %v", got, want)
+	}
+}
+
+func TestIncrementalRehash(t *testing.T) {
+	t.Run("Progress", func(t *testing.T) {
+		cm := NewChainMap[int, int](64, nil)
+		want := map[int]int{}
+		for i := 0; i < 48; i++ {
+			cm.Add(i, i)
+			want[i] = i
+		}
+		if cm.old != nil {
+			t.Fatal("map is growing before reaching its load factor")
+		}
+
+		cm.Add(48, 48)
+		want[48] = 48
+		if cm.old == nil || cm.capacity != 128 || cm.rehashIndex < rehashStep {
+			t.Fatalf("after growing: old = %d buckets, capacity = %d, rehashIndex = %d",
+				len(cm.old), cm.capacity, cm.rehashIndex)
+		}
+		checkContents(t, cm, want)
+
+		for i := 49; cm.old != nil; i++ {
+			moved := cm.rehashIndex
+			if i%3 == 0 {
+				cm.Del(i - 40)
+				delete(want, i-40)
+			} else {
+				cm.Add(i, i)
+				want[i] = i
+			}
+			if cm.old != nil && (cm.rehashIndex <= moved || cm.rehashIndex-moved > rehashStep*(1+rehashEmptyVisits)) {
+				t.Fatalf("one call moved %d buckets", cm.rehashIndex-moved)
+			}
+			checkContents(t, cm, want)
+			if cm.IsContain(-1) {
+				t.Fatal("IsContain(-1) = true")
+			}
+		}
+	})
+
+	t.Run("ReadsDoNotMove", func(t *testing.T) {
+		cm := NewChainMap[int, int](64, nil)
+		want := map[int]int{}
+		for i := 0; i < 49; i++ {
+			cm.Add(i, i)
+			want[i] = i
+		}
+		if cm.old == nil {
+			t.Fatal("map is not growing")
+		}
+
+		// Lookups and updates in the middle of a move leave the tables alone,
+		// so the iteration sees every key exactly once.
+		seen := map[int]int{}
+		for key := range cm.All() {
+			cm.IsContain(key)
+			cm.Find(key + 100)
+			cm.Add(key, key*10)
+			seen[key]++
+		}
+		for key := range want {
+			if seen[key] != 1 {
+				t.Errorf("All() yielded %d %d times", key, seen[key])
+			}
+			want[key] *= 10
+		}
+		checkContents(t, cm, want)
+	})
+
+	t.Run("GrowWhileGrowing", func(t *testing.T) {
+		// With a constant hasher every key lands in one bucket, so the table
+		// fills up long before the move that follows each growth ends.
+		cm := NewChainMap[int, int](256, func(int) uint64 { return 0 })
+		want := map[int]int{}
+		for i := 0; i < 1000; i++ {
+			cm.Add(i, i)
+			want[i] = i
+		}
+		cm.old = cm.table
+		cm.rehashIndex = 0
+		cm.capacity *= 2
+		cm.table = newTable[int, int](cm.capacity)
+		checkContents(t, cm, want)
+		cm.resize(cm.capacity * 2)
+		if cm.rehashIndex != 0 || len(cm.old) != cm.capacity/2 {
+			t.Fatalf("resize() did not finish the previous move first")
+		}
+		checkContents(t, cm, want)
+	})
+
+	t.Run("SaveWhileGrowing", func(t *testing.T) {
+		cm := NewChainMap[int, int](64, nil)
+		want := map[int]int{}
+		for i := 0; i < 49; i++ {
+			cm.Add(i, -i)
+			want[i] = -i
+		}
+		if cm.old == nil {
+			t.Fatal("map is not growing")
+		}
+
+		data, err := cm.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary() failed: %v", err)
+		}
+		loaded := NewChainMap[int, int](1, nil)
+		if err := loaded.UnmarshalBinary(data); err != nil {
+			t.Fatalf("UnmarshalBinary() failed: %v", err)
+		}
+		checkContents(t, loaded, want)
+
+		var text bytes.Buffer
+		if _, err := cm.WriteTextTo(&text); err != nil {
+			t.Fatalf("WriteTextTo() failed: %v", err)
+		}
+		if _, err := loaded.ReadTextFrom(&text); err != nil {
+			t.Fatalf("ReadTextFrom() failed: %v", err)
+		}
+		checkContents(t, loaded, want)
+
+		output := captureOutput(cm.PrintContents)
+		if cm.old != nil || strings.Count(output, "->") != len(want) {
+			t.Errorf("PrintContents() printed %d pairs mid-move", strings.Count(output, "->"))
+		}
+	})
+}
+
+func TestResizing(t *testing.T) {
+	t.Run("Shrink", func(t *testing.T) {
+		cm := NewChainMap[int, int](4, nil)
+		want := map[int]int{}
+		for i := 0; i < 1000; i++ {
+			cm.Add(i, i)
+			want[i] = i
+		}
+		peak := cm.capacity
+		for i := 0; i < 995; i++ {
+			cm.Del(i)
+			delete(want, i)
+		}
+		checkContents(t, cm, want)
+		if cm.capacity >= peak/8 {
+			t.Errorf("capacity = %d after deleting almost everything, peak was %d", cm.capacity, peak)
+		}
+		for i := 995; i < 1000; i++ {
+			cm.Del(i)
+		}
+		cm.finishRehash()
+		if cm.capacity != 4 {
+			t.Errorf("capacity of the emptied map = %d, want the initial 4", cm.capacity)
+		}
+		checkContents(t, cm, map[int]int{})
+	})
+
+	t.Run("Options", func(t *testing.T) {
+		cm := NewChainMap[int, int](4, nil, Options{GrowAt: 2, ShrinkAt: -1})
+		for i := 0; i < 8; i++ {
+			cm.Add(i, i)
+		}
+		if cm.capacity != 4 || cm.LoadFactor() != 2 {
+			t.Errorf("capacity = %d, load factor %v; want 4 and 2 with GrowAt 2", cm.capacity, cm.LoadFactor())
+		}
+		cm.Add(8, 8)
+		if cm.capacity != 8 {
+			t.Errorf("capacity = %d after going over GrowAt, want 8", cm.capacity)
+		}
+		for i := 0; i < 9; i++ {
+			cm.Del(i)
+		}
+		if cm.capacity != 8 {
+			t.Errorf("capacity = %d with shrinking disabled, want 8", cm.capacity)
+		}
+
+		for _, opts := range []Options{{GrowAt: -1}, {GrowAt: 1, ShrinkAt: 0.5}, {ShrinkAt: 0.5}} {
+			func() {
+				defer func() {
+					if recover() == nil {
+						t.Errorf("NewChainMap() with %+v did not panic", opts)
+					}
+				}()
+				NewChainMap[int, int](4, nil, opts)
+			}()
+		}
+	})
+
+	t.Run("Reserve", func(t *testing.T) {
+		cm := NewChainMap[int, int](4, nil)
+		cm.Add(-1, -1)
+		cm.Reserve(1000)
+		capacity := cm.capacity
+		if cm.old != nil || float64(999) >= float64(capacity)*DefaultOptions.GrowAt {
+			t.Fatalf("Reserve(1000) left capacity %d", capacity)
+		}
+		for i := 0; i < 999; i++ {
+			cm.Add(i, i)
+		}
+		if cm.capacity != capacity {
+			t.Errorf("capacity = %d after filling the reserved room, want %d", cm.capacity, capacity)
+		}
+		for i := -1; i < 999; i++ {
+			cm.Del(i)
+		}
+		if cm.capacity != capacity {
+			t.Errorf("capacity = %d after emptying, want the reserved %d", cm.capacity, capacity)
+		}
+		cm.Reserve(10)
+		if cm.capacity != capacity {
+			t.Errorf("Reserve(10) changed the capacity to %d", cm.capacity)
+		}
+	})
+
+	t.Run("ShrinkToFit", func(t *testing.T) {
+		cm := NewChainMap[int, int](1024, nil)
+		want := map[int]int{}
+		for i := 0; i < 30; i++ {
+			cm.Add(i, i)
+			want[i] = i
+		}
+		cm.ShrinkToFit()
+		if cm.old != nil || cm.capacity != 39 {
+			t.Errorf("ShrinkToFit() left capacity %d, want 39", cm.capacity)
+		}
+		checkContents(t, cm, want)
+		cm.Add(30, 30)
+		if cm.capacity != 78 {
+			t.Errorf("capacity = %d after adding one more key, want 78", cm.capacity)
+		}
+
+		empty := NewChainMap[int, int](16, nil)
+		empty.ShrinkToFit()
+		if empty.capacity != 1 || empty.LoadFactor() != 0 {
+			t.Errorf("ShrinkToFit() of an empty map left capacity %d", empty.capacity)
+		}
+		empty.Add(1, 1)
+		empty.Add(2, 2)
+		checkContents(t, empty, map[int]int{1: 1, 2: 2})
+	})
+}
+
+type profile struct {
+	Name  string
+	Score float64
+}
+
+func TestGenericTypes(t *testing.T) {
+	tempDir := t.TempDir()
+
+	t.Run("StructValues", func(t *testing.T) {
+		cm := NewChainMap[userID, profile](2, nil)
+		for i := 0; i < 20; i++ {
+			cm.Add(userID(i), profile{Name: fmt.Sprintf("user%d", i), Score: float64(i) / 2})
+		}
+		got, err := cm.Find(7)
+		if err != nil || got.Name != "user7" || got.Score != 3.5 {
+			t.Errorf("Find(7) = %+v, %v", got, err)
+		}
+
+		for _, name := range []string{"profiles.bin", "profiles.txt"} {
+			filename := filepath.Join(tempDir, name)
+			loaded := NewChainMap[userID, profile](1, nil)
+			var err error
+			if filepath.Ext(name) == ".bin" {
+				if err = cm.WriteBinary(filename); err == nil {
+					err = loaded.ReadBinary(filename)
+				}
+			} else {
+				if err = cm.WriteText(filename); err == nil {
+					err = loaded.ReadText(filename)
+				}
+			}
+			if err != nil {
+				t.Fatalf("%s round trip failed: %v", name, err)
+			}
+			if loaded.size != 20 {
+				t.Errorf("%s size = %d, want 20", name, loaded.size)
+			}
+			for i := 0; i < 20; i++ {
+				want, _ := cm.Find(userID(i))
+				if got, err := loaded.Find(userID(i)); err != nil || got != want {
+					t.Errorf("%s Find(%d) = %+v, %v; want %+v", name, i, got, err, want)
+				}
+			}
+		}
+	})
+
+	t.Run("CustomHasher", func(t *testing.T) {
+		hasher := func(key compositeKey) uint64 {
+			return FNV(key.Tenant) ^ uint64(key.ID)
+		}
+		cm := NewChainMap[compositeKey, string](4, hasher)
+		cm.Add(compositeKey{"acme", 1}, "first")
+		cm.Add(compositeKey{"acme", 2}, "second")
+		cm.Add(compositeKey{"acme", 1}, "updated")
+
+		if cm.size != 2 {
+			t.Errorf("size = %d, want 2", cm.size)
+		}
+		if got, _ := cm.Find(compositeKey{"acme", 1}); got != "updated" {
+			t.Errorf("Find() = %q, want %q", got, "updated")
+		}
+		cm.Del(compositeKey{"acme", 2})
+		if cm.IsContain(compositeKey{"acme", 2}) {
+			t.Error("IsContain() = true after Del()")
+		}
+		if _, err := cm.Find(compositeKey{"other", 1}); err == nil {
+			t.Error("Find() of missing key returned nil error")
+		}
+	})
+
+	t.Run("ConstantHasher", func(t *testing.T) {
+		cm := NewChainMap[string, int](8, func(string) uint64 { return 3 })
+		for i := 0; i < 10; i++ {
+			cm.Add(fmt.Sprintf("key%d", i), i)
+		}
+		for i := 0; i < cm.capacity; i++ {
+			if i != 3 && cm.table[i].Head != nil {
+				t.Fatalf("bucket %d is not empty with a constant hasher", i)
+			}
+		}
+		for i := 0; i < 10; i++ {
+			if got, _ := cm.Find(fmt.Sprintf("key%d", i)); got != i {
+				t.Errorf("Find(key%d) = %d", i, got)
+			}
+		}
+	})
+
+	t.Run("LegacyBinaryLayout", func(t *testing.T) {
+		cm := NewChainMap[string, int](1, nil)
+		cm.Add("ab", -2)
+		filename := filepath.Join(tempDir, "layout.bin")
+		if err := cm.WriteBinary(filename); err != nil {
+			t.Fatalf("WriteBinary() failed: %v", err)
+		}
+		content, _ := os.ReadFile(filename)
+		legacy := []byte{
+			1, 0, 0, 0, 0, 0, 0, 0,
+			1, 0, 0, 0, 0, 0, 0, 0,
+			2, 0, 0, 0, 0, 0, 0, 0, 'a', 'b',
+			0xfe, 0xff, 0xff, 0xff,
+		}
+		header := []byte{'L', 'T', 'C', 'F', persist.Version, byte(persist.TypeChainMap),
+			byte(persist.EncodingString64), byte(persist.EncodingInt32), byte(persist.FlagChecksum), 0}
+		body := content[:len(content)-persist.ChecksumSize]
+		if want := append(header, legacy...); !bytes.Equal(body, want) {
+			t.Errorf("WriteBinary() = %v, want %v followed by a checksum", content, want)
+		}
+
+		os.WriteFile(filename, legacy, 0644)
+		loaded := NewChainMap[string, int](1, nil)
+		if err := loaded.ReadBinary(filename); !errors.Is(err, persist.ErrNoHeader) {
+			t.Errorf("ReadBinary() of headerless file = %v, want ErrNoHeader", err)
+		}
+		if err := loaded.ReadBinaryLegacy(filename); err != nil {
+			t.Fatalf("ReadBinaryLegacy() failed: %v", err)
+		}
+		if got, _ := loaded.Find("ab"); got != -2 {
+			t.Errorf("Find(ab) after ReadBinaryLegacy() = %d, want -2", got)
+		}
+	})
+
+	t.Run("ValueOutOfRange", func(t *testing.T) {
+		cm := NewChainMap[string, int](1, nil)
+		existing := filepath.Join(tempDir, "big.bin")
+		if err := cm.WriteBinary(existing); err != nil {
+			t.Fatalf("WriteBinary() of an empty map failed: %v", err)
+		}
+		before, _ := os.ReadFile(existing)
+		cm.Add("big", 1<<40)
+		if err := cm.WriteBinary(existing); err == nil {
+			t.Error("WriteBinary() of a value over 32 bits returned nil error")
+		}
+		if after, _ := os.ReadFile(existing); !bytes.Equal(after, before) {
+			t.Errorf("failed WriteBinary() changed the existing file to %v, want %v", after, before)
+		}
+		cm.SetCodecs(persist.String64, persist.Int)
+		filename := filepath.Join(tempDir, "big64.bin")
+		if err := cm.WriteBinary(filename); err != nil {
+			t.Fatalf("WriteBinary() with Int codec failed: %v", err)
+		}
+		loaded := NewChainMap[string, int](1, nil)
+		loaded.SetCodecs(persist.String64, persist.Int)
+		if err := loaded.ReadBinary(filename); err != nil {
+			t.Fatalf("ReadBinary() failed: %v", err)
+		}
+		if got, _ := loaded.Find("big"); got != 1<<40 {
+			t.Errorf("Find(big) = %d, want %d", got, 1<<40)
+		}
+	})
+
+	t.Run("InvalidCapacity", func(t *testing.T) {
+		filename := filepath.Join(tempDir, "zero_capacity.bin")
+		os.WriteFile(filename, make([]byte, 16), 0644)
+		cm := NewChainMap[string, int](1, nil)
+		if err := cm.ReadBinary(filename); err == nil {
+			t.Error("ReadBinary() with zero capacity returned nil error")
+		}
+
+		filename = filepath.Join(tempDir, "zero_capacity.txt")
+		os.WriteFile(filename, []byte("0 0\n"), 0644)
+		if err := cm.ReadText(filename); err == nil {
+			t.Error("ReadText() with zero capacity returned nil error")
+		}
+	})
+}
+
+func TestIterators(t *testing.T) {
+	cm := NewChainMap[string, int](2, nil)
+	want := map[string]int{}
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("key%d", i)
+		cm.Add(key, i)
+		want[key] = i
+	}
+
+	got := maps.Collect(cm.All())
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("All() = %v, want %v", got, want)
+	}
+
+	keys := slices.Sorted(cm.Keys())
+	if !reflect.DeepEqual(keys, slices.Sorted(maps.Keys(want))) {
+		t.Errorf("Keys() = %v", keys)
+	}
+	values := slices.Sorted(cm.Values())
+	if !reflect.DeepEqual(values, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}) {
+		t.Errorf("Values() = %v", values)
+	}
+
+	count := 0
+	for range cm.Keys() {
+		count++
+		if count == 3 {
+			break
+		}
+	}
+	for range cm.Values() {
+		break
+	}
+	if count != 3 {
+		t.Errorf("Keys() with break visited %d keys, want 3", count)
+	}
+
+	for key, data := range cm.All() {
+		cm.Add(key, data*10)
+		cm.Del("missing")
+	}
+	if data, _ := cm.Find("key4"); data != 40 {
+		t.Errorf("Find(key4) after updating during iteration = %d, want 40", data)
+	}
+
+	mutations := map[string]func(){
+		"AddNew":     func() { cm.Add("new key", 1) },
+		"DelPresent": func() { cm.Del("key1") },
+	}
+	for name, mutate := range mutations {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s during iteration did not panic", name)
+				}
+			}()
+			for range cm.Keys() {
+				mutate()
+			}
+		})
+	}
+
+	empty := NewChainMap[string, int](4, nil)
+	if len(maps.Collect(empty.All())) != 0 {
+		t.Error("All() on empty map yielded entries")
+	}
+}
+
+func TestReaderWriter(t *testing.T) {
+	persisttest.TestContainer(t, persisttest.Fixture[*ChainMap[string, string]]{
+		New: func() *ChainMap[string, string] { return NewChainMap[string, string](1, nil) },
+		Make: func(values []string) *ChainMap[string, string] {
+			cm := NewChainMap[string, string](4, nil)
+			for i, s := range values {
+				cm.Add(s, values[len(values)-1-i])
+			}
+			return cm
+		},
+		Contents: func(cm *ChainMap[string, string]) any { return maps.Collect(cm.All()) },
+	})
+
+	t.Run("LegacyText", func(t *testing.T) {
+		loaded := NewChainMap[string, string](1, nil)
+		input := "2 3\nkey with spaces value\n\"odd key 1\nplain \"x\n"
+		if _, err := loaded.ReadTextFrom(strings.NewReader(input)); err != nil {
+			t.Fatalf("ReadTextFrom() failed: %v", err)
+		}
+		want := map[string]string{"key with spaces": "value", `"odd key`: "1", "plain": `"x`}
+		if got := maps.Collect(loaded.All()); !reflect.DeepEqual(got, want) {
+			t.Errorf("ReadTextFrom() loaded %q, want %q", got, want)
+		}
+	})
+
+	t.Run("CapacityLimits", func(t *testing.T) {
+		original := NewChainMap[string, int](4, nil)
+		original.Add("a", 1)
+		original.Add("b c", -2)
+		original.Add("d", 3)
+		data, err := original.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary() failed: %v", err)
+		}
+		var text bytes.Buffer
+		if _, err := original.WriteTextTo(&text); err != nil {
+			t.Fatalf("WriteTextTo() failed: %v", err)
+		}
+
+		loaded := NewChainMap[string, int](1, nil)
+		loaded.SetDecodeOptions(persist.DecodeOptions{MaxHashmapCapacity: 2})
+		if err := loaded.UnmarshalBinary(data); !errors.Is(err, persist.ErrLimitExceeded) {
+			t.Errorf("UnmarshalBinary() over MaxHashmapCapacity = %v, want ErrLimitExceeded", err)
+		}
+		if _, err := loaded.ReadTextFrom(bytes.NewReader(text.Bytes())); !errors.Is(err, persist.ErrLimitExceeded) {
+			t.Errorf("ReadTextFrom() over MaxHashmapCapacity = %v, want ErrLimitExceeded", err)
+		}
+
+		huge := append([]byte(nil), data...)
+		huge[persist.HeaderSize+7] = 0x80
+		loaded.SetDecodeOptions(persist.DecodeOptions{})
+		if err := loaded.UnmarshalBinary(huge); err == nil {
+			t.Error("UnmarshalBinary() of a negative capacity returned nil error")
+		}
+	})
+
+	t.Run("Counts", func(t *testing.T) {
+		for _, text := range []string{
+			"4 -5\n",
+			"4 x\n",
+			"x 0\n",
+			"4 0\na 1\nb 2\nc 3\n",
+			"4 3\na 1\n",
+			"4 2\na 1\na 2\n",
+		} {
+			loaded := NewChainMap[string, int](1, nil)
+			var corrupt *persist.CorruptionError
+			if _, err := loaded.ReadTextFrom(strings.NewReader(text)); !errors.As(err, &corrupt) {
+				t.Errorf("ReadTextFrom(%q) = %v, want CorruptionError", text, err)
+			}
+			if loaded.size != 0 {
+				t.Errorf("failed ReadTextFrom(%q) left size = %d", text, loaded.size)
+			}
+		}
+	})
+
+	t.Run("ParseErrors", func(t *testing.T) {
+		for _, text := range []string{"x 0\n", "4 1\na x\n"} {
+			var numErr *strconv.NumError
+			if _, err := NewChainMap[string, int](1, nil).ReadTextFrom(strings.NewReader(text)); !errors.As(err, &numErr) {
+				t.Errorf("ReadTextFrom(%q) = %v, want the strconv error", text, err)
+			}
+		}
+		_, err := NewChainMap[string, int](1, nil).ReadCppTextFrom(strings.NewReader("4 1\nkey\n"))
+		if err == nil || !strings.Contains(err.Error(), `в строке "key" нет значения`) {
+			t.Errorf("ReadCppTextFrom() of a line without a value = %v", err)
+		}
+	})
+
+	t.Run("LoadedCapacity", func(t *testing.T) {
+		loaded := NewChainMap[string, int](1, nil)
+		if _, err := loaded.ReadTextFrom(strings.NewReader("16777216 0\n")); err != nil {
+			t.Fatalf("ReadTextFrom() of a huge empty table failed: %v", err)
+		}
+		if loaded.capacity > maxLoadedBucketsPerKey {
+			t.Errorf("empty map declaring 16777216 buckets loaded with capacity %d", loaded.capacity)
+		}
+
+		const n = 1000
+		original := NewChainMap[string, int](1, nil)
+		for i := range n {
+			original.Add(strconv.Itoa(i), i)
+		}
+		var text bytes.Buffer
+		if _, err := original.WriteTextTo(&text); err != nil {
+			t.Fatalf("WriteTextTo() failed: %v", err)
+		}
+		_, rest, _ := strings.Cut(text.String(), "\n")
+		data, err := original.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary() failed: %v", err)
+		}
+		legacy := bytes.Clone(data[persist.HeaderSize : len(data)-persist.ChecksumSize])
+		binary.LittleEndian.PutUint64(legacy, 1)
+
+		fromText := NewChainMap[string, int](1, nil)
+		if _, err := fromText.ReadTextFrom(strings.NewReader("1 1000\n" + rest)); err != nil {
+			t.Fatalf("ReadTextFrom() of a one-bucket table failed: %v", err)
+		}
+		fromBinary := NewChainMap[string, int](1, nil)
+		if _, err := fromBinary.ReadLegacyFrom(bytes.NewReader(legacy)); err != nil {
+			t.Fatalf("ReadLegacyFrom() of a one-bucket table failed: %v", err)
+		}
+		for name, cm := range map[string]*ChainMap[string, int]{"text": fromText, "binary": fromBinary} {
+			if cm.size != n || cm.capacity < cm.fitCapacity(n) {
+				t.Errorf("%s one-bucket table loaded %d keys into %d buckets", name, cm.size, cm.capacity)
+			}
+		}
+	})
+}
+
+func TestJSON(t *testing.T) {
+	cm := NewChainMap[string, int](2, nil)
+	cm.Add("b", 2)
+	cm.Add("a", 1)
+	cm.Add("c d", 3)
+	data, err := json.Marshal(cm)
+	if err != nil {
+		t.Fatalf("json.Marshal() failed: %v", err)
+	}
+	if string(data) != `{"a":1,"b":2,"c d":3}` {
+		t.Errorf("json.Marshal() = %s", data)
+	}
+
+	loaded := NewChainMap[string, int](1, nil)
+	loaded.Add("old", 0)
+	if err := json.Unmarshal(data, loaded); err != nil {
+		t.Fatalf("json.Unmarshal() failed: %v", err)
+	}
+	if got := maps.Collect(loaded.All()); !reflect.DeepEqual(got, map[string]int{"a": 1, "b": 2, "c d": 3}) {
+		t.Errorf("json.Unmarshal() loaded %v", got)
+	}
+
+	ints := NewChainMap[int, string](4, nil)
+	ints.Add(10, "ten")
+	if data, _ := json.Marshal(ints); string(data) != `{"10":"ten"}` {
+		t.Errorf("json.Marshal() with int keys = %s", data)
+	}
+
+	if err := json.Unmarshal([]byte(`{"a":"x"}`), loaded); err == nil {
+		t.Error("json.Unmarshal() of a mistyped value returned nil error")
+	}
+	if loaded.size != 3 {
+		t.Errorf("failed json.Unmarshal() changed the size to %d", loaded.size)
+	}
+}
+
+func TestCSV(t *testing.T) {
+	original := NewChainMap[string, int](4, nil)
+	original.Add("a", 1)
+	original.Add("b,c", -2)
+	original.Add("d\ne", 3)
+	var buf bytes.Buffer
+	if err := original.ExportCSV(&buf, persist.CSVOptions{Header: true}); err != nil {
+		t.Fatalf("ExportCSV() failed: %v", err)
+	}
+	if !strings.HasPrefix(buf.String(), "key,value\n") || !strings.Contains(buf.String(), "\"b,c\",-2\n") {
+		t.Errorf("ExportCSV() wrote %q", buf.String())
+	}
+
+	loaded := NewChainMap[string, int](1, nil)
+	if err := loaded.ImportCSV(&buf, persist.CSVOptions{Header: true}); err != nil {
+		t.Fatalf("ImportCSV() failed: %v", err)
+	}
+	want := maps.Collect(original.All())
+	if got := maps.Collect(loaded.All()); !reflect.DeepEqual(got, want) {
+		t.Errorf("ImportCSV() loaded %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		row   int
+	}{
+		{"BadValue", "a,1\nb,two\n", 2},
+		{"OneColumn", "a\n", 1},
+		{"FieldCount", "a,1\nb,2,3\n", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rowErr *persist.RowError
+			err := loaded.ImportCSV(strings.NewReader(tt.input), persist.CSVOptions{})
+			if !errors.As(err, &rowErr) || rowErr.Row != tt.row {
+				t.Errorf("ImportCSV() = %v, want an error for row %d", err, tt.row)
+			}
+			if got := maps.Collect(loaded.All()); !reflect.DeepEqual(got, want) {
+				t.Errorf("failed ImportCSV() changed the map to %v", got)
+			}
+		})
+	}
+
+	if err := loaded.ImportCSV(strings.NewReader("x,1\nx,2\n"), persist.CSVOptions{}); err != nil {
+		t.Fatalf("ImportCSV() with a repeated key failed: %v", err)
+	}
+	if got := maps.Collect(loaded.All()); !reflect.DeepEqual(got, map[string]int{"x": 2}) {
+		t.Errorf("ImportCSV() with a repeated key loaded %v", got)
+	}
+}
+
+// TestCppGolden checks the C++ formats against files written by the C++
+// ChainMap; see Serialization/C++/Golden. Go and C++ hash keys differently,
+// so output is compared byte for byte only for the single-pair map.
+func TestCppGolden(t *testing.T) {
+	tests := []struct {
+		file  string
+		want  map[string]int
+		write func(*ChainMap[string, int], io.Writer) (int64, error)
+		read  func(*ChainMap[string, int], io.Reader) (int64, error)
+	}{
+		{"chainmap.bin", map[string]int{"alpha": 1, "b c": -2, "юникод": 2147483647},
+			(*ChainMap[string, int]).WriteCppTo, (*ChainMap[string, int]).ReadCppFrom},
+		{"chainmap.txt", map[string]int{"alpha": 1, "b c": -2, "юникод": 2147483647},
+			(*ChainMap[string, int]).WriteCppTextTo, (*ChainMap[string, int]).ReadCppTextFrom},
+		{"chainmap_single.bin", map[string]int{"key with spaces": -7},
+			(*ChainMap[string, int]).WriteCppTo, (*ChainMap[string, int]).ReadCppFrom},
+		{"chainmap_single.txt", map[string]int{"key with spaces": -7},
+			(*ChainMap[string, int]).WriteCppTextTo, (*ChainMap[string, int]).ReadCppTextFrom},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			golden, err := os.ReadFile(filepath.Join("testdata", "cpp", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			loaded := NewChainMap[string, int](1, nil)
+			if _, err := tt.read(loaded, bytes.NewReader(golden)); err != nil {
+				t.Fatalf("reading the C++ file failed: %v", err)
+			}
+			if got := maps.Collect(loaded.All()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("read %v, want %v", got, tt.want)
+			}
+			if loaded.capacity != 4 {
+				t.Errorf("read capacity %d, want 4", loaded.capacity)
+			}
+
+			var buf bytes.Buffer
+			if _, err := tt.write(loaded, &buf); err != nil {
+				t.Fatalf("writing the C++ format failed: %v", err)
+			}
+			if len(tt.want) == 1 && !bytes.Equal(buf.Bytes(), golden) {
+				t.Errorf("wrote\n%q\nwant\n%q", buf.Bytes(), golden)
+			}
+			if len(buf.Bytes()) != len(golden) {
+				t.Errorf("wrote %d bytes, want %d", buf.Len(), len(golden))
+			}
+		})
+	}
+
+	wide := NewChainMap[string, int](4, nil)
+	wide.SetCodecs(persist.String, persist.Int)
+	if _, err := wide.WriteCppTo(io.Discard); err == nil {
+		t.Error("WriteCppTo() with 32-bit key lengths succeeded")
+	}
+}
@@ -0,0 +1,372 @@
+package hashmap
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"iter"
+	"math/bits"
+	"os"
+
+	"Go/persist"
+)
+
+// robinHoodMaxLoad is the share of slots a RobinHoodMap fills before it
+// doubles. Robin Hood probing keeps probe sequences short even this full.
+const robinHoodMaxLoad = 0.875
+
+// minRobinHoodCapacity is the smallest slot table a RobinHoodMap uses.
+const minRobinHoodCapacity = 8
+
+// robinHoodSlot is one entry of the flat slot table. dist is the distance of
+// the slot from the key's home slot plus one, so that zero marks an empty
+// slot.
+type robinHoodSlot[K comparable, V any] struct {
+	key  K
+	data V
+	hash uint64
+	dist uint32
+}
+
+// RobinHoodMap is a hash map with the same methods as ChainMap that keeps its
+// entries in one flat slot table instead of a linked list per bucket. It uses
+// linear probing with Robin Hood displacement: an insert takes the slot of any
+// entry that sits closer to its home slot than the new one, which keeps every
+// key near its home and lets lookups stop early. Deletes shift the following
+// entries back instead of leaving tombstones.
+//
+// Its binary files use the ChainMap format, so either map can read the files
+// of the other.
+type RobinHoodMap[K comparable, V any] struct {
+	slots      []robinHoodSlot[K, V]
+	size       int
+	hasher     Hasher[K]
+	keyCodec   persist.Codec[K]
+	valueCodec persist.Codec[V]
+	version    int
+	encodeOpts persist.EncodeOptions
+	decodeOpts persist.DecodeOptions
+}
+
+// NewRobinHoodMap creates a map with room for at least initialCapacity slots,
+// rounded up to a power of two. A nil hasher selects a randomly seeded
+// SeededHasher, which panics for key types it cannot hash.
+func NewRobinHoodMap[K comparable, V any](initialCapacity int, hasher Hasher[K]) *RobinHoodMap[K, V] {
+	if hasher == nil {
+		hasher = SeededHasher[K](0)
+	}
+	if hasher == nil {
+		var zero K
+		panic(fmt.Sprintf("hashmap: нет хеш-функции по умолчанию для ключей типа %T", zero))
+	}
+	return &RobinHoodMap[K, V]{
+		slots:      make([]robinHoodSlot[K, V], robinHoodCapacity(initialCapacity)),
+		hasher:     hasher,
+		keyCodec:   defaultKeyCodec[K](),
+		valueCodec: defaultValueCodec[V](),
+	}
+}
+
+// robinHoodCapacity rounds n up to a power of two no smaller than
+// minRobinHoodCapacity.
+func robinHoodCapacity(n int) int {
+	if n <= minRobinHoodCapacity {
+		return minRobinHoodCapacity
+	}
+	return 1 << bits.Len(uint(n-1))
+}
+
+// SetCodecs changes how keys and values are encoded by the Write*/Read*
+// methods.
+func (rm *RobinHoodMap[K, V]) SetCodecs(keyCodec persist.Codec[K], valueCodec persist.Codec[V]) {
+	rm.keyCodec = keyCodec
+	rm.valueCodec = valueCodec
+}
+
+// Size returns the number of keys in the map.
+func (rm *RobinHoodMap[K, V]) Size() int {
+	return rm.size
+}
+
+// Capacity returns the number of slots in the table.
+func (rm *RobinHoodMap[K, V]) Capacity() int {
+	return len(rm.slots)
+}
+
+func (rm *RobinHoodMap[K, V]) mask() uint64 {
+	return uint64(len(rm.slots) - 1)
+}
+
+// lookup returns the slot index of key, or -1 if the map does not hold it.
+func (rm *RobinHoodMap[K, V]) lookup(key K) int {
+	hash := rm.hasher(key)
+	mask := rm.mask()
+	index := hash & mask
+	for dist := uint32(1); ; dist++ {
+		slot := &rm.slots[index]
+		// An entry closer to its home than we are to ours would have been
+		// displaced by key, so key cannot be further along.
+		if slot.dist < dist {
+			return -1
+		}
+		if slot.hash == hash && slot.key == key {
+			return int(index)
+		}
+		index = (index + 1) & mask
+	}
+}
+
+// insert places a key that is not in the map yet.
+func (rm *RobinHoodMap[K, V]) insert(key K, data V, hash uint64) {
+	entry := robinHoodSlot[K, V]{key: key, data: data, hash: hash, dist: 1}
+	mask := rm.mask()
+	index := hash & mask
+	for {
+		slot := &rm.slots[index]
+		if slot.dist == 0 {
+			*slot = entry
+			rm.size++
+			return
+		}
+		if slot.dist < entry.dist {
+			*slot, entry = entry, *slot
+		}
+		index = (index + 1) & mask
+		entry.dist++
+	}
+}
+
+func (rm *RobinHoodMap[K, V]) resize(capacity int) {
+	old := rm.slots
+	rm.slots = make([]robinHoodSlot[K, V], capacity)
+	rm.size = 0
+	for i := range old {
+		if old[i].dist != 0 {
+			rm.insert(old[i].key, old[i].data, old[i].hash)
+		}
+	}
+	rm.version++
+}
+
+func (rm *RobinHoodMap[K, V]) Add(key K, data V) {
+	if index := rm.lookup(key); index >= 0 {
+		rm.slots[index].data = data
+		return
+	}
+	if float64(rm.size+1) > float64(len(rm.slots))*robinHoodMaxLoad {
+		rm.resize(len(rm.slots) * 2)
+	}
+	rm.insert(key, data, rm.hasher(key))
+	rm.version++
+}
+
+// Del removes key and shifts the entries after it one slot back until one
+// is already in its home slot, so no tombstone is left behind.
+func (rm *RobinHoodMap[K, V]) Del(key K) {
+	index := rm.lookup(key)
+	if index < 0 {
+		return
+	}
+	mask := rm.mask()
+	hole := uint64(index)
+	next := (hole + 1) & mask
+	for rm.slots[next].dist > 1 {
+		rm.slots[hole] = rm.slots[next]
+		rm.slots[hole].dist--
+		hole = next
+		next = (next + 1) & mask
+	}
+	rm.slots[hole] = robinHoodSlot[K, V]{}
+	rm.size--
+	rm.version++
+}
+
+func (rm *RobinHoodMap[K, V]) IsContain(key K) bool {
+	return rm.lookup(key) >= 0
+}
+
+func (rm *RobinHoodMap[K, V]) Find(key K) (V, error) {
+	if index := rm.lookup(key); index >= 0 {
+		return rm.slots[index].data, nil
+	}
+	var zero V
+	return zero, fmt.Errorf("в словаре нет такого ключа")
+}
+
+func (rm *RobinHoodMap[K, V]) GetAllKeys(result *ChainMap[K, int]) {
+	for key := range rm.All() {
+		result.Add(key, 1)
+	}
+}
+
+// All yields every key/value pair in slot order. Adding or deleting keys
+// while iterating panics; updating the value of an existing key does not.
+func (rm *RobinHoodMap[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		version := rm.version
+		for i := range rm.slots {
+			if rm.slots[i].dist == 0 {
+				continue
+			}
+			if !yield(rm.slots[i].key, rm.slots[i].data) {
+				return
+			}
+			if rm.version != version {
+				panic("hashmap: словарь изменён во время обхода")
+			}
+		}
+	}
+}
+
+// WriteTo writes the map in the binary format of ChainMap, with the number
+// of slots as the capacity.
+func (rm *RobinHoodMap[K, V]) WriteTo(w io.Writer) (int64, error) {
+	enc := persist.NewEncoder(w)
+	if err := enc.WriteHeader(rm.header()); err != nil {
+		return enc.Len(), err
+	}
+	if err := enc.Uint64(uint64(len(rm.slots))); err != nil {
+		return enc.Len(), err
+	}
+	if err := enc.Uint64(uint64(rm.size)); err != nil {
+		return enc.Len(), err
+	}
+
+	for key, data := range rm.All() {
+		if err := rm.keyCodec.Encode(enc, key); err != nil {
+			return enc.Len(), err
+		}
+		if err := rm.valueCodec.Encode(enc, data); err != nil {
+			return enc.Len(), err
+		}
+		if err := enc.EndRecord(); err != nil {
+			return enc.Len(), err
+		}
+	}
+
+	err := enc.Finish()
+	return enc.Len(), err
+}
+
+// ReadFrom replaces the contents of the map with the binary data in r, which
+// may have been written by a ChainMap. The map is left unchanged if the data
+// cannot be decoded.
+func (rm *RobinHoodMap[K, V]) ReadFrom(r io.Reader) (int64, error) {
+	dec := persist.NewDecoder(r, rm.decodeOpts)
+	if _, err := dec.ExpectHeader(rm.header()); err != nil {
+		return dec.Offset(), err
+	}
+
+	capacity, err := dec.Uint64()
+	if err != nil {
+		return dec.Offset(), err
+	}
+	size, err := dec.Uint64()
+	if err != nil {
+		return dec.Offset(), err
+	}
+	if int64(capacity) < 1 {
+		return dec.Offset(), fmt.Errorf("неверная ёмкость в файле: %d", int64(capacity))
+	}
+	if err := dec.CheckCapacity(capacity); err != nil {
+		return dec.Offset(), err
+	}
+	if err := dec.CheckElements(size); err != nil {
+		return dec.Offset(), err
+	}
+
+	// Collect the pairs first so that the table is sized by the keys the
+	// file holds rather than the count it declares.
+	pairs := make([]robinHoodSlot[K, V], 0, min(size, 1024))
+	for i := uint64(0); i < size; i++ {
+		key, err := rm.keyCodec.Decode(dec)
+		if err != nil {
+			return dec.Offset(), err
+		}
+		data, err := rm.valueCodec.Decode(dec)
+		if err != nil {
+			return dec.Offset(), err
+		}
+		if err := dec.EndRecord(); err != nil {
+			return dec.Offset(), err
+		}
+		pairs = append(pairs, robinHoodSlot[K, V]{key: key, data: data})
+	}
+
+	if err := dec.Finish(); err != nil {
+		return dec.Offset(), err
+	}
+
+	// A ChainMap file may hold more keys than it has buckets, so make room
+	// for all of them without resizing on the way. Like ChainMap, take no
+	// more than maxLoadedBucketsPerKey slots per key from the declared
+	// capacity.
+	bound := uint64(maxLoadedBucketsPerKey * max(len(pairs), 1))
+	loaded := rm.emptyCopy(max(int(min(capacity, bound)), int(float64(len(pairs))/robinHoodMaxLoad)+1))
+	for _, pair := range pairs {
+		if loaded.lookup(pair.key) >= 0 {
+			return dec.Offset(), &persist.CorruptionError{Offset: dec.Offset(), Err: fmt.Errorf("повторяющийся ключ %v", pair.key)}
+		}
+		loaded.Add(pair.key, pair.data)
+	}
+	rm.replace(loaded)
+	return dec.Offset(), nil
+}
+
+// header describes the binary format written by WriteTo, which is the one
+// of ChainMap.
+func (rm *RobinHoodMap[K, V]) header() persist.Header {
+	return chainMapHeader(rm.keyCodec, rm.valueCodec, rm.encodeOpts)
+}
+
+// SetEncodeOptions changes the optional parts of the binary format written by
+// WriteTo and WriteBinary.
+func (rm *RobinHoodMap[K, V]) SetEncodeOptions(opts persist.EncodeOptions) {
+	rm.encodeOpts = opts
+}
+
+// SetDecodeOptions changes the resource limits enforced by every Read*
+// method. Input that goes over a limit fails with persist.ErrLimitExceeded.
+func (rm *RobinHoodMap[K, V]) SetDecodeOptions(opts persist.DecodeOptions) {
+	rm.decodeOpts = opts
+}
+
+// emptyCopy returns an empty map with room for capacity slots that shares
+// the hasher and codecs of rm.
+func (rm *RobinHoodMap[K, V]) emptyCopy(capacity int) *RobinHoodMap[K, V] {
+	return &RobinHoodMap[K, V]{
+		slots:      make([]robinHoodSlot[K, V], robinHoodCapacity(capacity)),
+		hasher:     rm.hasher,
+		keyCodec:   rm.keyCodec,
+		valueCodec: rm.valueCodec,
+	}
+}
+
+func (rm *RobinHoodMap[K, V]) replace(other *RobinHoodMap[K, V]) {
+	rm.slots = other.slots
+	rm.size = other.size
+	rm.version++
+}
+
+func (rm *RobinHoodMap[K, V]) MarshalBinary() ([]byte, error) {
+	return persist.MarshalBinary(rm.WriteTo)
+}
+
+func (rm *RobinHoodMap[K, V]) UnmarshalBinary(data []byte) error {
+	return persist.UnmarshalBinary(data, rm.ReadFrom)
+}
+
+func (rm *RobinHoodMap[K, V]) WriteBinary(filename string) error {
+	return persist.WriteFile(filename, rm.WriteTo)
+}
+
+func (rm *RobinHoodMap[K, V]) ReadBinary(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("не удалось открыть файл: %s", filename)
+	}
+	defer file.Close()
+
+	_, err = rm.ReadFrom(bufio.NewReader(file))
+	return err
+}
@@ -0,0 +1,383 @@
+package hashmap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"maps"
+	"math/rand"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"Go/persist"
+	"Go/persist/persisttest"
+)
+
+// checkRobinHood verifies that every entry of rm records its distance from
+// its home slot and that the entries agree with want.
+func checkRobinHood[K comparable, V comparable](t *testing.T, rm *RobinHoodMap[K, V], want map[K]V) {
+	t.Helper()
+	mask := rm.mask()
+	for i, slot := range rm.slots {
+		if slot.dist == 0 {
+			continue
+		}
+		home := slot.hash & mask
+		if got := (uint64(i)-home)&mask + 1; got != uint64(slot.dist) {
+			t.Fatalf("slot %d: dist = %d, want %d", i, slot.dist, got)
+		}
+	}
+	if got := maps.Collect(rm.All()); !maps.Equal(got, want) {
+		t.Fatalf("map holds %v, want %v", got, want)
+	}
+	if rm.Size() != len(want) {
+		t.Fatalf("Size() = %d, want %d", rm.Size(), len(want))
+	}
+}
+
+func TestRobinHoodMap(t *testing.T) {
+	t.Run("CoreOperations", func(t *testing.T) {
+		rm := NewRobinHoodMap[string, int](0, nil)
+		if rm.Capacity() != minRobinHoodCapacity {
+			t.Errorf("Capacity() = %d, want %d", rm.Capacity(), minRobinHoodCapacity)
+		}
+		rm.Add("one", 1)
+		rm.Add("two", 2)
+		rm.Add("one", 10)
+		if data, err := rm.Find("one"); err != nil || data != 10 {
+			t.Errorf("Find(\"one\") = %d, %v, want 10", data, err)
+		}
+		if !rm.IsContain("two") || rm.IsContain("three") {
+			t.Error("IsContain() is wrong")
+		}
+		if _, err := rm.Find("three"); err == nil {
+			t.Error("Find() of a missing key succeeded")
+		}
+		rm.Del("three")
+		rm.Del("one")
+		checkRobinHood(t, rm, map[string]int{"two": 2})
+
+		keys := NewChainMap[string, int](4, nil)
+		rm.GetAllKeys(keys)
+		if keys.size != 1 || !keys.IsContain("two") {
+			t.Errorf("GetAllKeys() collected %d keys", keys.size)
+		}
+	})
+
+	t.Run("Collisions", func(t *testing.T) {
+		// Every key has the same home slot, so deletes have to shift whole
+		// runs back.
+		rm := NewRobinHoodMap[int, int](16, func(key int) uint64 { return uint64(key % 2) })
+		want := map[int]int{}
+		for i := 0; i < 10; i++ {
+			rm.Add(i, i)
+			want[i] = i
+		}
+		checkRobinHood(t, rm, want)
+		for _, key := range []int{0, 5, 9, 4} {
+			rm.Del(key)
+			delete(want, key)
+			checkRobinHood(t, rm, want)
+		}
+	})
+
+	t.Run("Random", func(t *testing.T) {
+		rng := rand.New(rand.NewSource(1))
+		rm := NewRobinHoodMap[int, int](1, nil)
+		want := map[int]int{}
+		for i := 0; i < 20000; i++ {
+			key := rng.Intn(2000)
+			if rng.Intn(3) == 0 {
+				rm.Del(key)
+				delete(want, key)
+			} else {
+				rm.Add(key, i)
+				want[key] = i
+			}
+		}
+		checkRobinHood(t, rm, want)
+		if load := float64(rm.Size()) / float64(rm.Capacity()); load > robinHoodMaxLoad {
+			t.Errorf("load factor %.2f is above %.3f", load, robinHoodMaxLoad)
+		}
+	})
+
+	t.Run("ModifiedDuringIteration", func(t *testing.T) {
+		rm := NewRobinHoodMap[string, int](8, nil)
+		rm.Add("a", 1)
+		rm.Add("b", 2)
+		defer func() {
+			if recover() == nil {
+				t.Error("adding during All() did not panic")
+			}
+		}()
+		for key := range rm.All() {
+			rm.Add(key+key, 0)
+		}
+	})
+}
+
+func TestRobinHoodMapFiles(t *testing.T) {
+	rm := NewRobinHoodMap[string, int](4, nil)
+	want := map[string]int{}
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("key %d", i)
+		rm.Add(key, -i)
+		want[key] = -i
+	}
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "robinhood.bin")
+		if err := rm.WriteBinary(filename); err != nil {
+			t.Fatalf("WriteBinary() failed: %v", err)
+		}
+		loaded := NewRobinHoodMap[string, int](1, nil)
+		if err := loaded.ReadBinary(filename); err != nil {
+			t.Fatalf("ReadBinary() failed: %v", err)
+		}
+		checkRobinHood(t, loaded, want)
+
+		if err := loaded.ReadBinary(filepath.Join(t.TempDir(), "missing.bin")); err == nil {
+			t.Error("ReadBinary() of a missing file succeeded")
+		}
+		checkRobinHood(t, loaded, want)
+	})
+
+	t.Run("ChainMapFormat", func(t *testing.T) {
+		data, err := rm.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary() failed: %v", err)
+		}
+		cm := NewChainMap[string, int](1, nil)
+		if err := cm.UnmarshalBinary(data); err != nil {
+			t.Fatalf("ChainMap.UnmarshalBinary() failed: %v", err)
+		}
+		if got := maps.Collect(cm.All()); !maps.Equal(got, want) {
+			t.Errorf("ChainMap loaded %v, want %v", got, want)
+		}
+
+		// A ChainMap with few buckets holds more keys than its capacity.
+		small := NewChainMap[string, int](2, nil)
+		for key, data := range want {
+			small.Add(key, data)
+		}
+		small.SetEncodeOptions(persist.EncodeOptions{RecordChecksums: true, Compression: persist.CompressionGzip})
+		if data, err = small.MarshalBinary(); err != nil {
+			t.Fatalf("ChainMap.MarshalBinary() failed: %v", err)
+		}
+		loaded := NewRobinHoodMap[string, int](1, nil)
+		if err := loaded.UnmarshalBinary(data); err != nil {
+			t.Fatalf("UnmarshalBinary() of a ChainMap file failed: %v", err)
+		}
+		checkRobinHood(t, loaded, want)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		data, err := rm.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary() failed: %v", err)
+		}
+		loaded := NewRobinHoodMap[string, int](1, nil)
+		loaded.Add("kept", 1)
+		if err := loaded.UnmarshalBinary(data[:len(data)-1]); err == nil {
+			t.Error("UnmarshalBinary() of truncated data succeeded")
+		}
+		loaded.SetDecodeOptions(persist.DecodeOptions{MaxElements: 10})
+		if err := loaded.UnmarshalBinary(data); err == nil {
+			t.Error("UnmarshalBinary() over MaxElements succeeded")
+		}
+		checkRobinHood(t, loaded, map[string]int{"kept": 1})
+
+		other := NewRobinHoodMap[int, int](1, nil)
+		if err := other.UnmarshalBinary(data); err == nil {
+			t.Error("UnmarshalBinary() into a map with other codecs succeeded")
+		}
+	})
+
+	t.Run("Loading", func(t *testing.T) {
+		original := NewRobinHoodMap[string, int](1, nil)
+		original.Add("a", 1)
+		original.Add("b", 2)
+		data, err := original.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary() failed: %v", err)
+		}
+		// refooter recomputes the checksum footer of damaged, so that only
+		// the reader's own checks can reject it.
+		refooter := func(damaged []byte) []byte {
+			body := damaged[:len(damaged)-persist.ChecksumSize]
+			crc := crc32.Checksum(body, crc32.MakeTable(crc32.Castagnoli))
+			return binary.LittleEndian.AppendUint32(body, crc)
+		}
+
+		huge := bytes.Clone(data)
+		binary.LittleEndian.PutUint64(huge[persist.HeaderSize:], 1<<24)
+		loaded := NewRobinHoodMap[string, int](1, nil)
+		if err := loaded.UnmarshalBinary(refooter(huge)); err != nil {
+			t.Fatalf("UnmarshalBinary() of a huge declared capacity failed: %v", err)
+		}
+		if loaded.Capacity() > 2*maxLoadedBucketsPerKey {
+			t.Errorf("two keys declaring 1<<24 slots loaded with capacity %d", loaded.Capacity())
+		}
+
+		// Neither may a declared key count the file does not hold.
+		declared := bytes.Clone(data)
+		binary.LittleEndian.PutUint64(declared[persist.HeaderSize+8:], 1<<24)
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		if err := loaded.UnmarshalBinary(refooter(declared)); err == nil {
+			t.Error("UnmarshalBinary() of a key count past the end of the data returned nil error")
+		}
+		runtime.ReadMemStats(&after)
+		if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+			t.Errorf("UnmarshalBinary() of a key count of 1<<24 allocated %d bytes", allocated)
+		}
+
+		duplicate := bytes.Replace(bytes.Clone(data), []byte("b"), []byte("a"), 1)
+		var corrupt *persist.CorruptionError
+		if err := loaded.UnmarshalBinary(refooter(duplicate)); !errors.As(err, &corrupt) {
+			t.Errorf("UnmarshalBinary() of a repeated key = %v, want CorruptionError", err)
+		}
+		checkRobinHood(t, loaded, map[string]int{"a": 1, "b": 2})
+	})
+}
+
+// benchKeys returns n distinct string keys.
+func benchKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("user:%08d", i)
+	}
+	return keys
+}
+
+// benchMap is the part of the map API the benchmarks exercise.
+type benchMap interface {
+	Add(key string, data int)
+	Del(key string)
+	Find(key string) (int, error)
+}
+
+var benchMaps = []struct {
+	name string
+	new  func() benchMap
+}{
+	{"ChainMap", func() benchMap { return NewChainMap[string, int](16, nil) }},
+	{"RobinHoodMap", func() benchMap { return NewRobinHoodMap[string, int](16, nil) }},
+}
+
+var benchSizes = []int{1_000, 100_000}
+
+func BenchmarkMapAdd(b *testing.B) {
+	for _, size := range benchSizes {
+		keys := benchKeys(size)
+		for _, bm := range benchMaps {
+			b.Run(fmt.Sprintf("%s/%d", bm.name, size), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					m := bm.new()
+					for j, key := range keys {
+						m.Add(key, j)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkMapFind(b *testing.B) {
+	for _, size := range benchSizes {
+		keys := benchKeys(size)
+		for _, bm := range benchMaps {
+			m := bm.new()
+			for j, key := range keys {
+				m.Add(key, j)
+			}
+			b.Run(fmt.Sprintf("%s/%d", bm.name, size), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if _, err := m.Find(keys[i%size]); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkMapFindMissing(b *testing.B) {
+	for _, size := range benchSizes {
+		keys := benchKeys(size)
+		missing := benchKeys(2 * size)[size:]
+		for _, bm := range benchMaps {
+			m := bm.new()
+			for j, key := range keys {
+				m.Add(key, j)
+			}
+			b.Run(fmt.Sprintf("%s/%d", bm.name, size), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					m.Find(missing[i%size])
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkMapChurn(b *testing.B) {
+	for _, size := range benchSizes {
+		keys := benchKeys(2 * size)
+		for _, bm := range benchMaps {
+			m := bm.new()
+			for j, key := range keys[:size] {
+				m.Add(key, j)
+			}
+			b.Run(fmt.Sprintf("%s/%d", bm.name, size), func(b *testing.B) {
+				b.ReportAllocs()
+				// Keep size keys in the map while cycling through 2*size.
+				for i := 0; i < b.N; i++ {
+					m.Del(keys[i%len(keys)])
+					m.Add(keys[(i+size)%len(keys)], i)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkMapWriteTo(b *testing.B) {
+	keys := benchKeys(100_000)
+	cm := NewChainMap[string, int](16, nil)
+	rm := NewRobinHoodMap[string, int](16, nil)
+	for j, key := range keys {
+		cm.Add(key, j)
+		rm.Add(key, j)
+	}
+	for name, writeTo := range map[string]func(w *bytes.Buffer) error{
+		"ChainMap":     func(w *bytes.Buffer) error { _, err := cm.WriteTo(w); return err },
+		"RobinHoodMap": func(w *bytes.Buffer) error { _, err := rm.WriteTo(w); return err },
+	} {
+		b.Run(name, func(b *testing.B) {
+			var buf bytes.Buffer
+			for i := 0; i < b.N; i++ {
+				buf.Reset()
+				if err := writeTo(&buf); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestRobinHoodMapReaderWriter(t *testing.T) {
+	persisttest.TestContainer(t, persisttest.Fixture[*RobinHoodMap[string, string]]{
+		New: func() *RobinHoodMap[string, string] { return NewRobinHoodMap[string, string](1, nil) },
+		Make: func(values []string) *RobinHoodMap[string, string] {
+			rm := NewRobinHoodMap[string, string](4, nil)
+			for i, s := range values {
+				rm.Add(s, values[len(values)-1-i])
+			}
+			return rm
+		},
+		Contents: func(rm *RobinHoodMap[string, string]) any { return maps.Collect(rm.All()) },
+	})
+}
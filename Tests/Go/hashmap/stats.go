@@ -0,0 +1,79 @@
+package hashmap
+
+import (
+	"encoding/json"
+	"expvar"
+)
+
+// Stats describes how well a ChainMap spreads its keys. While the map is
+// being resized, the buckets of the old table that have not been moved yet
+// are counted alongside those of the current one.
+type Stats struct {
+	Size       int
+	Capacity   int
+	LoadFactor float64
+	// LongestChain is the number of keys in the fullest bucket.
+	LongestChain int
+	// ChainLengths[n] is the number of buckets holding n keys, up to
+	// LongestChain.
+	ChainLengths []int
+	EmptyBuckets int
+	// Rehashes counts the resizes the map has started since it was created.
+	Rehashes int
+	// Rehashing reports whether a resize is still moving buckets.
+	Rehashing bool
+}
+
+// String returns the stats as JSON, which makes Stats an expvar.Var.
+func (s Stats) String() string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+// Stats walks every bucket and reports the shape of the map.
+func (cm *ChainMap[K, V]) Stats() Stats {
+	stats := Stats{
+		Size:         cm.size,
+		Capacity:     cm.capacity,
+		LoadFactor:   cm.LoadFactor(),
+		ChainLengths: []int{0},
+		Rehashes:     cm.rehashes,
+		Rehashing:    cm.old != nil,
+	}
+	count := func(bucket *Bucket[K, V]) {
+		chain := 0
+		for currentNode := bucket.Head; currentNode != nil; currentNode = currentNode.Next {
+			chain++
+		}
+		for len(stats.ChainLengths) <= chain {
+			stats.ChainLengths = append(stats.ChainLengths, 0)
+		}
+		stats.ChainLengths[chain]++
+		stats.LongestChain = max(stats.LongestChain, chain)
+	}
+
+	if cm.old != nil {
+		for i := cm.rehashIndex; i < len(cm.old); i++ {
+			count(cm.old[i])
+		}
+	}
+	for i := 0; i < cm.capacity; i++ {
+		count(cm.table[i])
+	}
+	stats.EmptyBuckets = stats.ChainLengths[0]
+	return stats
+}
+
+// StatsVar returns an expvar.Var that reports the current Stats of the map
+// each time it is read:
+//
+//	expvar.Publish("sessions", sessions.StatsVar())
+//
+// expvar reads it from the goroutine serving /debug/vars, so the map must not
+// be modified concurrently; publish an expvar.Func that takes the map's lock
+// around Stats instead if it is.
+func (cm *ChainMap[K, V]) StatsVar() expvar.Var {
+	return expvar.Func(func() any {
+		return cm.Stats()
+	})
+}
@@ -0,0 +1,86 @@
+package hashmap
+
+import (
+	"encoding/json"
+	"expvar"
+	"reflect"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	t.Run("Empty", func(t *testing.T) {
+		got := NewChainMap[string, int](8, nil).Stats()
+		want := Stats{Capacity: 8, ChainLengths: []int{8}, EmptyBuckets: 8}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Stats() = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("Chains", func(t *testing.T) {
+		cm := NewChainMap[int, int](16, func(key int) uint64 { return uint64(key % 2) })
+		for i := 0; i < 7; i++ {
+			cm.Add(i, i)
+		}
+		got := cm.Stats()
+		want := Stats{
+			Size:         7,
+			Capacity:     16,
+			LoadFactor:   7.0 / 16,
+			LongestChain: 4,
+			ChainLengths: []int{14, 0, 0, 1, 1},
+			EmptyBuckets: 14,
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Stats() = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("Rehashing", func(t *testing.T) {
+		cm := NewChainMap[int, int](64, nil)
+		for i := 0; i < 49; i++ {
+			cm.Add(i, i)
+		}
+		stats := cm.Stats()
+		if !stats.Rehashing || stats.Rehashes != 1 || stats.Capacity != 128 {
+			t.Fatalf("Stats() mid-move = %+v", stats)
+		}
+		buckets, keys := 0, 0
+		for n, count := range stats.ChainLengths {
+			buckets += count
+			keys += n * count
+		}
+		if want := 128 + len(cm.old) - cm.rehashIndex; buckets != want || keys != 49 {
+			t.Errorf("histogram covers %d buckets and %d keys, want %d and 49", buckets, keys, want)
+		}
+
+		cm.finishRehash()
+		for i := 0; i < 49; i++ {
+			cm.Del(i)
+		}
+		cm.finishRehash()
+		if stats := cm.Stats(); stats.Rehashing || stats.Rehashes != 2 || stats.Capacity != 64 || stats.EmptyBuckets != 64 {
+			t.Errorf("Stats() after shrinking = %+v", stats)
+		}
+	})
+
+	t.Run("Expvar", func(t *testing.T) {
+		cm := NewChainMap[string, int](4, nil)
+		var published expvar.Var = cm.StatsVar()
+		cm.Add("a", 1)
+		cm.Add("b", 2)
+
+		// expvar serves the String of every published Var.
+		var got Stats
+		if err := json.Unmarshal([]byte(published.String()), &got); err != nil {
+			t.Fatalf("published stats are not JSON: %v", err)
+		}
+		if want := cm.Stats(); !reflect.DeepEqual(got, want) {
+			t.Errorf("published %+v, want %+v", got, want)
+		}
+
+		var snapshot Stats
+		if err := json.Unmarshal([]byte(cm.Stats().String()), &snapshot); err != nil || snapshot.Size != 2 {
+			t.Errorf("Stats.String() = %s, %v", cm.Stats().String(), err)
+		}
+	})
+}
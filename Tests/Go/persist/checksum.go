@@ -0,0 +1,136 @@
+package persist
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// ChecksumSize is the number of bytes taken by a file or record checksum.
+const ChecksumSize = 4
+
+// ErrChecksum is wrapped by the CorruptionError returned when a stored
+// checksum does not match the data it covers.
+var ErrChecksum = errors.New("checksum mismatch")
+
+// CorruptionError reports damaged or truncated input. Offset is the position
+// of the first byte that could not be trusted: the start of a record whose
+// checksum failed, the file footer, or the point where the input ran out.
+type CorruptionError struct {
+	Offset int64
+	Err    error
+}
+
+func (e *CorruptionError) Error() string {
+	return fmt.Sprintf("persist: corrupted data at byte %d: %v", e.Offset, e.Err)
+}
+
+func (e *CorruptionError) Unwrap() error {
+	return e.Err
+}
+
+// EncodeOptions controls the optional parts of the binary format. The zero
+// value writes a checksum footer, no per-record checksums and no
+// compression.
+type EncodeOptions struct {
+	// RecordChecksums follows every element with its own CRC-32C so that
+	// corruption is reported at the record it hit.
+	RecordChecksums bool
+	// Compression compresses everything after the header. It also applies to
+	// text files, which are always compressed with gzip.
+	Compression Compression
+}
+
+// Flags returns the header flags for files written with o.
+func (o EncodeOptions) Flags() Flags {
+	flags := FlagChecksum
+	if o.RecordChecksums {
+		flags |= FlagRecordChecksums
+	}
+	return flags | o.Compression.flags()
+}
+
+// checksums keeps the running CRCs of an Encoder or Decoder. Everything that
+// passes through is summed; the flags from the header decide what is
+// written or verified.
+type checksums struct {
+	flags       Flags
+	crc         uint32
+	recordCRC   uint32
+	recordStart int64
+}
+
+func (c *checksums) update(p []byte) {
+	c.crc = crc32.Update(c.crc, castagnoli, p)
+	c.recordCRC = crc32.Update(c.recordCRC, castagnoli, p)
+}
+
+func (c *checksums) start(flags Flags) {
+	c.flags = flags
+	c.recordCRC = 0
+}
+
+// EndRecord closes the current record, writing its checksum if the header
+// asked for per-record checksums. A record covers everything written since
+// the header or the previous record.
+func (e *Encoder) EndRecord() error {
+	if e.flags&FlagRecordChecksums == 0 {
+		return nil
+	}
+	err := e.Uint32(e.recordCRC)
+	e.recordCRC = 0
+	return err
+}
+
+// Finish writes the checksum footer if the header asked for one, closes the
+// compressed stream if there is one, and flushes the encoder.
+func (e *Encoder) Finish() error {
+	if e.flags&FlagChecksum != 0 {
+		if err := e.Uint32(e.crc); err != nil {
+			return err
+		}
+	}
+	if err := e.Flush(); err != nil || e.z == nil {
+		return err
+	}
+	return e.z.Close()
+}
+
+// EndRecord verifies the checksum of the current record if the header
+// declared per-record checksums.
+func (d *Decoder) EndRecord() error {
+	if d.flags&FlagRecordChecksums == 0 {
+		return nil
+	}
+	want, start := d.recordCRC, d.recordStart
+	got, err := d.Uint32()
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return &CorruptionError{Offset: start, Err: ErrChecksum}
+	}
+	d.recordCRC = 0
+	d.recordStart = d.n
+	return nil
+}
+
+// Finish verifies the checksum footer if the header declared one and the end
+// of a compressed body. Readers call it after decoding the last element and
+// before installing the result.
+func (d *Decoder) Finish() error {
+	if d.flags&FlagChecksum == 0 {
+		return d.endCompressed()
+	}
+	want, offset := d.crc, d.n
+	got, err := d.Uint32()
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return &CorruptionError{Offset: offset, Err: ErrChecksum}
+	}
+	return d.endCompressed()
+}
@@ -0,0 +1,118 @@
+package persist
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// encodeRecords writes a header with the given options and one String record
+// per value, the way the containers do.
+func encodeRecords(t *testing.T, opts EncodeOptions, values ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.WriteHeader(Header{Type: TypeArray, Value: EncodingString32, Flags: opts.Flags()})
+	for _, v := range values {
+		if err := String.Encode(enc, v); err != nil {
+			t.Fatalf("Encode() failed: %v", err)
+		}
+		if err := enc.EndRecord(); err != nil {
+			t.Fatalf("EndRecord() failed: %v", err)
+		}
+	}
+	if err := enc.Finish(); err != nil {
+		t.Fatalf("Finish() failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func decodeRecords(data []byte, n int) ([]string, error) {
+	dec := NewDecoder(bytes.NewReader(data))
+	if _, err := dec.ReadHeader(); err != nil {
+		return nil, err
+	}
+	var values []string
+	for i := 0; i < n; i++ {
+		v, err := String.Decode(dec)
+		if err != nil {
+			return nil, err
+		}
+		if err := dec.EndRecord(); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, dec.Finish()
+}
+
+func TestChecksums(t *testing.T) {
+	t.Run("Footer", func(t *testing.T) {
+		data := encodeRecords(t, EncodeOptions{}, "ab", "cd")
+		if want := HeaderSize + 2*(4+2) + ChecksumSize; len(data) != want {
+			t.Fatalf("encoded %d bytes, want %d", len(data), want)
+		}
+		if got, err := decodeRecords(data, 2); err != nil || len(got) != 2 || got[1] != "cd" {
+			t.Fatalf("decodeRecords() = %v, %v", got, err)
+		}
+
+		for _, offset := range []int{HeaderSize + 4, len(data) - 1} {
+			damaged := append([]byte(nil), data...)
+			damaged[offset] ^= 0x01
+			_, err := decodeRecords(damaged, 2)
+			var corrupt *CorruptionError
+			if !errors.As(err, &corrupt) || !errors.Is(err, ErrChecksum) {
+				t.Fatalf("decode with byte %d flipped = %v, want checksum CorruptionError", offset, err)
+			}
+			if corrupt.Offset != int64(len(data)-ChecksumSize) {
+				t.Errorf("CorruptionError.Offset = %d, want footer at %d", corrupt.Offset, len(data)-ChecksumSize)
+			}
+		}
+	})
+
+	t.Run("Records", func(t *testing.T) {
+		data := encodeRecords(t, EncodeOptions{RecordChecksums: true}, "ab", "cd")
+		if want := HeaderSize + 2*(4+2+ChecksumSize) + ChecksumSize; len(data) != want {
+			t.Fatalf("encoded %d bytes, want %d", len(data), want)
+		}
+		if _, err := decodeRecords(data, 2); err != nil {
+			t.Fatalf("decodeRecords() failed: %v", err)
+		}
+
+		secondRecord := HeaderSize + 4 + 2 + ChecksumSize
+		damaged := append([]byte(nil), data...)
+		damaged[secondRecord+4] = 'x'
+		_, err := decodeRecords(damaged, 2)
+		var corrupt *CorruptionError
+		if !errors.As(err, &corrupt) || !errors.Is(err, ErrChecksum) {
+			t.Fatalf("decode of damaged record = %v, want checksum CorruptionError", err)
+		}
+		if corrupt.Offset != int64(secondRecord) {
+			t.Errorf("CorruptionError.Offset = %d, want record start %d", corrupt.Offset, secondRecord)
+		}
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		data := encodeRecords(t, EncodeOptions{}, "abcdef")
+		_, err := decodeRecords(data[:HeaderSize+6], 1)
+		var corrupt *CorruptionError
+		if !errors.As(err, &corrupt) || !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("decode of truncated data = %v, want CorruptionError wrapping io.ErrUnexpectedEOF", err)
+		}
+		if corrupt.Offset != HeaderSize+6 {
+			t.Errorf("CorruptionError.Offset = %d, want %d", corrupt.Offset, HeaderSize+6)
+		}
+	})
+
+	t.Run("NoFlags", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := NewEncoder(&buf)
+		String.Encode(enc, "ab")
+		enc.EndRecord()
+		enc.Finish()
+		if buf.Len() != 6 {
+			t.Errorf("encoder without header wrote %d bytes, want 6", buf.Len())
+		}
+	})
+}
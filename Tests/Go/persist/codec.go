@@ -0,0 +1,213 @@
+package persist
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// Codec converts container elements of type T to and from their binary and
+// text representations.
+type Codec[T any] interface {
+	Encode(e *Encoder, v T) error
+	Decode(d *Decoder) (T, error)
+	Format(v T) (string, error)
+	Parse(s string) (T, error)
+}
+
+var (
+	// String writes a string as a uint32 length followed by its bytes.
+	String Codec[string] = stringCodec{prefix: 4}
+	// String64 writes a string as a uint64 length followed by its bytes.
+	String64 Codec[string] = stringCodec{prefix: 8}
+	// Int writes an int as a signed 64-bit value.
+	Int Codec[int] = intCodec{size: 8}
+	// Int32 writes an int as a signed 32-bit value and rejects ints that do
+	// not fit.
+	Int32 Codec[int] = intCodec{size: 4}
+	// Bytes writes a byte slice as a uint32 length followed by its bytes and
+	// formats it as base64 in text files.
+	Bytes Codec[[]byte] = bytesCodec{}
+)
+
+// Default returns the codec used for T when none is configured: String, Int
+// and Bytes for their respective types and JSON for everything else.
+func Default[T any]() Codec[T] {
+	var zero T
+	switch any(zero).(type) {
+	case string:
+		return any(String).(Codec[T])
+	case int:
+		return any(Int).(Codec[T])
+	case []byte:
+		return any(Bytes).(Codec[T])
+	}
+	return JSON[T]()
+}
+
+func writeLength(e *Encoder, prefix int, n int) error {
+	if prefix == 4 {
+		if uint64(n) > 1<<32-1 {
+			return fmt.Errorf("length %d does not fit in 32 bits", n)
+		}
+		return e.Uint32(uint32(n))
+	}
+	return e.Uint64(uint64(n))
+}
+
+func readLength(d *Decoder, prefix int) (uint64, error) {
+	if prefix == 4 {
+		n, err := d.Uint32()
+		return uint64(n), err
+	}
+	return d.Uint64()
+}
+
+type stringCodec struct {
+	prefix int
+}
+
+func (c stringCodec) Encode(e *Encoder, v string) error {
+	if err := writeLength(e, c.prefix, len(v)); err != nil {
+		return err
+	}
+	_, err := e.Write([]byte(v))
+	return err
+}
+
+func (c stringCodec) Decode(d *Decoder) (string, error) {
+	n, err := readLength(d, c.prefix)
+	if err != nil {
+		return "", err
+	}
+	p, err := d.Bytes(n)
+	if err != nil {
+		return "", err
+	}
+	return string(p), nil
+}
+
+func (c stringCodec) Encoding() Encoding {
+	if c.prefix == 4 {
+		return EncodingString32
+	}
+	return EncodingString64
+}
+
+func (stringCodec) Format(v string) (string, error) {
+	return v, nil
+}
+
+func (stringCodec) Parse(s string) (string, error) {
+	return s, nil
+}
+
+type intCodec struct {
+	size int
+}
+
+func (c intCodec) Encode(e *Encoder, v int) error {
+	if c.size == 4 {
+		if int64(v) != int64(int32(v)) {
+			return fmt.Errorf("value %d does not fit in 32 bits", v)
+		}
+		return e.Uint32(uint32(int32(v)))
+	}
+	return e.Uint64(uint64(int64(v)))
+}
+
+func (c intCodec) Decode(d *Decoder) (int, error) {
+	if c.size == 4 {
+		v, err := d.Uint32()
+		return int(int32(v)), err
+	}
+	v, err := d.Uint64()
+	return int(int64(v)), err
+}
+
+func (c intCodec) Encoding() Encoding {
+	if c.size == 4 {
+		return EncodingInt32
+	}
+	return EncodingInt64
+}
+
+func (intCodec) Format(v int) (string, error) {
+	return strconv.Itoa(v), nil
+}
+
+func (intCodec) Parse(s string) (int, error) {
+	return strconv.Atoi(s)
+}
+
+type bytesCodec struct{}
+
+func (bytesCodec) Encode(e *Encoder, v []byte) error {
+	if err := writeLength(e, 4, len(v)); err != nil {
+		return err
+	}
+	_, err := e.Write(v)
+	return err
+}
+
+func (bytesCodec) Decode(d *Decoder) ([]byte, error) {
+	n, err := readLength(d, 4)
+	if err != nil {
+		return nil, err
+	}
+	return d.Bytes(n)
+}
+
+func (bytesCodec) Encoding() Encoding {
+	return EncodingBytes
+}
+
+func (bytesCodec) Format(v []byte) (string, error) {
+	return base64.StdEncoding.EncodeToString(v), nil
+}
+
+func (bytesCodec) Parse(s string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(s)
+}
+
+// JSON returns a codec that stores values of any JSON-serializable type as
+// length-prefixed JSON documents.
+func JSON[T any]() Codec[T] {
+	return jsonCodec[T]{}
+}
+
+type jsonCodec[T any] struct{}
+
+func (jsonCodec[T]) Encode(e *Encoder, v T) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return Bytes.Encode(e, data)
+}
+
+func (jsonCodec[T]) Decode(d *Decoder) (T, error) {
+	var v T
+	data, err := Bytes.Decode(d)
+	if err != nil {
+		return v, err
+	}
+	err = json.Unmarshal(data, &v)
+	return v, err
+}
+
+func (jsonCodec[T]) Encoding() Encoding {
+	return EncodingJSON
+}
+
+func (jsonCodec[T]) Format(v T) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+func (jsonCodec[T]) Parse(s string) (T, error) {
+	var v T
+	err := json.Unmarshal([]byte(s), &v)
+	return v, err
+}
@@ -0,0 +1,171 @@
+package persist
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func roundTrip[T any](t *testing.T, c Codec[T], v T) ([]byte, T) {
+	t.Helper()
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	if err := c.Encode(enc, v); err != nil {
+		t.Fatalf("Encode(%v) failed: %v", v, err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("Flush() failed: %v", err)
+	}
+	if enc.Len() != int64(buf.Len()) {
+		t.Errorf("Encoder.Len() = %d, want %d", enc.Len(), buf.Len())
+	}
+	encoded := append([]byte(nil), buf.Bytes()...)
+
+	dec := NewDecoder(&buf)
+	got, err := c.Decode(dec)
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+	if dec.Offset() != int64(len(encoded)) {
+		t.Errorf("Decoder.Offset() = %d, want %d", dec.Offset(), len(encoded))
+	}
+
+	text, err := c.Format(v)
+	if err != nil {
+		t.Fatalf("Format(%v) failed: %v", v, err)
+	}
+	parsed, err := c.Parse(text)
+	if err != nil {
+		t.Fatalf("Parse(%q) failed: %v", text, err)
+	}
+	if !reflect.DeepEqual(parsed, got) {
+		t.Errorf("Parse(Format(v)) = %v, Decode(Encode(v)) = %v", parsed, got)
+	}
+	return encoded, got
+}
+
+func TestBuiltinCodecs(t *testing.T) {
+	t.Run("String", func(t *testing.T) {
+		encoded, got := roundTrip(t, String, "héllo")
+		if !bytes.Equal(encoded, []byte{6, 0, 0, 0, 'h', 0xc3, 0xa9, 'l', 'l', 'o'}) {
+			t.Errorf("String encoding = %v", encoded)
+		}
+		if got != "héllo" {
+			t.Errorf("String round trip = %q", got)
+		}
+	})
+
+	t.Run("String64", func(t *testing.T) {
+		encoded, got := roundTrip(t, String64, "ab")
+		if !bytes.Equal(encoded, []byte{2, 0, 0, 0, 0, 0, 0, 0, 'a', 'b'}) {
+			t.Errorf("String64 encoding = %v", encoded)
+		}
+		if got != "ab" {
+			t.Errorf("String64 round trip = %q", got)
+		}
+	})
+
+	t.Run("Int", func(t *testing.T) {
+		for _, v := range []int{0, -1, math.MaxInt64, math.MinInt64} {
+			encoded, got := roundTrip(t, Int, v)
+			if len(encoded) != 8 || got != v {
+				t.Errorf("Int round trip of %d = %d (%d bytes)", v, got, len(encoded))
+			}
+		}
+	})
+
+	t.Run("Int32", func(t *testing.T) {
+		for _, v := range []int{0, -1000, math.MaxInt32, math.MinInt32} {
+			encoded, got := roundTrip(t, Int32, v)
+			if len(encoded) != 4 || got != v {
+				t.Errorf("Int32 round trip of %d = %d (%d bytes)", v, got, len(encoded))
+			}
+		}
+		if err := Int32.Encode(NewEncoder(io.Discard), math.MaxInt32+1); err == nil {
+			t.Error("Int32.Encode() of out-of-range value returned nil error")
+		}
+		if _, err := Int32.Parse("x"); err == nil {
+			t.Error("Int32.Parse(\"x\") returned nil error")
+		}
+	})
+
+	t.Run("Bytes", func(t *testing.T) {
+		_, got := roundTrip(t, Bytes, []byte{0, '\n', 0xff})
+		if !bytes.Equal(got, []byte{0, '\n', 0xff}) {
+			t.Errorf("Bytes round trip = %v", got)
+		}
+		text, _ := Bytes.Format([]byte{0, '\n', 0xff})
+		if text != "AAr/" {
+			t.Errorf("Bytes.Format() = %q, want base64", text)
+		}
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		type record struct {
+			Name string
+			Tags []string
+		}
+		_, got := roundTrip(t, JSON[record](), record{"a\nb", []string{"x"}})
+		if got.Name != "a\nb" || len(got.Tags) != 1 {
+			t.Errorf("JSON round trip = %+v", got)
+		}
+		text, _ := JSON[record]().Format(record{Name: "a\nb"})
+		if bytes.ContainsRune([]byte(text), '\n') {
+			t.Errorf("JSON.Format() = %q contains a newline", text)
+		}
+		if _, err := JSON[record]().Parse("{"); err == nil {
+			t.Error("JSON.Parse() of invalid document returned nil error")
+		}
+		if err := JSON[func()]().Encode(NewEncoder(io.Discard), func() {}); err == nil {
+			t.Error("JSON.Encode() of a func returned nil error")
+		}
+	})
+}
+
+func TestDefault(t *testing.T) {
+	if Default[string]() != String {
+		t.Error("Default[string]() is not String")
+	}
+	if Default[int]() != Int {
+		t.Error("Default[int]() is not Int")
+	}
+	if _, ok := Default[[]byte]().(bytesCodec); !ok {
+		t.Error("Default[[]byte]() is not Bytes")
+	}
+	if _, ok := Default[float64]().(jsonCodec[float64]); !ok {
+		t.Error("Default[float64]() is not a JSON codec")
+	}
+}
+
+func TestTruncatedInput(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		decode func(d *Decoder) error
+	}{
+		{"String length", []byte{1, 0}, func(d *Decoder) error { _, err := String.Decode(d); return err }},
+		{"String body", []byte{5, 0, 0, 0, 'a'}, func(d *Decoder) error { _, err := String.Decode(d); return err }},
+		{"String64 body", []byte{2, 0, 0, 0, 0, 0, 0, 0, 'a'}, func(d *Decoder) error { _, err := String64.Decode(d); return err }},
+		{"Int", []byte{1, 2, 3}, func(d *Decoder) error { _, err := Int.Decode(d); return err }},
+		{"Int32", []byte{1}, func(d *Decoder) error { _, err := Int32.Decode(d); return err }},
+		{"Bytes", []byte{3, 0, 0, 0}, func(d *Decoder) error { _, err := Bytes.Decode(d); return err }},
+		{"JSON", []byte{1, 0, 0, 0, '{'}, func(d *Decoder) error { _, err := JSON[map[string]int]().Decode(d); return err }},
+		{"Uint8", nil, func(d *Decoder) error { _, err := d.Uint8(); return err }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.decode(NewDecoder(bytes.NewReader(tt.data))); err == nil {
+				t.Error("decode of truncated input returned nil error")
+			}
+		})
+	}
+
+	_, err := String.Decode(NewDecoder(bytes.NewReader([]byte{5, 0, 0, 0, 'a'})))
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("short string error = %v, want io.ErrUnexpectedEOF", err)
+	}
+}
@@ -0,0 +1,188 @@
+package persist
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// Compression selects how the body of a file is compressed. Binary files
+// record it in their header flags, so readers detect it on their own; the
+// header itself is never compressed.
+type Compression uint8
+
+const (
+	CompressionNone Compression = iota
+	// CompressionGzip wraps the body in a gzip stream, which carries its own
+	// CRC-32 and length.
+	CompressionGzip
+	// CompressionFlate writes a raw DEFLATE stream, a few bytes smaller than
+	// gzip. Text files have no header to record it in and are written with
+	// gzip instead.
+	CompressionFlate
+)
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionGzip:
+		return "gzip"
+	case CompressionFlate:
+		return "flate"
+	}
+	return fmt.Sprintf("Compression(%d)", uint8(c))
+}
+
+// gzipMagic opens every gzip stream; text readers look for it to detect
+// compressed files.
+var gzipMagic = [2]byte{0x1f, 0x8b}
+
+func (c Compression) flags() Flags {
+	switch c {
+	case CompressionGzip:
+		return FlagGzip
+	case CompressionFlate:
+		return FlagFlate
+	}
+	return 0
+}
+
+func compressionOf(flags Flags) (Compression, error) {
+	switch flags & (FlagGzip | FlagFlate) {
+	case 0:
+		return CompressionNone, nil
+	case FlagGzip:
+		return CompressionGzip, nil
+	case FlagFlate:
+		return CompressionFlate, nil
+	}
+	return CompressionNone, fmt.Errorf("%w: both gzip and flate are set", ErrUnknownFlags)
+}
+
+// compress sends everything written from now on through c. Finish closes
+// the compressed stream.
+func (e *Encoder) compress(c Compression) error {
+	if c == CompressionNone {
+		return nil
+	}
+	if err := e.w.Flush(); err != nil {
+		return err
+	}
+	switch c {
+	case CompressionGzip:
+		e.z = gzip.NewWriter(&e.cw)
+	case CompressionFlate:
+		e.z, _ = flate.NewWriter(&e.cw, flate.DefaultCompression)
+	default:
+		return fmt.Errorf("persist: unknown compression %v", c)
+	}
+	e.w.Reset(e.z)
+	return nil
+}
+
+// CompressText starts gzip compression of a text file if opts ask for any
+// compression. Text readers detect it with DetectCompression.
+func (e *Encoder) CompressText(opts EncodeOptions) error {
+	if opts.Compression == CompressionNone {
+		return nil
+	}
+	return e.compress(CompressionGzip)
+}
+
+// decompress reads the rest of the input through c. Offset keeps counting
+// compressed input, while limits, checksums and corruption offsets apply to
+// the decompressed bytes.
+func (d *Decoder) decompress(c Compression) error {
+	if c == CompressionNone {
+		return nil
+	}
+	d.inStart = d.Offset()
+	d.in = &inputCounter{r: d.r}
+	switch c {
+	case CompressionGzip:
+		z, err := gzip.NewReader(d.in)
+		if err != nil {
+			return &CorruptionError{Offset: d.n, Err: err}
+		}
+		z.Multistream(false)
+		d.r = z
+	case CompressionFlate:
+		d.r = flate.NewReader(d.in)
+	default:
+		return fmt.Errorf("persist: unknown compression %v", c)
+	}
+	return nil
+}
+
+// DetectCompression checks whether the rest of the input is a gzip stream,
+// as written by CompressText, and decompresses it if so. Plain input is read
+// unchanged. Compressed input is buffered, so the decoder may read past the
+// end of the gzip stream; text files run to the end of their input anyway.
+func (d *Decoder) DetectCompression() error {
+	var head [len(gzipMagic)]byte
+	n, err := io.ReadFull(d.r, head[:])
+	d.r = io.MultiReader(bytes.NewReader(head[:n]), d.r)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	if n < len(head) || head != gzipMagic {
+		return nil
+	}
+	// The decompressor asks for single bytes; buffering keeps that cheap
+	// once the magic has been put back in front of the input.
+	d.r = bufio.NewReader(d.r)
+	return d.decompress(CompressionGzip)
+}
+
+// endCompressed reads the decompressor to its end, which makes gzip verify
+// its own checksum and consumes the trailer.
+func (d *Decoder) endCompressed() error {
+	if d.in == nil {
+		return nil
+	}
+	n, err := d.r.Read(d.buf[:1])
+	if n > 0 {
+		return &CorruptionError{Offset: d.n, Err: ErrTrailingData}
+	}
+	if err != io.EOF {
+		if err == nil {
+			err = io.ErrNoProgress
+		}
+		return &CorruptionError{Offset: d.n, Err: err}
+	}
+	return nil
+}
+
+// inputCounter counts the compressed bytes a decompressor takes. It is an
+// io.ByteReader so that the decompressor never reads past the end of its
+// stream.
+type inputCounter struct {
+	r   io.Reader
+	n   int64
+	buf [1]byte
+}
+
+func (c *inputCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *inputCounter) ReadByte() (byte, error) {
+	if br, ok := c.r.(io.ByteReader); ok {
+		b, err := br.ReadByte()
+		if err == nil {
+			c.n++
+		}
+		return b, err
+	}
+	if _, err := io.ReadFull(c.r, c.buf[:]); err != nil {
+		return 0, err
+	}
+	c.n++
+	return c.buf[0], nil
+}
@@ -0,0 +1,131 @@
+package persist
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCompression(t *testing.T) {
+	values := make([]string, 200)
+	for i := range values {
+		values[i] = strings.Repeat("value ", 10)
+	}
+	plain := encodeRecords(t, EncodeOptions{}, values...)
+
+	for _, c := range []Compression{CompressionGzip, CompressionFlate} {
+		t.Run(c.String(), func(t *testing.T) {
+			opts := EncodeOptions{RecordChecksums: true, Compression: c}
+			data := encodeRecords(t, opts, values...)
+			if len(data) >= len(plain)/4 {
+				t.Errorf("compressed to %d bytes, plain is %d", len(data), len(plain))
+			}
+			if !bytes.Equal(data[:4], Magic[:]) {
+				t.Errorf("compressed file starts with %q, want the plain magic", data[:4])
+			}
+
+			dec := NewDecoder(bytes.NewReader(append(data, "trailing"...)))
+			h, err := dec.ReadHeader()
+			if err != nil || h.Flags != opts.Flags() {
+				t.Fatalf("ReadHeader() = %+v, %v", h, err)
+			}
+			for range values {
+				if _, err := String.Decode(dec); err != nil {
+					t.Fatalf("Decode() failed: %v", err)
+				}
+				if err := dec.EndRecord(); err != nil {
+					t.Fatalf("EndRecord() failed: %v", err)
+				}
+			}
+			if err := dec.Finish(); err != nil {
+				t.Fatalf("Finish() failed: %v", err)
+			}
+			if dec.Offset() != int64(len(data)) {
+				t.Errorf("Offset() = %d, want the compressed size %d", dec.Offset(), len(data))
+			}
+
+			for _, damaged := range [][]byte{data[:len(data)-2], flipByte(data, len(data)/2)} {
+				_, err := decodeRecords(damaged, len(values))
+				var corrupt *CorruptionError
+				if !errors.As(err, &corrupt) {
+					t.Errorf("decode of damaged input = %v, want a CorruptionError", err)
+				}
+			}
+
+			_, err = decodeRecords(data, len(values)-1)
+			if !errors.Is(err, ErrChecksum) && !errors.Is(err, ErrTrailingData) {
+				t.Errorf("decode stopping early = %v, want it to notice the rest of the stream", err)
+			}
+		})
+	}
+
+	t.Run("Limits", func(t *testing.T) {
+		data := encodeRecords(t, EncodeOptions{Compression: CompressionGzip}, values...)
+		dec := NewDecoder(bytes.NewReader(data), DecodeOptions{MaxTotalBytes: int64(len(data) * 2)})
+		dec.ReadHeader()
+		var err error
+		for i := 0; i < len(values) && err == nil; i++ {
+			_, err = String.Decode(dec)
+		}
+		if !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("decode past MaxTotalBytes = %v, want ErrLimitExceeded", err)
+		}
+	})
+
+	t.Run("BothFlags", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := NewEncoder(&buf).WriteHeader(Header{Type: TypeArray, Flags: FlagGzip | FlagFlate})
+		if !errors.Is(err, ErrUnknownFlags) {
+			t.Errorf("WriteHeader() = %v, want ErrUnknownFlags", err)
+		}
+		data := append([]byte(nil), plain...)
+		data[8] |= uint8(FlagGzip | FlagFlate)
+		if _, err := NewDecoder(bytes.NewReader(data)).ReadHeader(); !errors.Is(err, ErrUnknownFlags) {
+			t.Errorf("ReadHeader() = %v, want ErrUnknownFlags", err)
+		}
+	})
+}
+
+func flipByte(data []byte, offset int) []byte {
+	damaged := append([]byte(nil), data...)
+	damaged[offset] ^= 0xff
+	return damaged
+}
+
+func TestDetectCompression(t *testing.T) {
+	text := strings.Repeat("line\n", 100)
+	for _, opts := range []EncodeOptions{{}, {Compression: CompressionGzip}, {Compression: CompressionFlate}} {
+		var buf bytes.Buffer
+		enc := NewEncoder(&buf)
+		if err := enc.CompressText(opts); err != nil {
+			t.Fatalf("CompressText(%v) failed: %v", opts.Compression, err)
+		}
+		io.WriteString(enc, text)
+		if err := enc.Finish(); err != nil {
+			t.Fatalf("Finish() failed: %v", err)
+		}
+		if compressed := buf.Len() < len(text); compressed != (opts.Compression != CompressionNone) {
+			t.Errorf("%v: wrote %d bytes for %d bytes of text", opts.Compression, buf.Len(), len(text))
+		}
+
+		dec := NewDecoder(&buf)
+		if err := dec.DetectCompression(); err != nil {
+			t.Fatalf("DetectCompression() failed: %v", err)
+		}
+		if got, err := io.ReadAll(dec); err != nil || string(got) != text {
+			t.Errorf("%v: read %q, %v", opts.Compression, got, err)
+		}
+	}
+
+	for _, input := range []string{"", "x", "\x1f", "\x1fx"} {
+		dec := NewDecoder(strings.NewReader(input))
+		if err := dec.DetectCompression(); err != nil {
+			t.Fatalf("DetectCompression(%q) failed: %v", input, err)
+		}
+		if got, err := io.ReadAll(dec); err != nil || string(got) != input {
+			t.Errorf("read %q, %v; want %q", got, err, input)
+		}
+	}
+}
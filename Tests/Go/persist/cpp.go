@@ -0,0 +1,66 @@
+package persist
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// The C++ containers in Serialization/C++ write their files with raw stream
+// calls: little-endian int and size_t fields, strings as a size_t length
+// followed by their bytes, and no header or checksum. Their text files hold
+// one value per line with no escaping. Each Go container can read and write
+// that layout through its ReadCppFrom/WriteCppTo and
+// ReadCppTextFrom/WriteCppTextTo methods; the golden files under
+// <package>/testdata/cpp were written by Serialization/C++/Golden.
+
+// ErrCppNewline is returned when a value that contains a newline is written
+// in the C++ text format, which has no way to represent it.
+var ErrCppNewline = errors.New("persist: C++ text format cannot hold a newline")
+
+// LineFormat converts values to and from the lines of a text file.
+type LineFormat struct {
+	Quote   func(s string) (string, error)
+	Unquote func(line string) (string, error)
+}
+
+var (
+	// QuotedLines is the format of WriteTextTo: values that cannot be
+	// written verbatim are quoted with QuoteLine.
+	QuotedLines = LineFormat{
+		Quote:   func(s string) (string, error) { return QuoteLine(s), nil },
+		Unquote: UnquoteLine,
+	}
+	// CppLines is the format of the C++ containers: values are written as
+	// they are and values containing a newline are rejected.
+	CppLines = LineFormat{
+		Quote:   cppLine,
+		Unquote: func(line string) (string, error) { return line, nil },
+	}
+)
+
+func cppLine(s string) (string, error) {
+	if strings.Contains(s, "\n") {
+		return "", fmt.Errorf("%w: %q", ErrCppNewline, s)
+	}
+	return s, nil
+}
+
+// ReadFile opens filename and passes its buffered contents to read. It is
+// the counterpart of WriteFile for readers that have no method taking a
+// file name, such as ReadCppFrom:
+//
+//	err := persist.ReadFile("list.bin", list.ReadCppFrom)
+func ReadFile(filename string, read func(r io.Reader) (int64, error)) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("persist: read %s: %w", filename, err)
+	}
+	defer file.Close()
+
+	_, err = read(bufio.NewReader(file))
+	return err
+}
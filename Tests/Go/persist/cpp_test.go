@@ -0,0 +1,51 @@
+package persist
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLineFormats(t *testing.T) {
+	for _, s := range []string{"plain", "", "tab\there", `"quoted"`} {
+		line, err := CppLines.Quote(s)
+		if err != nil || line != s {
+			t.Errorf("CppLines.Quote(%q) = %q, %v, want it unchanged", s, line, err)
+		}
+	}
+	if got, _ := CppLines.Unquote(`"quoted"`); got != `"quoted"` {
+		t.Errorf("CppLines.Unquote() = %q, want it unchanged", got)
+	}
+	if _, err := CppLines.Quote("two\nlines"); !errors.Is(err, ErrCppNewline) {
+		t.Errorf("CppLines.Quote() of two lines = %v, want ErrCppNewline", err)
+	}
+
+	line, _ := QuotedLines.Quote("two\nlines")
+	if got, err := QuotedLines.Unquote(line); err != nil || got != "two\nlines" {
+		t.Errorf("QuotedLines round trip = %q, %v", got, err)
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "data.txt")
+	if err := WriteFile(filename, writeString("contents")); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []byte
+	err := ReadFile(filename, func(r io.Reader) (int64, error) {
+		var err error
+		got, err = io.ReadAll(r)
+		return int64(len(got)), err
+	})
+	if err != nil || string(got) != "contents" {
+		t.Errorf("ReadFile() read %q, %v", got, err)
+	}
+
+	err = ReadFile(filepath.Join(t.TempDir(), "missing"), func(io.Reader) (int64, error) { return 0, nil })
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("ReadFile() of a missing file = %v, want os.ErrNotExist", err)
+	}
+}
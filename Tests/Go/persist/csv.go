@@ -0,0 +1,90 @@
+package persist
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// CSVOptions controls the ExportCSV and ImportCSV methods of the containers.
+// The zero value reads and writes comma-separated files without a header
+// row, taking sequence elements from the first column.
+type CSVOptions struct {
+	// Header writes a header row on export and skips the first row on
+	// import.
+	Header bool
+	// Column is the zero-based column sequences import their elements from.
+	// Maps always read the key from column 0 and the value from column 1.
+	Column int
+	// Comma is the field delimiter. Zero means ','.
+	Comma rune
+}
+
+// RowError reports a CSV row that could not be imported. Rows are counted
+// from 1 and include the header row.
+type RowError struct {
+	Row int
+	Err error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("persist: csv row %d: %v", e.Row, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// NewCSVWriter returns a csv.Writer for w configured by opts.
+func NewCSVWriter(w io.Writer, opts CSVOptions) *csv.Writer {
+	cw := csv.NewWriter(w)
+	if opts.Comma != 0 {
+		cw.Comma = opts.Comma
+	}
+	return cw
+}
+
+// ReadCSV reads the records of a CSV file from d and calls fn for each one
+// after the header. Every record must have the same number of fields, and
+// at least minFields of them. Errors from the input, from the limits of d
+// and from fn are returned as a *RowError.
+func ReadCSV(d *Decoder, opts CSVOptions, minFields int, fn func(record []string) error) error {
+	if opts.Column < 0 {
+		return fmt.Errorf("persist: invalid csv column %d", opts.Column)
+	}
+	cr := csv.NewReader(d)
+	if opts.Comma != 0 {
+		cr.Comma = opts.Comma
+	}
+	cr.ReuseRecord = true
+
+	elements := 0
+	for row := 1; ; row++ {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return &RowError{Row: row, Err: err}
+		}
+		if len(record) < minFields {
+			return &RowError{Row: row, Err: fmt.Errorf("got %d fields, want at least %d", len(record), minFields)}
+		}
+		if row == 1 && opts.Header {
+			continue
+		}
+		elements++
+		if err := d.CheckElements(uint64(elements)); err != nil {
+			return &RowError{Row: row, Err: err}
+		}
+		for _, field := range record {
+			if err := d.CheckStringLength(uint64(len(field))); err != nil {
+				return &RowError{Row: row, Err: err}
+			}
+		}
+		if err := fn(record); err != nil {
+			return &RowError{Row: row, Err: err}
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package persist
+
+import (
+	"encoding/csv"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func readCSV(input string, opts CSVOptions, limits DecodeOptions) ([]string, error) {
+	var got []string
+	err := ReadCSV(NewDecoder(strings.NewReader(input), limits), opts, opts.Column+1, func(record []string) error {
+		if record[opts.Column] == "bad" {
+			return errors.New("bad field")
+		}
+		got = append(got, record[opts.Column])
+		return nil
+	})
+	return got, err
+}
+
+func TestReadCSV(t *testing.T) {
+	t.Run("Records", func(t *testing.T) {
+		input := "name,city\nann,\"New\nYork\"\n\"b,\"\"c\"\"\",Paris\n"
+		got, err := readCSV(input, CSVOptions{Header: true, Column: 1}, DecodeOptions{})
+		if err != nil {
+			t.Fatalf("ReadCSV() failed: %v", err)
+		}
+		if want := []string{"New\nYork", "Paris"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("ReadCSV() read %q, want %q", got, want)
+		}
+
+		got, err = readCSV("a;b\nc;d\n", CSVOptions{Comma: ';'}, DecodeOptions{})
+		if err != nil || !reflect.DeepEqual(got, []string{"a", "c"}) {
+			t.Errorf("ReadCSV() with ';' = %q, %v", got, err)
+		}
+	})
+
+	t.Run("RowErrors", func(t *testing.T) {
+		tests := []struct {
+			name  string
+			input string
+			opts  CSVOptions
+			row   int
+		}{
+			{"FieldCount", "a,b\nc,d\ne\n", CSVOptions{}, 3},
+			{"BareQuote", "a\nb\"c\n", CSVOptions{}, 2},
+			{"MissingColumn", "a\nb\n", CSVOptions{Column: 1}, 1},
+			{"Callback", "key\nok\nbad\n", CSVOptions{Header: true}, 3},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := readCSV(tt.input, tt.opts, DecodeOptions{})
+				var rowErr *RowError
+				if !errors.As(err, &rowErr) || rowErr.Row != tt.row {
+					t.Errorf("ReadCSV() = %v, want an error for row %d", err, tt.row)
+				}
+			})
+		}
+
+		_, err := readCSV("a,b\nc\n", CSVOptions{}, DecodeOptions{})
+		if !errors.Is(err, csv.ErrFieldCount) {
+			t.Errorf("ReadCSV() = %v, want it to wrap csv.ErrFieldCount", err)
+		}
+		if _, err := readCSV("a\n", CSVOptions{Column: -1}, DecodeOptions{}); err == nil {
+			t.Error("ReadCSV() with a negative column succeeded")
+		}
+	})
+
+	t.Run("Limits", func(t *testing.T) {
+		limits := []DecodeOptions{{MaxElements: 2}, {MaxStringLength: 3}, {MaxTotalBytes: 4}}
+		for _, limit := range limits {
+			if _, err := readCSV("a\nb\ncccc\n", CSVOptions{}, limit); !errors.Is(err, ErrLimitExceeded) {
+				t.Errorf("ReadCSV() with %+v = %v, want ErrLimitExceeded", limit, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,84 @@
+package persist
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeString(s string) func(w io.Writer) (int64, error) {
+	return func(w io.Writer) (int64, error) {
+		n, err := io.WriteString(w, s)
+		return int64(n), err
+	}
+}
+
+func assertNoTempFiles(t *testing.T, dir string) {
+	t.Helper()
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if filepath.Ext(e.Name()) != ".bin" {
+			t.Errorf("WriteFile() left %s behind", e.Name())
+		}
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "data.bin")
+
+	t.Run("Create", func(t *testing.T) {
+		if err := WriteFile(filename, writeString("first")); err != nil {
+			t.Fatalf("WriteFile() failed: %v", err)
+		}
+		content, _ := os.ReadFile(filename)
+		if string(content) != "first" {
+			t.Errorf("file holds %q, want %q", content, "first")
+		}
+		info, _ := os.Stat(filename)
+		if info.Mode().Perm() != 0644 {
+			t.Errorf("new file mode = %v, want 0644", info.Mode().Perm())
+		}
+		assertNoTempFiles(t, dir)
+	})
+
+	t.Run("Replace", func(t *testing.T) {
+		os.Chmod(filename, 0600)
+		if err := WriteFile(filename, writeString("second")); err != nil {
+			t.Fatalf("WriteFile() failed: %v", err)
+		}
+		content, _ := os.ReadFile(filename)
+		if string(content) != "second" {
+			t.Errorf("file holds %q, want %q", content, "second")
+		}
+		info, _ := os.Stat(filename)
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("replaced file mode = %v, want 0600", info.Mode().Perm())
+		}
+	})
+
+	t.Run("FailedWriteKeepsOldFile", func(t *testing.T) {
+		failing := errors.New("encode failed")
+		err := WriteFile(filename, func(w io.Writer) (int64, error) {
+			io.WriteString(w, "partial")
+			return 7, failing
+		})
+		if !errors.Is(err, failing) {
+			t.Errorf("WriteFile() = %v, want %v", err, failing)
+		}
+		content, _ := os.ReadFile(filename)
+		if string(content) != "second" {
+			t.Errorf("file holds %q after failed write, want %q", content, "second")
+		}
+		assertNoTempFiles(t, dir)
+	})
+
+	t.Run("MissingDirectory", func(t *testing.T) {
+		missing := filepath.Join(dir, "no", "such", "dir", "data.bin")
+		if err := WriteFile(missing, writeString("x")); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("WriteFile() into a missing directory = %v, want os.ErrNotExist", err)
+		}
+	})
+}
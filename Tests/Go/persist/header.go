@@ -0,0 +1,252 @@
+package persist
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Magic opens every binary container file.
+var Magic = [4]byte{'L', 'T', 'C', 'F'}
+
+// Version is the envelope version written by this package.
+const Version = 1
+
+// HeaderSize is the number of bytes taken by an encoded Header.
+const HeaderSize = 10
+
+// ContainerType identifies the container stored in a file.
+type ContainerType uint8
+
+const (
+	TypeArray ContainerType = iota + 1
+	TypeDoubleList
+	TypeForwardList
+	TypeQueue
+	TypeStack
+	TypeChainMap
+	TypeRedBlack
+	TypeDeque
+)
+
+var typeNames = map[ContainerType]string{
+	TypeArray:       "Array",
+	TypeDoubleList:  "DoubleList",
+	TypeForwardList: "ForwardList",
+	TypeQueue:       "Queue",
+	TypeStack:       "Stack",
+	TypeChainMap:    "ChainMap",
+	TypeRedBlack:    "RedBlack",
+	TypeDeque:       "Deque",
+}
+
+func (t ContainerType) String() string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("ContainerType(%d)", uint8(t))
+}
+
+// Encoding identifies the codec used for keys or values.
+type Encoding uint8
+
+const (
+	EncodingNone Encoding = iota
+	EncodingString32
+	EncodingString64
+	EncodingInt64
+	EncodingInt32
+	EncodingBytes
+	EncodingJSON
+	// EncodingCustom marks a codec this package does not know about. It is
+	// accepted on read whatever codec the reader uses.
+	EncodingCustom
+)
+
+var encodingNames = map[Encoding]string{
+	EncodingNone:     "none",
+	EncodingString32: "string32",
+	EncodingString64: "string64",
+	EncodingInt64:    "int64",
+	EncodingInt32:    "int32",
+	EncodingBytes:    "bytes",
+	EncodingJSON:     "json",
+	EncodingCustom:   "custom",
+}
+
+func (e Encoding) String() string {
+	if name, ok := encodingNames[e]; ok {
+		return name
+	}
+	return fmt.Sprintf("Encoding(%d)", uint8(e))
+}
+
+// EncodingOf reports the Encoding of c. Codecs defined outside this package
+// may implement an Encoding() Encoding method; all others are
+// EncodingCustom.
+func EncodingOf[T any](c Codec[T]) Encoding {
+	if e, ok := c.(interface{ Encoding() Encoding }); ok {
+		return e.Encoding()
+	}
+	return EncodingCustom
+}
+
+// Flags holds optional features of a file. Files with unknown flags are
+// rejected.
+type Flags uint16
+
+const (
+	// FlagChecksum marks files that end with a CRC-32C of everything before
+	// it.
+	FlagChecksum Flags = 1 << iota
+	// FlagRecordChecksums marks files that follow every record with a CRC-32C
+	// of the bytes since the previous record.
+	FlagRecordChecksums
+	// FlagGzip marks files whose body after the header is a gzip stream.
+	FlagGzip
+	// FlagFlate marks files whose body after the header is a raw DEFLATE
+	// stream.
+	FlagFlate
+	// FlagCapacity marks files of bounded containers whose body starts with
+	// the uint64 capacity of the container, zero meaning unbounded.
+	FlagCapacity
+)
+
+const knownFlags = FlagChecksum | FlagRecordChecksums | FlagGzip | FlagFlate | FlagCapacity
+
+// Header is the envelope written in front of every binary container. Maps
+// record their key and value encodings; sequences leave Key as EncodingNone
+// and record their element encoding in Value.
+type Header struct {
+	Type    ContainerType
+	Version uint8
+	Key     Encoding
+	Value   Encoding
+	Flags   Flags
+}
+
+var (
+	// ErrNoHeader is returned when the input does not start with Magic. Files
+	// written before the envelope existed must be read in legacy mode.
+	ErrNoHeader = errors.New("persist: missing container header")
+	// ErrUnknownFlags is returned for headers that use flags this package does
+	// not understand.
+	ErrUnknownFlags = errors.New("persist: unknown header flags")
+)
+
+// TypeError is returned when a file holds a different container type.
+type TypeError struct {
+	Want, Got ContainerType
+}
+
+func (e *TypeError) Error() string {
+	return fmt.Sprintf("persist: file holds a %v, not a %v", e.Got, e.Want)
+}
+
+// VersionError is returned for envelope versions this package cannot read.
+type VersionError struct {
+	Version uint8
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("persist: unsupported format version %d", e.Version)
+}
+
+// EncodingError is returned when the elements of a file were written with a
+// different codec than the one the reader is configured with.
+type EncodingError struct {
+	Field     string
+	Want, Got Encoding
+}
+
+func (e *EncodingError) Error() string {
+	return fmt.Sprintf("persist: %s encoding is %v, reader expects %v", e.Field, e.Got, e.Want)
+}
+
+// WriteHeader writes h with the current Version.
+func (e *Encoder) WriteHeader(h Header) error {
+	c, err := compressionOf(h.Flags)
+	if err != nil {
+		return err
+	}
+	var buf [HeaderSize]byte
+	copy(buf[:4], Magic[:])
+	buf[4] = Version
+	buf[5] = uint8(h.Type)
+	buf[6] = uint8(h.Key)
+	buf[7] = uint8(h.Value)
+	buf[8] = uint8(h.Flags)
+	buf[9] = uint8(h.Flags >> 8)
+	if _, err := e.Write(buf[:]); err != nil {
+		return err
+	}
+	e.start(h.Flags)
+	return e.compress(c)
+}
+
+// ReadHeader reads a header and checks its magic, version and flags. If the
+// flags mark the body as compressed, the rest of the input is decompressed.
+func (d *Decoder) ReadHeader() (Header, error) {
+	var buf [HeaderSize]byte
+	if err := d.readFull(buf[:4]); err != nil {
+		if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+			return Header{}, ErrNoHeader
+		}
+		return Header{}, err
+	}
+	if [4]byte(buf[:4]) != Magic {
+		return Header{}, ErrNoHeader
+	}
+	if err := d.readFull(buf[4:]); err != nil {
+		return Header{}, err
+	}
+
+	h := Header{
+		Version: buf[4],
+		Type:    ContainerType(buf[5]),
+		Key:     Encoding(buf[6]),
+		Value:   Encoding(buf[7]),
+		Flags:   Flags(buf[8]) | Flags(buf[9])<<8,
+	}
+	if h.Version != Version {
+		return h, &VersionError{Version: h.Version}
+	}
+	if h.Flags&^knownFlags != 0 {
+		return h, fmt.Errorf("%w: %#x", ErrUnknownFlags, uint16(h.Flags&^knownFlags))
+	}
+	c, err := compressionOf(h.Flags)
+	if err != nil {
+		return h, err
+	}
+	d.start(h.Flags)
+	d.recordStart = d.n
+	return h, d.decompress(c)
+}
+
+// ExpectHeader reads a header and checks that it describes a container of
+// want.Type whose encodings match want.Key and want.Value.
+func (d *Decoder) ExpectHeader(want Header) (Header, error) {
+	h, err := d.ReadHeader()
+	if err != nil {
+		return h, err
+	}
+	if h.Type != want.Type {
+		return h, &TypeError{Want: want.Type, Got: h.Type}
+	}
+	if !encodingMatches(want.Key, h.Key) {
+		return h, &EncodingError{Field: "key", Want: want.Key, Got: h.Key}
+	}
+	if !encodingMatches(want.Value, h.Value) {
+		return h, &EncodingError{Field: "value", Want: want.Value, Got: h.Value}
+	}
+	return h, nil
+}
+
+func encodingMatches(want, got Encoding) bool {
+	if want == got {
+		return true
+	}
+	// Custom codecs cannot be told apart, so trust the caller.
+	return want != EncodingNone && got != EncodingNone &&
+		(want == EncodingCustom || got == EncodingCustom)
+}
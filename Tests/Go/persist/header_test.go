@@ -0,0 +1,142 @@
+package persist
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func encodeHeader(t *testing.T, h Header) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	if err := enc.WriteHeader(h); err != nil {
+		t.Fatalf("WriteHeader() failed: %v", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("Flush() failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestHeader(t *testing.T) {
+	want := Header{Type: TypeChainMap, Version: Version, Key: EncodingString64, Value: EncodingInt32}
+	data := encodeHeader(t, want)
+	if len(data) != HeaderSize {
+		t.Fatalf("WriteHeader() wrote %d bytes, want %d", len(data), HeaderSize)
+	}
+	if !bytes.Equal(data[:4], Magic[:]) {
+		t.Errorf("header starts with %q, want %q", data[:4], Magic[:])
+	}
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		dec := NewDecoder(bytes.NewReader(data))
+		got, err := dec.ExpectHeader(want)
+		if err != nil {
+			t.Fatalf("ExpectHeader() failed: %v", err)
+		}
+		if got != want {
+			t.Errorf("ExpectHeader() = %+v, want %+v", got, want)
+		}
+		if dec.Offset() != HeaderSize {
+			t.Errorf("Decoder.Offset() = %d, want %d", dec.Offset(), HeaderSize)
+		}
+	})
+
+	t.Run("NoHeader", func(t *testing.T) {
+		for _, input := range [][]byte{nil, {'L', 'T'}, {1, 0, 0, 0, 0, 0, 0, 0}} {
+			if _, err := NewDecoder(bytes.NewReader(input)).ReadHeader(); !errors.Is(err, ErrNoHeader) {
+				t.Errorf("ReadHeader(%v) = %v, want ErrNoHeader", input, err)
+			}
+		}
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		_, err := NewDecoder(bytes.NewReader(data[:6])).ReadHeader()
+		if err == nil || errors.Is(err, ErrNoHeader) {
+			t.Errorf("ReadHeader() of truncated header = %v, want a read error", err)
+		}
+	})
+
+	t.Run("Version", func(t *testing.T) {
+		newer := append([]byte(nil), data...)
+		newer[4] = Version + 1
+		var versionErr *VersionError
+		_, err := NewDecoder(bytes.NewReader(newer)).ReadHeader()
+		if !errors.As(err, &versionErr) || versionErr.Version != Version+1 {
+			t.Errorf("ReadHeader() of version %d = %v, want VersionError", Version+1, err)
+		}
+	})
+
+	t.Run("UnknownFlags", func(t *testing.T) {
+		flagged := encodeHeader(t, Header{Type: TypeArray, Flags: 0x8000})
+		if _, err := NewDecoder(bytes.NewReader(flagged)).ReadHeader(); !errors.Is(err, ErrUnknownFlags) {
+			t.Errorf("ReadHeader() with unknown flags = %v, want ErrUnknownFlags", err)
+		}
+	})
+
+	t.Run("Type", func(t *testing.T) {
+		var typeErr *TypeError
+		_, err := NewDecoder(bytes.NewReader(data)).ExpectHeader(Header{Type: TypeQueue})
+		if !errors.As(err, &typeErr) || typeErr.Got != TypeChainMap || typeErr.Want != TypeQueue {
+			t.Errorf("ExpectHeader() of wrong type = %v, want TypeError", err)
+		}
+		if typeErr != nil && typeErr.Error() != "persist: file holds a ChainMap, not a Queue" {
+			t.Errorf("TypeError.Error() = %q", typeErr.Error())
+		}
+	})
+
+	t.Run("Encoding", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			expect Header
+			ok     bool
+		}{
+			{"Match", want, true},
+			{"ValueMismatch", Header{Type: TypeChainMap, Key: EncodingString64, Value: EncodingInt64}, false},
+			{"KeyMismatch", Header{Type: TypeChainMap, Key: EncodingString32, Value: EncodingInt32}, false},
+			{"CustomReader", Header{Type: TypeChainMap, Key: EncodingCustom, Value: EncodingCustom}, true},
+			{"MissingKey", Header{Type: TypeChainMap, Value: EncodingInt32}, false},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := NewDecoder(bytes.NewReader(data)).ExpectHeader(tt.expect)
+				var encErr *EncodingError
+				if tt.ok && err != nil {
+					t.Errorf("ExpectHeader() = %v, want nil", err)
+				}
+				if !tt.ok && !errors.As(err, &encErr) {
+					t.Errorf("ExpectHeader() = %v, want EncodingError", err)
+				}
+			})
+		}
+	})
+}
+
+func TestEncodingOf(t *testing.T) {
+	tests := []struct {
+		name string
+		got  Encoding
+		want Encoding
+	}{
+		{"String", EncodingOf(String), EncodingString32},
+		{"String64", EncodingOf(String64), EncodingString64},
+		{"Int", EncodingOf(Int), EncodingInt64},
+		{"Int32", EncodingOf(Int32), EncodingInt32},
+		{"Bytes", EncodingOf(Bytes), EncodingBytes},
+		{"JSON", EncodingOf(JSON[float64]()), EncodingJSON},
+		{"Custom", EncodingOf[string](customCodec{}), EncodingCustom},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("EncodingOf(%s) = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+type customCodec struct{}
+
+func (customCodec) Encode(e *Encoder, v string) error { return String.Encode(e, v) }
+func (customCodec) Decode(d *Decoder) (string, error) { return String.Decode(d) }
+func (customCodec) Format(v string) (string, error)   { return v, nil }
+func (customCodec) Parse(s string) (string, error)    { return s, nil }
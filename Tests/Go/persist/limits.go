@@ -0,0 +1,104 @@
+package persist
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrLimitExceeded is wrapped by every error caused by input that goes over
+// a DecodeOptions limit.
+var ErrLimitExceeded = errors.New("persist: decode limit exceeded")
+
+// DecodeOptions bounds the resources a reader may spend on its input. A zero
+// field takes its value from DefaultDecodeOptions and a negative field
+// disables that limit.
+type DecodeOptions struct {
+	// MaxElements caps the element count a file may declare.
+	MaxElements int64
+	// MaxStringLength caps the length of a single string or byte slice in
+	// binary input.
+	MaxStringLength int64
+	// MaxTotalBytes caps the number of bytes read from the input.
+	MaxTotalBytes int64
+	// MaxHashmapCapacity caps the bucket count a hash map file may declare.
+	MaxHashmapCapacity int64
+}
+
+// DefaultDecodeOptions holds the limits used when none are configured.
+var DefaultDecodeOptions = DecodeOptions{
+	MaxElements:        1 << 24,
+	MaxStringLength:    1 << 26,
+	MaxTotalBytes:      1 << 32,
+	MaxHashmapCapacity: 1 << 24,
+}
+
+// withDefaults fills zero fields from DefaultDecodeOptions.
+func (o DecodeOptions) withDefaults() DecodeOptions {
+	if o.MaxElements == 0 {
+		o.MaxElements = DefaultDecodeOptions.MaxElements
+	}
+	if o.MaxStringLength == 0 {
+		o.MaxStringLength = DefaultDecodeOptions.MaxStringLength
+	}
+	if o.MaxTotalBytes == 0 {
+		o.MaxTotalBytes = DefaultDecodeOptions.MaxTotalBytes
+	}
+	if o.MaxHashmapCapacity == 0 {
+		o.MaxHashmapCapacity = DefaultDecodeOptions.MaxHashmapCapacity
+	}
+	return o
+}
+
+func checkLimit(what string, n uint64, limit int64) error {
+	if limit >= 0 && n > uint64(limit) {
+		return fmt.Errorf("%w: %s %d is over the limit of %d", ErrLimitExceeded, what, n, limit)
+	}
+	return nil
+}
+
+// CheckElements rejects element counts over MaxElements. Readers call it on
+// a declared size before allocating anything for it.
+func (d *Decoder) CheckElements(n uint64) error {
+	return checkLimit("element count", n, d.limits.MaxElements)
+}
+
+// ParseCount parses the element count a text file declares and checks it
+// against MaxElements. Anything but a non-negative decimal number is
+// reported as a CorruptionError at the current offset, the way binary
+// readers report a malformed size.
+func (d *Decoder) ParseCount(s string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err == nil && n < 0 {
+		err = fmt.Errorf("negative count %d", n)
+	}
+	if err != nil {
+		return 0, &CorruptionError{Offset: d.Offset(), Err: fmt.Errorf("invalid element count: %w", err)}
+	}
+	if err := d.CheckElements(uint64(n)); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// CheckStringLength rejects strings longer than MaxStringLength.
+func (d *Decoder) CheckStringLength(n uint64) error {
+	return checkLimit("string length", n, d.limits.MaxStringLength)
+}
+
+// CheckCapacity rejects hash map capacities over MaxHashmapCapacity.
+func (d *Decoder) CheckCapacity(n uint64) error {
+	return checkLimit("hash map capacity", n, d.limits.MaxHashmapCapacity)
+}
+
+// ScanFailure explains why reading text from s failed: the scanner's own
+// error if it stopped on one, such as a limit hit by the underlying Decoder,
+// and otherwise err. A bufio.Scanner that stops on an error still hands out
+// the partial last line, so parse errors are worth passing through here too.
+func ScanFailure(s interface{ Err() error }, err error) error {
+	if scanErr := s.Err(); scanErr != nil {
+		return scanErr
+	}
+	return err
+}
@@ -0,0 +1,99 @@
+package persist
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestDecodeOptions(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		dec := NewDecoder(bytes.NewReader(nil))
+		if dec.limits != DefaultDecodeOptions {
+			t.Errorf("NewDecoder() limits = %+v, want %+v", dec.limits, DefaultDecodeOptions)
+		}
+		dec = NewDecoder(bytes.NewReader(nil), DecodeOptions{MaxElements: 5, MaxTotalBytes: -1})
+		if dec.limits.MaxElements != 5 || dec.limits.MaxTotalBytes != -1 ||
+			dec.limits.MaxStringLength != DefaultDecodeOptions.MaxStringLength {
+			t.Errorf("NewDecoder() limits = %+v", dec.limits)
+		}
+	})
+
+	t.Run("Checks", func(t *testing.T) {
+		dec := NewDecoder(bytes.NewReader(nil), DecodeOptions{MaxElements: 5, MaxHashmapCapacity: 8, MaxStringLength: -1})
+		if err := dec.CheckElements(5); err != nil {
+			t.Errorf("CheckElements(5) = %v, want nil", err)
+		}
+		if err := dec.CheckElements(6); !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("CheckElements(6) = %v, want ErrLimitExceeded", err)
+		}
+		if err := dec.CheckCapacity(9); !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("CheckCapacity(9) = %v, want ErrLimitExceeded", err)
+		}
+		if err := dec.CheckStringLength(1 << 40); err != nil {
+			t.Errorf("CheckStringLength() with the limit disabled = %v, want nil", err)
+		}
+	})
+
+	t.Run("ParseCount", func(t *testing.T) {
+		dec := NewDecoder(bytes.NewReader(nil), DecodeOptions{MaxElements: 5})
+		if n, err := dec.ParseCount(" 5 "); err != nil || n != 5 {
+			t.Errorf("ParseCount(\" 5 \") = %d, %v, want 5, nil", n, err)
+		}
+		for _, s := range []string{"-3", "x", "", "9999999999999999999999"} {
+			var corrupt *CorruptionError
+			if _, err := dec.ParseCount(s); !errors.As(err, &corrupt) {
+				t.Errorf("ParseCount(%q) = %v, want CorruptionError", s, err)
+			}
+		}
+		if _, err := dec.ParseCount("6"); !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("ParseCount(\"6\") = %v, want ErrLimitExceeded", err)
+		}
+	})
+
+	t.Run("StringLength", func(t *testing.T) {
+		data := []byte{0xff, 0xff, 0xff, 0x7f}
+		dec := NewDecoder(bytes.NewReader(data), DecodeOptions{MaxStringLength: 16})
+		if _, err := String.Decode(dec); !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("String.Decode() of a 2 GiB length = %v, want ErrLimitExceeded", err)
+		}
+	})
+
+	t.Run("TotalBytes", func(t *testing.T) {
+		exact := NewDecoder(bytes.NewReader(make([]byte, 8)), DecodeOptions{MaxTotalBytes: 8})
+		if _, err := exact.Uint64(); err != nil {
+			t.Fatalf("Uint64() at exactly the limit failed: %v", err)
+		}
+		if _, err := exact.Uint8(); errors.Is(err, ErrLimitExceeded) || !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("Uint8() past the end = %v, want io.ErrUnexpectedEOF", err)
+		}
+
+		over := NewDecoder(bytes.NewReader(make([]byte, 16)), DecodeOptions{MaxTotalBytes: 8})
+		over.Uint64()
+		if _, err := over.Uint64(); !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("Uint64() past the limit = %v, want ErrLimitExceeded", err)
+		}
+		if over.Offset() > 9 {
+			t.Errorf("Decoder read %d bytes, want at most one past the limit", over.Offset())
+		}
+	})
+
+	t.Run("ScanFailure", func(t *testing.T) {
+		eof := errors.New("eof")
+		dec := NewDecoder(strings.NewReader("line\nline\n"), DecodeOptions{MaxTotalBytes: 6})
+		scanner := bufio.NewScanner(dec)
+		for scanner.Scan() {
+		}
+		if err := ScanFailure(scanner, eof); !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("ScanFailure() after hitting the limit = %v, want ErrLimitExceeded", err)
+		}
+		scanner = bufio.NewScanner(strings.NewReader(""))
+		scanner.Scan()
+		if err := ScanFailure(scanner, eof); err != eof {
+			t.Errorf("ScanFailure() at end of input = %v, want %v", err, eof)
+		}
+	})
+}
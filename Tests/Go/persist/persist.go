@@ -0,0 +1,212 @@
+// Package persist holds the encoding primitives shared by the containers'
+// WriteBinary/ReadBinary and WriteText/ReadText methods. Every binary file
+// starts with a Header naming the container type and element encodings.
+package persist
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Encoder writes little-endian primitives to an underlying writer. Output is
+// buffered; call Flush once everything has been encoded.
+type Encoder struct {
+	w   *bufio.Writer
+	cw  countingWriter
+	z   io.WriteCloser // compressor, once the header asked for one
+	buf [8]byte
+	checksums
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	e := &Encoder{cw: countingWriter{w: w}}
+	e.w = bufio.NewWriter(&e.cw)
+	return e
+}
+
+func (e *Encoder) Write(p []byte) (int, error) {
+	n, err := e.w.Write(p)
+	e.update(p[:n])
+	return n, err
+}
+
+func (e *Encoder) Flush() error {
+	return e.w.Flush()
+}
+
+// Len returns the number of bytes that have reached the underlying writer.
+// For compressed files that is the compressed size.
+func (e *Encoder) Len() int64 {
+	return e.cw.n
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (e *Encoder) Uint8(v uint8) error {
+	e.buf[0] = v
+	_, err := e.Write(e.buf[:1])
+	return err
+}
+
+func (e *Encoder) Uint32(v uint32) error {
+	binary.LittleEndian.PutUint32(e.buf[:4], v)
+	_, err := e.Write(e.buf[:4])
+	return err
+}
+
+func (e *Encoder) Uint64(v uint64) error {
+	binary.LittleEndian.PutUint64(e.buf[:8], v)
+	_, err := e.Write(e.buf[:8])
+	return err
+}
+
+// Decoder reads little-endian primitives from an underlying reader. Every read
+// is a full read: a short input is reported as io.ErrUnexpectedEOF. The
+// decoder never reads past the last byte it is asked for, so callers that
+// read from files should hand it a buffered reader.
+type Decoder struct {
+	r      io.Reader
+	n      int64
+	buf    [8]byte
+	limits DecodeOptions
+	checksums
+
+	// in counts the compressed input once the decoder has switched to a
+	// decompressor, which started at offset inStart.
+	in      *inputCounter
+	inStart int64
+}
+
+// NewDecoder returns a decoder for r. Without options it enforces
+// DefaultDecodeOptions; with several, only the first is used.
+func NewDecoder(r io.Reader, opts ...DecodeOptions) *Decoder {
+	var limits DecodeOptions
+	if len(opts) > 0 {
+		limits = opts[0]
+	}
+	return &Decoder{r: r, limits: limits.withDefaults()}
+}
+
+func (d *Decoder) Read(p []byte) (int, error) {
+	max := d.limits.MaxTotalBytes
+	if max >= 0 {
+		if d.n > max {
+			return 0, d.totalBytesError()
+		}
+		// Read one byte past the limit so that input of exactly max bytes
+		// still reaches EOF.
+		if remaining := max - d.n + 1; int64(len(p)) > remaining {
+			p = p[:remaining]
+		}
+	}
+	n, err := d.r.Read(p)
+	d.n += int64(n)
+	d.update(p[:n])
+	if max >= 0 && d.n > max {
+		return n, d.totalBytesError()
+	}
+	if d.in != nil && err != nil && err != io.EOF {
+		err = &CorruptionError{Offset: d.n, Err: err}
+	}
+	return n, err
+}
+
+func (d *Decoder) totalBytesError() error {
+	return fmt.Errorf("%w: input is longer than %d bytes", ErrLimitExceeded, d.limits.MaxTotalBytes)
+}
+
+// Offset returns the number of bytes consumed so far. For compressed files
+// it counts the compressed input, which is what ReadFrom methods report.
+func (d *Decoder) Offset() int64 {
+	if d.in != nil {
+		return d.inStart + d.in.n
+	}
+	return d.n
+}
+
+// readFull reports running out of input part way through as a
+// CorruptionError wrapping io.ErrUnexpectedEOF. Empty input is io.EOF.
+func (d *Decoder) readFull(p []byte) error {
+	_, err := io.ReadFull(d, p)
+	if (err == io.EOF && d.n > 0) || err == io.ErrUnexpectedEOF {
+		return &CorruptionError{Offset: d.n, Err: io.ErrUnexpectedEOF}
+	}
+	return err
+}
+
+func (d *Decoder) Uint8() (uint8, error) {
+	if err := d.readFull(d.buf[:1]); err != nil {
+		return 0, err
+	}
+	return d.buf[0], nil
+}
+
+func (d *Decoder) Uint32() (uint32, error) {
+	if err := d.readFull(d.buf[:4]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(d.buf[:4]), nil
+}
+
+func (d *Decoder) Uint64() (uint64, error) {
+	if err := d.readFull(d.buf[:8]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(d.buf[:8]), nil
+}
+
+// Bytes reads exactly n bytes.
+func (d *Decoder) Bytes(n uint64) ([]byte, error) {
+	if err := d.CheckStringLength(n); err != nil {
+		return nil, err
+	}
+	if n > uint64(maxInt) {
+		return nil, fmt.Errorf("length %d is too large", n)
+	}
+	p := make([]byte, n)
+	if err := d.readFull(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+const maxInt = int(^uint(0) >> 1)
+
+// ErrTrailingData is returned by UnmarshalBinary when the input continues
+// after the encoded container.
+var ErrTrailingData = errors.New("persist: trailing data after encoded container")
+
+// MarshalBinary collects the output of a WriteTo method into a byte slice.
+func MarshalBinary(writeTo func(w io.Writer) (int64, error)) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := writeTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary feeds data to a ReadFrom method and makes sure all of it
+// was consumed.
+func UnmarshalBinary(data []byte, readFrom func(r io.Reader) (int64, error)) error {
+	n, err := readFrom(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if n != int64(len(data)) {
+		return ErrTrailingData
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package persist
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestMarshalUnmarshalBinary(t *testing.T) {
+	writeTo := func(w io.Writer) (int64, error) {
+		n, err := w.Write([]byte{1, 2, 3})
+		return int64(n), err
+	}
+	data, err := MarshalBinary(writeTo)
+	if err != nil {
+		t.Fatalf("MarshalBinary() failed: %v", err)
+	}
+	if !bytes.Equal(data, []byte{1, 2, 3}) {
+		t.Errorf("MarshalBinary() = %v, want [1 2 3]", data)
+	}
+
+	readThree := func(r io.Reader) (int64, error) {
+		n, err := io.ReadFull(r, make([]byte, 3))
+		return int64(n), err
+	}
+	if err := UnmarshalBinary(data, readThree); err != nil {
+		t.Errorf("UnmarshalBinary() failed: %v", err)
+	}
+	if err := UnmarshalBinary(append(data, 4), readThree); !errors.Is(err, ErrTrailingData) {
+		t.Errorf("UnmarshalBinary() with trailing data = %v, want ErrTrailingData", err)
+	}
+	if err := UnmarshalBinary(data[:2], readThree); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("UnmarshalBinary() of short data = %v, want io.ErrUnexpectedEOF", err)
+	}
+
+	failing := errors.New("write failed")
+	if _, err := MarshalBinary(func(io.Writer) (int64, error) { return 0, failing }); err != failing {
+		t.Errorf("MarshalBinary() error = %v, want %v", err, failing)
+	}
+}
+
+func TestEncoderDecoderCounts(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.Uint8(1)
+	enc.Uint32(2)
+	enc.Uint64(3)
+	if enc.Len() != 0 {
+		t.Errorf("Encoder.Len() before Flush = %d, want 0", enc.Len())
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("Flush() failed: %v", err)
+	}
+	if enc.Len() != 13 || buf.Len() != 13 {
+		t.Errorf("Encoder.Len() = %d, buffer holds %d bytes, want 13", enc.Len(), buf.Len())
+	}
+
+	dec := NewDecoder(&buf)
+	a, _ := dec.Uint8()
+	b, _ := dec.Uint32()
+	c, _ := dec.Uint64()
+	if a != 1 || b != 2 || c != 3 {
+		t.Errorf("decoded %d %d %d, want 1 2 3", a, b, c)
+	}
+	if dec.Offset() != 13 {
+		t.Errorf("Decoder.Offset() = %d, want 13", dec.Offset())
+	}
+}
@@ -0,0 +1,344 @@
+// Package persisttest checks that a container's serialization methods keep
+// the contract shared by every container in this module: round trips
+// through the binary and text formats, the header, checksums, compression,
+// decode limits and leaving the container unchanged when a read fails.
+package persisttest
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"Go/persist"
+)
+
+// Container is the set of serialization methods TestContainer exercises.
+// The legacy and text formats are checked too if the container implements
+// LegacyReader and TextContainer.
+type Container interface {
+	WriteTo(w io.Writer) (int64, error)
+	ReadFrom(r io.Reader) (int64, error)
+	MarshalBinary() ([]byte, error)
+	UnmarshalBinary(data []byte) error
+	SetEncodeOptions(opts persist.EncodeOptions)
+	SetDecodeOptions(opts persist.DecodeOptions)
+}
+
+// LegacyReader is implemented by containers that read the binary format
+// without a header that predates it.
+type LegacyReader interface {
+	ReadLegacyFrom(r io.Reader) (int64, error)
+}
+
+// TextContainer is implemented by containers with a text format.
+type TextContainer interface {
+	WriteTextTo(w io.Writer) (int64, error)
+	ReadTextFrom(r io.Reader) (int64, error)
+}
+
+// Fixture tells TestContainer how to build and inspect one container type.
+type Fixture[C Container] struct {
+	// New returns an empty container for reads to load into.
+	New func() C
+	// Make returns a container holding one element per value, in whatever
+	// role the container gives its strings: elements, keys or values.
+	Make func(values []string) C
+	// Contents returns what c holds as a slice or map that reflect.DeepEqual
+	// can compare, with one entry per element.
+	Contents func(c C) any
+	// LegacySkip is the number of bytes after the header that the legacy
+	// format lacks, such as a capacity recorded since.
+	LegacySkip int
+}
+
+// filledValues are the values of the container most cases write. The space
+// matters to text formats that separate fields with one.
+var filledValues = []string{"a", "b c", "d"}
+
+// quotingValues are strings that text formats can only store quoted, or that
+// a line scanner with a size limit would choke on.
+var quotingValues = []string{"two\nlines", "", `"quoted"`, "crlf\r", "\xff\xfe", " padded ", "a b c", strings.Repeat("x", 100000)}
+
+// TestContainer runs the shared serialization cases against the container
+// described by f, each as a subtest of t.
+func TestContainer[C Container](t *testing.T, f Fixture[C]) {
+	newFilled := func() C {
+		return f.Make(filledValues)
+	}
+	want := f.Contents(newFilled())
+	check := func(t *testing.T, what string, loaded C, want any) {
+		t.Helper()
+		if got := f.Contents(loaded); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s loaded %q, want %q", what, got, want)
+		}
+	}
+	marshal := func(t *testing.T, c C) []byte {
+		t.Helper()
+		data, err := c.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary() failed: %v", err)
+		}
+		return data
+	}
+	_, hasText := any(f.New()).(TextContainer)
+	asText := func(t *testing.T, c C) TextContainer {
+		t.Helper()
+		if !hasText {
+			t.Skip("no text format")
+		}
+		return any(c).(TextContainer)
+	}
+	writeText := func(t *testing.T, c C) *bytes.Buffer {
+		t.Helper()
+		var buf bytes.Buffer
+		if _, err := asText(t, c).WriteTextTo(&buf); err != nil {
+			t.Fatalf("WriteTextTo() failed: %v", err)
+		}
+		return &buf
+	}
+
+	t.Run("Binary", func(t *testing.T) {
+		var buf bytes.Buffer
+		n, err := newFilled().WriteTo(&buf)
+		if err != nil {
+			t.Fatalf("WriteTo() failed: %v", err)
+		}
+		if n != int64(buf.Len()) {
+			t.Errorf("WriteTo() = %d, wrote %d bytes", n, buf.Len())
+		}
+
+		loaded := f.New()
+		m, err := loaded.ReadFrom(&buf)
+		if err != nil {
+			t.Fatalf("ReadFrom() failed: %v", err)
+		}
+		if m != n {
+			t.Errorf("ReadFrom() = %d, want %d", m, n)
+		}
+		check(t, "ReadFrom()", loaded, want)
+	})
+
+	t.Run("Text", func(t *testing.T) {
+		var buf bytes.Buffer
+		n, err := asText(t, newFilled()).WriteTextTo(&buf)
+		if err != nil {
+			t.Fatalf("WriteTextTo() failed: %v", err)
+		}
+		if n != int64(buf.Len()) {
+			t.Errorf("WriteTextTo() = %d, wrote %d bytes", n, buf.Len())
+		}
+
+		loaded := f.New()
+		if _, err := asText(t, loaded).ReadTextFrom(&buf); err != nil {
+			t.Fatalf("ReadTextFrom() failed: %v", err)
+		}
+		check(t, "ReadTextFrom()", loaded, want)
+	})
+
+	t.Run("TextQuoting", func(t *testing.T) {
+		original := f.Make(quotingValues)
+		buf := writeText(t, original)
+		loaded := f.New()
+		if _, err := asText(t, loaded).ReadTextFrom(buf); err != nil {
+			t.Fatalf("ReadTextFrom() failed: %v", err)
+		}
+		check(t, "ReadTextFrom()", loaded, f.Contents(original))
+	})
+
+	t.Run("MarshalBinary", func(t *testing.T) {
+		data := marshal(t, newFilled())
+		loaded := f.New()
+		if err := loaded.UnmarshalBinary(data); err != nil {
+			t.Fatalf("UnmarshalBinary() failed: %v", err)
+		}
+		check(t, "UnmarshalBinary()", loaded, want)
+
+		if err := loaded.UnmarshalBinary(append(data, 0)); !errors.Is(err, persist.ErrTrailingData) {
+			t.Errorf("UnmarshalBinary() with trailing data = %v, want ErrTrailingData", err)
+		}
+	})
+
+	t.Run("Header", func(t *testing.T) {
+		data := marshal(t, newFilled())
+		legacy := data[persist.HeaderSize+f.LegacySkip : len(data)-persist.ChecksumSize]
+		loaded := f.New()
+		if _, err := loaded.ReadFrom(bytes.NewReader(legacy)); !errors.Is(err, persist.ErrNoHeader) {
+			t.Errorf("ReadFrom() of headerless data = %v, want ErrNoHeader", err)
+		}
+		if legacyReader, ok := any(loaded).(LegacyReader); ok {
+			n, err := legacyReader.ReadLegacyFrom(bytes.NewReader(legacy))
+			if err != nil {
+				t.Fatalf("ReadLegacyFrom() failed: %v", err)
+			}
+			if n != int64(len(legacy)) {
+				t.Errorf("ReadLegacyFrom() = %d, want %d", n, len(legacy))
+			}
+			check(t, "ReadLegacyFrom()", loaded, want)
+		}
+
+		wrongType := bytes.Clone(data)
+		wrongType[5]++
+		var typeErr *persist.TypeError
+		if err := loaded.UnmarshalBinary(wrongType); !errors.As(err, &typeErr) {
+			t.Errorf("UnmarshalBinary() of another container type = %v, want TypeError", err)
+		}
+
+		newer := bytes.Clone(data)
+		newer[4] = persist.Version + 1
+		var versionErr *persist.VersionError
+		if err := loaded.UnmarshalBinary(newer); !errors.As(err, &versionErr) {
+			t.Errorf("UnmarshalBinary() of a newer version = %v, want VersionError", err)
+		}
+	})
+
+	t.Run("Checksums", func(t *testing.T) {
+		// Damage the bytes of a value, which still decode, so that only the
+		// footer can catch it.
+		data := marshal(t, newFilled())
+		damaged := bytes.Clone(data)
+		damaged[bytes.Index(damaged, []byte("b c"))] ^= 0x01
+		loaded := f.New()
+		var corrupt *persist.CorruptionError
+		if err := loaded.UnmarshalBinary(damaged); !errors.As(err, &corrupt) || !errors.Is(err, persist.ErrChecksum) {
+			t.Errorf("UnmarshalBinary() of damaged data = %v, want checksum CorruptionError", err)
+		}
+
+		withRecords := newFilled()
+		withRecords.SetEncodeOptions(persist.EncodeOptions{RecordChecksums: true})
+		data = marshal(t, withRecords)
+		if err := loaded.UnmarshalBinary(data); err != nil {
+			t.Fatalf("UnmarshalBinary() with record checksums failed: %v", err)
+		}
+		check(t, "UnmarshalBinary() with record checksums", loaded, want)
+
+		damaged = bytes.Clone(data)
+		damaged[persist.HeaderSize] ^= 0x01
+		if err := loaded.UnmarshalBinary(damaged); !errors.As(err, &corrupt) || corrupt.Offset != persist.HeaderSize {
+			t.Errorf("UnmarshalBinary() of damaged first record = %v, want CorruptionError at %d", err, persist.HeaderSize)
+		}
+	})
+
+	t.Run("Compression", func(t *testing.T) {
+		for _, c := range []persist.Compression{persist.CompressionGzip, persist.CompressionFlate} {
+			compressed := newFilled()
+			compressed.SetEncodeOptions(persist.EncodeOptions{Compression: c})
+			data := marshal(t, compressed)
+			loaded := f.New()
+			if err := loaded.UnmarshalBinary(data); err != nil {
+				t.Fatalf("UnmarshalBinary() with %v failed: %v", c, err)
+			}
+			check(t, "UnmarshalBinary() with "+c.String(), loaded, want)
+			if !hasText {
+				continue
+			}
+
+			text := writeText(t, compressed)
+			fromText := f.New()
+			if _, err := asText(t, fromText).ReadTextFrom(text); err != nil {
+				t.Fatalf("ReadTextFrom() with %v failed: %v", c, err)
+			}
+			check(t, "ReadTextFrom() with "+c.String(), fromText, want)
+		}
+
+		if !hasText {
+			return
+		}
+
+		// gzip only checks its CRC-32 and length trailer at the end of the
+		// stream, past the last line a reader needs.
+		compressed := newFilled()
+		compressed.SetEncodeOptions(persist.EncodeOptions{Compression: persist.CompressionGzip})
+		data := writeText(t, compressed).Bytes()
+		flipped := bytes.Clone(data)
+		flipped[len(flipped)-8] ^= 0x01
+		for name, damaged := range map[string][]byte{
+			"flipped trailer byte": flipped,
+			"truncated trailer":    data[:len(data)-1],
+			"data after stream":    append(bytes.Clone(data), 0),
+		} {
+			if _, err := asText(t, f.New()).ReadTextFrom(bytes.NewReader(damaged)); err == nil {
+				t.Errorf("ReadTextFrom() of compressed text with %s returned nil error", name)
+			}
+		}
+	})
+
+	t.Run("Limits", func(t *testing.T) {
+		data := marshal(t, newFilled())
+		var text []byte
+		if hasText {
+			text = writeText(t, newFilled()).Bytes()
+		}
+
+		for name, opts := range map[string]persist.DecodeOptions{
+			"MaxElements":   {MaxElements: int64(len(filledValues)) - 1},
+			"MaxTotalBytes": {MaxTotalBytes: 4},
+		} {
+			loaded := f.New()
+			loaded.SetDecodeOptions(opts)
+			if err := loaded.UnmarshalBinary(data); !errors.Is(err, persist.ErrLimitExceeded) {
+				t.Errorf("UnmarshalBinary() with %s = %v, want ErrLimitExceeded", name, err)
+			}
+			if hasText {
+				if _, err := asText(t, loaded).ReadTextFrom(bytes.NewReader(text)); !errors.Is(err, persist.ErrLimitExceeded) {
+					t.Errorf("ReadTextFrom() with %s = %v, want ErrLimitExceeded", name, err)
+				}
+			}
+			if got := f.Contents(loaded); reflect.ValueOf(got).Len() != 0 {
+				t.Errorf("failed read with %s loaded %v", name, got)
+			}
+		}
+
+		loaded := f.New()
+		loaded.SetDecodeOptions(persist.DecodeOptions{MaxElements: int64(len(filledValues))})
+		if err := loaded.UnmarshalBinary(data); err != nil {
+			t.Errorf("UnmarshalBinary() at exactly MaxElements failed: %v", err)
+		}
+	})
+
+	t.Run("TextCount", func(t *testing.T) {
+		first, rest, _ := strings.Cut(writeText(t, newFilled()).String(), "\n")
+		count := strconv.Itoa(len(filledValues))
+		withCount := func(n string) string {
+			fields := strings.Fields(first)
+			for i, field := range fields {
+				if field == count {
+					fields[i] = n
+				}
+			}
+			return strings.Join(fields, " ") + "\n" + rest
+		}
+		for _, bad := range []string{"-" + count, "x"} {
+			loaded := f.New()
+			var corrupt *persist.CorruptionError
+			if _, err := asText(t, loaded).ReadTextFrom(strings.NewReader(withCount(bad))); !errors.As(err, &corrupt) {
+				t.Errorf("ReadTextFrom() with count %q = %v, want CorruptionError", bad, err)
+			}
+		}
+
+		// A count alone must not make the reader allocate room for it.
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		if _, err := asText(t, f.New()).ReadTextFrom(strings.NewReader(withCount("16777216"))); err == nil {
+			t.Error("ReadTextFrom() with a count past the end of the file returned nil error")
+		}
+		runtime.ReadMemStats(&after)
+		if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+			t.Errorf("ReadTextFrom() with a count of 16777216 allocated %d bytes", allocated)
+		}
+	})
+
+	t.Run("FailedReadKeepsContents", func(t *testing.T) {
+		data := marshal(t, newFilled())
+		loaded := f.Make(append(filledValues[:len(filledValues):len(filledValues)], "e"))
+		before := f.Contents(loaded)
+		if err := loaded.UnmarshalBinary(data[:len(data)-1]); err == nil {
+			t.Fatal("UnmarshalBinary() of truncated data returned nil error")
+		}
+		check(t, "failed UnmarshalBinary()", loaded, before)
+	})
+}
@@ -0,0 +1,122 @@
+package persist
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// QuoteLine prepares s to be written as one line of a text file. Strings
+// that could not be read back verbatim, because they contain control
+// characters such as newlines, are not valid UTF-8 or start with a double
+// quote, are written as Go string literals; everything else is written
+// as is, so files of plain values look the same as before quoting existed.
+func QuoteLine(s string) string {
+	if needsQuoting(s) {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// QuoteField is QuoteLine for values that share a line with others and are
+// separated by spaces: strings containing a space, or empty ones, are
+// quoted as well.
+func QuoteField(s string) string {
+	if s == "" || strings.Contains(s, " ") || needsQuoting(s) {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func needsQuoting(s string) bool {
+	if strings.HasPrefix(s, `"`) || !utf8.ValidString(s) {
+		return true
+	}
+	for _, r := range s {
+		if r < 0x20 || r == 0x7f {
+			return true
+		}
+	}
+	return false
+}
+
+// UnquoteLine reverses QuoteLine. Lines that do not start with a double quote
+// are returned unchanged, which keeps files written before quoting
+// readable.
+func UnquoteLine(line string) (string, error) {
+	if !strings.HasPrefix(line, `"`) {
+		return line, nil
+	}
+	return strconv.Unquote(line)
+}
+
+// LineReader reads a text file line by line with the same Scan/Text/Err
+// interface as bufio.Scanner, but without its limit on line length. Lines
+// end at "\n", and a "\r" before it is dropped.
+type LineReader struct {
+	r    *bufio.Reader
+	line string
+	err  error
+}
+
+func NewLineReader(r io.Reader) *LineReader {
+	return &LineReader{r: bufio.NewReader(r)}
+}
+
+// Scan advances to the next line. It returns false at the end of the input
+// or on a read error; a final line without a newline is still returned.
+func (l *LineReader) Scan() bool {
+	if l.err != nil {
+		return false
+	}
+	line, err := l.r.ReadString('\n')
+	if err != nil {
+		l.err = err
+		if err != io.EOF || line == "" {
+			return false
+		}
+	}
+	line = strings.TrimSuffix(line, "\n")
+	l.line = strings.TrimSuffix(line, "\r")
+	return true
+}
+
+func (l *LineReader) Text() string {
+	return l.line
+}
+
+// Err returns the first error other than io.EOF.
+func (l *LineReader) Err() error {
+	if errors.Is(l.err, io.EOF) {
+		return nil
+	}
+	return l.err
+}
+
+// FinishText reads the rest of a text file once its last value has been
+// parsed from lines, which must read from d. Only blank lines may follow.
+// Compressed text is read to the end of its gzip stream, the only point at
+// which gzip verifies its trailer, and nothing may follow that stream.
+func (d *Decoder) FinishText(lines *LineReader) error {
+	for lines.Scan() {
+		if strings.TrimSpace(lines.Text()) != "" {
+			return &CorruptionError{Offset: d.Offset(), Err: ErrTrailingData}
+		}
+	}
+	if err := lines.Err(); err != nil {
+		if errors.Is(err, ErrLimitExceeded) {
+			return err
+		}
+		return &CorruptionError{Offset: d.Offset(), Err: err}
+	}
+	if d.in == nil {
+		return nil
+	}
+	if n, _ := d.in.Read(d.buf[:1]); n > 0 {
+		return &CorruptionError{Offset: d.Offset(), Err: ErrTrailingData}
+	}
+	return nil
+}
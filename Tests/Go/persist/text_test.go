@@ -0,0 +1,129 @@
+package persist
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestQuoteLine(t *testing.T) {
+	tests := []struct {
+		in, line, field string
+	}{
+		{"plain", "plain", "plain"},
+		{"with space", "with space", `"with space"`},
+		{"", "", `""`},
+		{"two\nlines", `"two\nlines"`, `"two\nlines"`},
+		{"cr\r", `"cr\r"`, `"cr\r"`},
+		{`"quoted"`, `"\"quoted\""`, `"\"quoted\""`},
+		{`mid"quote`, `mid"quote`, `mid"quote`},
+		{"\xff\xfe", `"\xff\xfe"`, `"\xff\xfe"`},
+		{"юникод", "юникод", "юникод"},
+	}
+	for _, tt := range tests {
+		if got := QuoteLine(tt.in); got != tt.line {
+			t.Errorf("QuoteLine(%q) = %q, want %q", tt.in, got, tt.line)
+		}
+		if got := QuoteField(tt.in); got != tt.field {
+			t.Errorf("QuoteField(%q) = %q, want %q", tt.in, got, tt.field)
+		}
+		for _, quoted := range []string{tt.line, tt.field} {
+			if got, err := UnquoteLine(quoted); err != nil || got != tt.in {
+				t.Errorf("UnquoteLine(%q) = %q, %v, want %q", quoted, got, err, tt.in)
+			}
+		}
+	}
+
+	if _, err := UnquoteLine(`"unterminated`); err == nil {
+		t.Error("UnquoteLine() of a broken literal succeeded")
+	}
+}
+
+func TestLineReader(t *testing.T) {
+	long := strings.Repeat("x", 1<<20)
+	input := "first\r\n" + long + "\n\nlast"
+	want := []string{"first", long, "", "last"}
+
+	lines := NewLineReader(strings.NewReader(input))
+	var got []string
+	for lines.Scan() {
+		got = append(got, lines.Text())
+	}
+	if err := lines.Err(); err != nil {
+		t.Fatalf("Err() = %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("read %d lines, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("line %d = %.20q (%d bytes), want %.20q (%d bytes)", i, got[i], len(got[i]), want[i], len(want[i]))
+		}
+	}
+
+	t.Run("Limit", func(t *testing.T) {
+		dec := NewDecoder(strings.NewReader(input), DecodeOptions{MaxTotalBytes: 100})
+		lines := NewLineReader(dec)
+		for lines.Scan() {
+			if lines.Text() == long {
+				t.Error("Scan() returned a line past the byte limit")
+			}
+		}
+		if err := ScanFailure(lines, nil); err == nil {
+			t.Error("ScanFailure() = nil after hitting the byte limit")
+		}
+	})
+}
+
+func TestFinishText(t *testing.T) {
+	var compressed bytes.Buffer
+	enc := NewEncoder(&compressed)
+	if err := enc.CompressText(EncodeOptions{Compression: CompressionGzip}); err != nil {
+		t.Fatalf("CompressText() failed: %v", err)
+	}
+	enc.Write([]byte("1\nvalue\n\n"))
+	if err := enc.Finish(); err != nil {
+		t.Fatalf("Finish() failed: %v", err)
+	}
+	data := compressed.Bytes()
+	flipped := bytes.Clone(data)
+	flipped[len(flipped)-4] ^= 0x01
+
+	tests := []struct {
+		name  string
+		input []byte
+		err   error
+	}{
+		{"Plain", []byte("1\nvalue\n\r\n"), nil},
+		{"PlainTrailing", []byte("1\nvalue\nmore\n"), ErrTrailingData},
+		{"Gzip", data, nil},
+		{"GzipFlippedTrailer", flipped, gzip.ErrChecksum},
+		{"GzipTruncated", data[:len(data)-1], io.ErrUnexpectedEOF},
+		{"GzipTrailing", append(bytes.Clone(data), 0), ErrTrailingData},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dec := NewDecoder(bytes.NewReader(tt.input))
+			if err := dec.DetectCompression(); err != nil {
+				t.Fatalf("DetectCompression() failed: %v", err)
+			}
+			lines := NewLineReader(dec)
+			lines.Scan()
+			lines.Scan()
+			err := dec.FinishText(lines)
+			if tt.err == nil {
+				if err != nil {
+					t.Errorf("FinishText() = %v, want nil", err)
+				}
+				return
+			}
+			var corrupt *CorruptionError
+			if !errors.As(err, &corrupt) || !errors.Is(err, tt.err) {
+				t.Errorf("FinishText() = %v, want CorruptionError wrapping %v", err, tt.err)
+			}
+		})
+	}
+}
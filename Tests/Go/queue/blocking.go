@@ -0,0 +1,199 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrClosed is returned by BlockingQueue once it has been closed: by
+	// every Put, and by Take when no values are left.
+	ErrClosed = errors.New("queue closed")
+	// ErrFull is returned by TryPut when the queue holds its maximum size.
+	ErrFull = errors.New("queue overflow")
+	// ErrEmpty is returned by TryTake when the queue holds no values.
+	ErrEmpty = errors.New("queue underflow")
+)
+
+// BlockingQueue is a first-in, first-out queue that is safe for concurrent
+// use. Put waits while the queue is full and Take waits while it is empty,
+// so it can sit between producers and consumers of a worker pool. Only a
+// bounded queue with the OverflowError policy is ever full; the other
+// policies apply to Put and TryPut as they do to Enqueue of Queue.
+//
+// Closing the queue wakes every waiter. Values that were put before Close
+// can still be taken; after that Take fails with ErrClosed.
+type BlockingQueue struct {
+	mu       sync.Mutex
+	notEmpty sync.Cond
+	notFull  sync.Cond
+	q        Queue
+	closed   bool
+}
+
+// NewBlockingQueue creates an empty queue with the same defaults and options
+// as NewQueue.
+func NewBlockingQueue(opts ...Option) *BlockingQueue {
+	settings := newSettings(opts)
+	bq := &BlockingQueue{q: Queue{maxSize: settings.maxSize, overflow: settings.overflow}}
+	bq.notEmpty.L = &bq.mu
+	bq.notFull.L = &bq.mu
+	return bq
+}
+
+// full reports whether Put has to wait. The caller holds bq.mu.
+func (bq *BlockingQueue) full() bool {
+	return bq.q.overflow == OverflowError && bq.q.full()
+}
+
+// wait blocks on cond until it is signalled or ctx is done. The caller holds
+// bq.mu.
+func (bq *BlockingQueue) wait(ctx context.Context, cond *sync.Cond) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// sync.Cond knows nothing about contexts, so wake every waiter when ctx
+	// is done and let each of them check its own.
+	stop := context.AfterFunc(ctx, func() {
+		bq.mu.Lock()
+		defer bq.mu.Unlock()
+		cond.Broadcast()
+	})
+	cond.Wait()
+	stop()
+	if err := ctx.Err(); err != nil {
+		// The wakeup may have been a Signal meant for a waiter that can
+		// still use it; pass it on.
+		cond.Signal()
+		return err
+	}
+	return nil
+}
+
+// Put adds value to the back of the queue, waiting while the queue is full.
+// It fails with ErrClosed if the queue is or becomes closed, and with the
+// error of ctx if ctx is done first.
+func (bq *BlockingQueue) Put(ctx context.Context, value string) error {
+	bq.mu.Lock()
+	defer bq.mu.Unlock()
+	for !bq.closed && bq.full() {
+		if err := bq.wait(ctx, &bq.notFull); err != nil {
+			return err
+		}
+	}
+	return bq.put(value)
+}
+
+// TryPut adds value to the back of the queue if there is room. It fails
+// with ErrFull instead of waiting.
+func (bq *BlockingQueue) TryPut(value string) error {
+	bq.mu.Lock()
+	defer bq.mu.Unlock()
+	if !bq.closed && bq.full() {
+		return ErrFull
+	}
+	return bq.put(value)
+}
+
+func (bq *BlockingQueue) put(value string) error {
+	if bq.closed {
+		return ErrClosed
+	}
+	if err := bq.q.Enqueue(value); err != nil {
+		return err
+	}
+	bq.notEmpty.Signal()
+	return nil
+}
+
+// Take removes and returns the value at the front of the queue, waiting
+// while the queue is empty. It fails with ErrClosed if the queue is closed
+// and empty, and with the error of ctx if ctx is done first.
+func (bq *BlockingQueue) Take(ctx context.Context) (string, error) {
+	bq.mu.Lock()
+	defer bq.mu.Unlock()
+	for !bq.closed && bq.q.size == 0 {
+		if err := bq.wait(ctx, &bq.notEmpty); err != nil {
+			return "", err
+		}
+	}
+	return bq.take()
+}
+
+// TryTake removes and returns the value at the front of the queue if there
+// is one. It fails with ErrEmpty instead of waiting.
+func (bq *BlockingQueue) TryTake() (string, error) {
+	bq.mu.Lock()
+	defer bq.mu.Unlock()
+	if !bq.closed && bq.q.size == 0 {
+		return "", ErrEmpty
+	}
+	return bq.take()
+}
+
+func (bq *BlockingQueue) take() (string, error) {
+	if bq.q.size == 0 {
+		return "", ErrClosed
+	}
+	value, err := bq.q.Dequeue()
+	if err != nil {
+		return "", err
+	}
+	bq.notFull.Signal()
+	return value, nil
+}
+
+// Drain removes and returns every value in the queue, front first, without
+// waiting. It works on a closed queue too.
+func (bq *BlockingQueue) Drain() []string {
+	bq.mu.Lock()
+	defer bq.mu.Unlock()
+	values := make([]string, 0, bq.q.size)
+	for value := range bq.q.All() {
+		values = append(values, value)
+	}
+	bq.q.Clear()
+	bq.notFull.Broadcast()
+	return values
+}
+
+// Close stops the queue from accepting values and wakes every goroutine
+// waiting in Put or Take. Closing a closed queue does nothing.
+func (bq *BlockingQueue) Close() {
+	bq.mu.Lock()
+	defer bq.mu.Unlock()
+	if bq.closed {
+		return
+	}
+	bq.closed = true
+	bq.notEmpty.Broadcast()
+	bq.notFull.Broadcast()
+}
+
+// Closed reports whether Close has been called.
+func (bq *BlockingQueue) Closed() bool {
+	bq.mu.Lock()
+	defer bq.mu.Unlock()
+	return bq.closed
+}
+
+// Size returns the number of values in the queue.
+func (bq *BlockingQueue) Size() int {
+	bq.mu.Lock()
+	defer bq.mu.Unlock()
+	return bq.q.size
+}
+
+// Capacity returns the number of values the queue holds before its overflow
+// policy applies, or 0 if it is unbounded.
+func (bq *BlockingQueue) Capacity() int {
+	bq.mu.Lock()
+	defer bq.mu.Unlock()
+	return bq.q.maxSize
+}
+
+// Overflow returns the overflow policy of the queue.
+func (bq *BlockingQueue) Overflow() OverflowPolicy {
+	return bq.q.overflow
+}
@@ -0,0 +1,259 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitBlocked fails the test unless done stays open for a moment, which is
+// the best a test can do to see that a goroutine is waiting.
+func waitBlocked(t *testing.T, done <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-done:
+		t.Fatalf("%s did not wait", what)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestBlockingQueue(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("TryPutTryTake", func(t *testing.T) {
+		bq := NewBlockingQueue(WithCapacity(2))
+		if bq.Capacity() != 2 {
+			t.Errorf("Capacity() = %d, want 2", bq.Capacity())
+		}
+		if _, err := bq.TryTake(); !errors.Is(err, ErrEmpty) {
+			t.Errorf("TryTake() on an empty queue = %v, want ErrEmpty", err)
+		}
+		for _, value := range []string{"a", "b"} {
+			if err := bq.TryPut(value); err != nil {
+				t.Fatalf("TryPut(%q) failed: %v", value, err)
+			}
+		}
+		if err := bq.TryPut("c"); !errors.Is(err, ErrFull) {
+			t.Errorf("TryPut() on a full queue = %v, want ErrFull", err)
+		}
+		if value, err := bq.TryTake(); err != nil || value != "a" {
+			t.Errorf("TryTake() = %q, %v, want \"a\"", value, err)
+		}
+		if bq.Size() != 1 {
+			t.Errorf("Size() = %d, want 1", bq.Size())
+		}
+	})
+
+	t.Run("PutWaitsForTake", func(t *testing.T) {
+		bq := NewBlockingQueue(WithCapacity(1))
+		bq.Put(ctx, "first")
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			if err := bq.Put(ctx, "second"); err != nil {
+				t.Errorf("Put() failed: %v", err)
+			}
+		}()
+		waitBlocked(t, done, "Put() on a full queue")
+		if value, err := bq.Take(ctx); err != nil || value != "first" {
+			t.Errorf("Take() = %q, %v, want \"first\"", value, err)
+		}
+		<-done
+		if value, err := bq.Take(ctx); err != nil || value != "second" {
+			t.Errorf("Take() = %q, %v, want \"second\"", value, err)
+		}
+	})
+
+	t.Run("TakeWaitsForPut", func(t *testing.T) {
+		bq := NewBlockingQueue(WithCapacity(1))
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			if value, err := bq.Take(ctx); err != nil || value != "x" {
+				t.Errorf("Take() = %q, %v, want \"x\"", value, err)
+			}
+		}()
+		waitBlocked(t, done, "Take() on an empty queue")
+		bq.Put(ctx, "x")
+		<-done
+	})
+
+	t.Run("Context", func(t *testing.T) {
+		bq := NewBlockingQueue(WithCapacity(1))
+		short, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		if _, err := bq.Take(short); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Take() = %v, want context.DeadlineExceeded", err)
+		}
+
+		bq.Put(ctx, "full")
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		if err := bq.Put(canceled, "more"); !errors.Is(err, context.Canceled) {
+			t.Errorf("Put() = %v, want context.Canceled", err)
+		}
+		if values := bq.Drain(); !slices.Equal(values, []string{"full"}) {
+			t.Errorf("Drain() = %q, want [full]", values)
+		}
+	})
+
+	t.Run("CloseWakesWaiters", func(t *testing.T) {
+		empty := NewBlockingQueue(WithCapacity(1))
+		full := NewBlockingQueue(WithCapacity(1))
+		full.Put(ctx, "kept")
+
+		var wg sync.WaitGroup
+		for i := 0; i < 3; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				if _, err := empty.Take(ctx); !errors.Is(err, ErrClosed) {
+					t.Errorf("Take() = %v, want ErrClosed", err)
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				if err := full.Put(ctx, "lost"); !errors.Is(err, ErrClosed) {
+					t.Errorf("Put() = %v, want ErrClosed", err)
+				}
+			}()
+		}
+		time.Sleep(20 * time.Millisecond)
+		empty.Close()
+		full.Close()
+		full.Close()
+		wg.Wait()
+
+		if !full.Closed() {
+			t.Error("Closed() = false after Close()")
+		}
+		if err := full.TryPut("late"); !errors.Is(err, ErrClosed) {
+			t.Errorf("TryPut() after Close() = %v, want ErrClosed", err)
+		}
+		// Values put before Close can still be taken.
+		if value, err := full.Take(ctx); err != nil || value != "kept" {
+			t.Errorf("Take() = %q, %v, want \"kept\"", value, err)
+		}
+		if _, err := full.TryTake(); !errors.Is(err, ErrClosed) {
+			t.Errorf("TryTake() of a drained closed queue = %v, want ErrClosed", err)
+		}
+	})
+
+	t.Run("DrainWakesPutters", func(t *testing.T) {
+		bq := NewBlockingQueue(WithCapacity(2))
+		bq.Put(ctx, "a")
+		bq.Put(ctx, "b")
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			bq.Put(ctx, "c")
+		}()
+		waitBlocked(t, done, "Put() on a full queue")
+		if values := bq.Drain(); !slices.Equal(values, []string{"a", "b"}) {
+			t.Errorf("Drain() = %q, want [a b]", values)
+		}
+		<-done
+		if bq.Size() != 1 {
+			t.Errorf("Size() = %d, want 1", bq.Size())
+		}
+	})
+
+	t.Run("ProducersConsumers", func(t *testing.T) {
+		const producers, consumers, perProducer = 4, 4, 500
+		bq := NewBlockingQueue(WithCapacity(8))
+		var produced sync.WaitGroup
+		for p := 0; p < producers; p++ {
+			produced.Add(1)
+			go func() {
+				defer produced.Done()
+				for i := 0; i < perProducer; i++ {
+					if err := bq.Put(ctx, strconv.Itoa(p*perProducer+i)); err != nil {
+						t.Errorf("Put() failed: %v", err)
+						return
+					}
+				}
+			}()
+		}
+
+		// Some consumers give up early; the values they would have taken
+		// must reach the others.
+		var mu sync.Mutex
+		seen := make(map[string]int)
+		var consumed sync.WaitGroup
+		for c := 0; c < consumers; c++ {
+			consumed.Add(1)
+			go func() {
+				defer consumed.Done()
+				for {
+					takeCtx, cancel := ctx, context.CancelFunc(func() {})
+					if c == 0 {
+						takeCtx, cancel = context.WithTimeout(ctx, time.Millisecond)
+					}
+					value, err := bq.Take(takeCtx)
+					cancel()
+					if errors.Is(err, ErrClosed) || errors.Is(err, context.DeadlineExceeded) {
+						return
+					}
+					if err != nil {
+						t.Errorf("Take() failed: %v", err)
+						return
+					}
+					mu.Lock()
+					seen[value]++
+					mu.Unlock()
+				}
+			}()
+		}
+
+		produced.Wait()
+		bq.Close()
+		consumed.Wait()
+		if len(seen) != producers*perProducer {
+			t.Errorf("consumers saw %d distinct values, want %d", len(seen), producers*perProducer)
+		}
+		for value, count := range seen {
+			if count != 1 {
+				t.Errorf("value %s was taken %d times", value, count)
+			}
+		}
+	})
+
+	t.Run("Options", func(t *testing.T) {
+		if got := NewBlockingQueue().Capacity(); got != MAX_SIZE {
+			t.Errorf("Capacity() = %d, want MAX_SIZE", got)
+		}
+		tests := []struct {
+			policy   OverflowPolicy
+			want     []string
+			capacity int
+		}{
+			{OverflowDropOldest, []string{"2", "3", "4"}, 3},
+			{OverflowDropNewest, []string{"0", "1", "2"}, 3},
+			{OverflowGrow, []string{"0", "1", "2", "3", "4"}, 6},
+		}
+		for _, tt := range tests {
+			bq := NewBlockingQueue(WithCapacity(3), WithOverflow(tt.policy))
+			for i := 0; i < 5; i++ {
+				// A full queue with another policy than OverflowError
+				// must not make Put wait.
+				if err := bq.Put(ctx, strconv.Itoa(i)); err != nil {
+					t.Fatalf("%v: Put(%d) failed: %v", tt.policy, i, err)
+				}
+			}
+			if got := bq.Drain(); !slices.Equal(got, tt.want) || bq.Capacity() != tt.capacity {
+				t.Errorf("%v: queue held %v with Capacity() = %d, want %v and %d", tt.policy, got, bq.Capacity(), tt.want, tt.capacity)
+			}
+		}
+
+		unbounded := NewBlockingQueue(Unbounded())
+		for i := 0; i < 2*MAX_SIZE; i++ {
+			if err := unbounded.TryPut(strconv.Itoa(i)); err != nil {
+				t.Fatalf("TryPut(%d) into an unbounded queue failed: %v", i, err)
+			}
+		}
+	})
+}
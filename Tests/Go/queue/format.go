@@ -0,0 +1,181 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"math"
+	"strconv"
+	"strings"
+
+	"Go/persist"
+)
+
+// fifo is what the file formats need from a queue. Queue and RingQueue both
+// write through the functions below, so their files are byte for byte the
+// same and either can read the files of the other.
+type fifo interface {
+	Size() int
+	Capacity() int
+	All() iter.Seq[string]
+}
+
+// header describes the binary format written by writeTo.
+func header(opts persist.EncodeOptions) persist.Header {
+	return persist.Header{Type: persist.TypeQueue, Value: persist.EncodingString64, Flags: opts.Flags() | persist.FlagCapacity}
+}
+
+// writeTo writes f in its binary format: the header, the capacity and the
+// size followed by each value in dequeue order.
+func writeTo(w io.Writer, f fifo, opts persist.EncodeOptions) (int64, error) {
+	enc := persist.NewEncoder(w)
+	if err := enc.WriteHeader(header(opts)); err != nil {
+		return enc.Len(), err
+	}
+	if err := enc.Uint64(uint64(f.Capacity())); err != nil {
+		return enc.Len(), fmt.Errorf("failed to write capacity: %w", err)
+	}
+	return writeBinary(enc, f)
+}
+
+// writeBinary writes the size of f and its values, which is all the legacy
+// and C++ formats hold.
+func writeBinary(enc *persist.Encoder, f fifo) (int64, error) {
+	if err := enc.Uint64(uint64(f.Size())); err != nil {
+		return enc.Len(), fmt.Errorf("failed to write size: %w", err)
+	}
+
+	for value := range f.All() {
+		if err := persist.String64.Encode(enc, value); err != nil {
+			return enc.Len(), fmt.Errorf("failed to write key: %w", err)
+		}
+		if err := enc.EndRecord(); err != nil {
+			return enc.Len(), err
+		}
+	}
+
+	err := enc.Finish()
+	return enc.Len(), err
+}
+
+// readBinary reads what writeBinary wrote, preceded by the capacity if
+// hasCapacity is set. Files without one get a capacity that fits them
+// according to current.
+func readBinary(dec *persist.Decoder, hasCapacity bool, current settings) (int, []string, error) {
+	var recorded uint64
+	if hasCapacity {
+		var err error
+		if recorded, err = dec.Uint64(); err != nil {
+			return 0, nil, fmt.Errorf("failed to read capacity: %w", err)
+		}
+	}
+	size, err := dec.Uint64()
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read size: %w", err)
+	}
+	if err := dec.CheckElements(size); err != nil {
+		return 0, nil, err
+	}
+
+	var capacity int
+	if hasCapacity {
+		capacity, err = recordedCapacity(size, recorded)
+	} else {
+		capacity, err = fitCapacity(current.maxSize, current.overflow, int(min(size, math.MaxInt)))
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// The size is only checked against the limits, so let the slice grow
+	// with the values actually read.
+	values := make([]string, 0, min(size, 1024))
+	for i := uint64(0); i < size; i++ {
+		key, err := persist.String64.Decode(dec)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to read key: %w", err)
+		}
+		if err := dec.EndRecord(); err != nil {
+			return 0, nil, err
+		}
+		values = append(values, key)
+	}
+
+	if err := dec.Finish(); err != nil {
+		return 0, nil, err
+	}
+	return capacity, values, nil
+}
+
+// writeText writes f with one value per line. withCapacity adds the capacity
+// to the line with the size.
+func writeText(enc *persist.Encoder, f fifo, format persist.LineFormat, withCapacity bool) (int64, error) {
+	sizeLine := strconv.Itoa(f.Size())
+	if withCapacity {
+		sizeLine += " " + strconv.Itoa(f.Capacity())
+	}
+	if _, err := fmt.Fprintln(enc, sizeLine); err != nil {
+		return enc.Len(), fmt.Errorf("failed to write size: %w", err)
+	}
+
+	for value := range f.All() {
+		line, err := format.Quote(value)
+		if err != nil {
+			return enc.Len(), err
+		}
+		if _, err := fmt.Fprintln(enc, line); err != nil {
+			return enc.Len(), fmt.Errorf("failed to write element: %w", err)
+		}
+	}
+
+	err := enc.Finish()
+	return enc.Len(), err
+}
+
+// readText reads the format of writeText. withCapacity accepts a capacity on
+// the line with the size, which files written before it was recorded lack.
+func readText(dec *persist.Decoder, format persist.LineFormat, withCapacity bool, current settings) (int, []string, error) {
+	lines := persist.NewLineReader(dec)
+	if !lines.Scan() {
+		return 0, nil, persist.ScanFailure(lines, errors.New("file is empty"))
+	}
+
+	sizeStr, capacityStr, hasCapacity := strings.Cut(lines.Text(), " ")
+	hasCapacity = hasCapacity && withCapacity
+	size, err := dec.ParseCount(sizeStr)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var capacity int
+	if hasCapacity {
+		var recorded uint64
+		if recorded, err = strconv.ParseUint(capacityStr, 10, 64); err != nil {
+			return 0, nil, fmt.Errorf("invalid capacity format: %w", err)
+		}
+		capacity, err = recordedCapacity(uint64(size), recorded)
+	} else {
+		capacity, err = fitCapacity(current.maxSize, current.overflow, size)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	values := make([]string, 0, min(max(size, 0), 1024))
+	for i := 0; i < size; i++ {
+		if !lines.Scan() {
+			return 0, nil, persist.ScanFailure(lines, errors.New("unexpected end of file"))
+		}
+		value, err := format.Unquote(lines.Text())
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid value on line %d: %w", i+2, err)
+		}
+		values = append(values, value)
+	}
+
+	if err := dec.FinishText(lines); err != nil {
+		return 0, nil, fmt.Errorf("error reading file: %w", err)
+	}
+	return capacity, values, nil
+}
@@ -0,0 +1,138 @@
+package queue
+
+import "sync/atomic"
+
+// lockFreeNode is a node of a LockFreeQueue. The node head points at is a
+// dummy whose value has already been dequeued.
+type lockFreeNode struct {
+	value string
+	next  atomic.Pointer[lockFreeNode]
+}
+
+// LockFreeQueue is a first-in, first-out queue of strings that is safe for
+// concurrent use without locks, after the algorithm of Michael and Scott
+// ("Simple, Fast, and Practical Non-Blocking and Blocking Concurrent Queue
+// Algorithms", 1996). Enqueue, Dequeue and Size behave as those of Queue,
+// and the queue takes the same options for its capacity and overflow policy.
+//
+// Producers only touch the tail and consumers only the head, so the two
+// sides contend with each other only while the queue is nearly empty. The
+// garbage collector keeps a node alive while any goroutine still holds it,
+// which rules out the ABA problem the original algorithm needs tagged
+// pointers for.
+type LockFreeQueue struct {
+	head atomic.Pointer[lockFreeNode]
+	_    [56]byte
+	tail atomic.Pointer[lockFreeNode]
+	_    [56]byte
+	size atomic.Int64
+
+	maxSize  atomic.Int64 // 0 for an unbounded queue
+	overflow OverflowPolicy
+}
+
+// NewLockFreeQueue creates an empty queue with the same defaults and options
+// as NewQueue.
+func NewLockFreeQueue(opts ...Option) *LockFreeQueue {
+	settings := newSettings(opts)
+	q := &LockFreeQueue{overflow: settings.overflow}
+	q.maxSize.Store(int64(settings.maxSize))
+	dummy := &lockFreeNode{}
+	q.head.Store(dummy)
+	q.tail.Store(dummy)
+	return q
+}
+
+// Enqueue adds value to the back of the queue. If the queue holds its
+// capacity, the overflow policy decides what happens, as for Queue.
+func (q *LockFreeQueue) Enqueue(value string) error {
+	// Reserve room first so that concurrent Enqueues cannot overshoot the
+	// maximum size between checking it and linking their nodes.
+	for {
+		size := q.size.Load()
+		maxSize := q.maxSize.Load()
+		if maxSize != 0 && size >= maxSize {
+			switch q.overflow {
+			case OverflowDropOldest:
+				// Another goroutine may take the freed room first;
+				// then drop another value.
+				q.Dequeue()
+				continue
+			case OverflowDropNewest:
+				return nil
+			case OverflowGrow:
+				q.maxSize.CompareAndSwap(maxSize, int64(grownCapacity(int(maxSize), int(size)+1)))
+				continue
+			default:
+				return ErrFull
+			}
+		}
+		if q.size.CompareAndSwap(size, size+1) {
+			break
+		}
+	}
+
+	node := &lockFreeNode{value: value}
+	for {
+		tail := q.tail.Load()
+		next := tail.next.Load()
+		if tail != q.tail.Load() {
+			continue
+		}
+		if next != nil {
+			// Another Enqueue linked its node but has not moved the tail
+			// yet; help it along.
+			q.tail.CompareAndSwap(tail, next)
+			continue
+		}
+		if tail.next.CompareAndSwap(nil, node) {
+			q.tail.CompareAndSwap(tail, node)
+			return nil
+		}
+	}
+}
+
+// Dequeue removes and returns the value at the front of the queue. It fails
+// with ErrEmpty if the queue is empty.
+func (q *LockFreeQueue) Dequeue() (string, error) {
+	for {
+		head := q.head.Load()
+		tail := q.tail.Load()
+		next := head.next.Load()
+		if head != q.head.Load() {
+			continue
+		}
+		if next == nil {
+			return "", ErrEmpty
+		}
+		if head == tail {
+			// The tail lags behind a linked node; move it before the
+			// head passes it.
+			q.tail.CompareAndSwap(tail, next)
+			continue
+		}
+		value := next.value
+		if q.head.CompareAndSwap(head, next) {
+			q.size.Add(-1)
+			return value, nil
+		}
+	}
+}
+
+// Size returns the number of values in the queue. While other goroutines
+// use the queue it counts an Enqueue from the moment it starts and a Dequeue
+// from the moment it completes, so it may be ahead of what Dequeue can see.
+func (q *LockFreeQueue) Size() int {
+	return int(q.size.Load())
+}
+
+// Capacity returns the number of values the queue holds before its overflow
+// policy applies, or 0 if it is unbounded.
+func (q *LockFreeQueue) Capacity() int {
+	return int(q.maxSize.Load())
+}
+
+// Overflow returns the overflow policy of the queue.
+func (q *LockFreeQueue) Overflow() OverflowPolicy {
+	return q.overflow
+}
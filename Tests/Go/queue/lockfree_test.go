@@ -0,0 +1,266 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestLockFreeQueue(t *testing.T) {
+	t.Run("Contract", func(t *testing.T) {
+		q := NewLockFreeQueue()
+		if _, err := q.Dequeue(); !errors.Is(err, ErrEmpty) {
+			t.Errorf("Dequeue() on an empty queue = %v, want ErrEmpty", err)
+		}
+		for i := 0; i < MAX_SIZE; i++ {
+			if err := q.Enqueue(fmt.Sprint(i)); err != nil {
+				t.Fatalf("Enqueue(%d) failed: %v", i, err)
+			}
+		}
+		if err := q.Enqueue("over"); err == nil || err.Error() != "queue overflow" {
+			t.Errorf("Enqueue() on a full queue = %v, want queue overflow", err)
+		}
+		if q.Size() != MAX_SIZE {
+			t.Errorf("Size() = %d, want %d", q.Size(), MAX_SIZE)
+		}
+		for i := 0; i < MAX_SIZE; i++ {
+			if value, err := q.Dequeue(); err != nil || value != fmt.Sprint(i) {
+				t.Fatalf("Dequeue() = %q, %v, want %d", value, err, i)
+			}
+		}
+		if _, err := q.Dequeue(); err == nil || err.Error() != "queue underflow" {
+			t.Errorf("Dequeue() on an emptied queue = %v, want queue underflow", err)
+		}
+		if q.Size() != 0 {
+			t.Errorf("Size() = %d, want 0", q.Size())
+		}
+	})
+
+	t.Run("Options", func(t *testing.T) {
+		tests := []struct {
+			policy   OverflowPolicy
+			want     []string
+			capacity int
+		}{
+			{OverflowDropOldest, []string{"2", "3", "4"}, 3},
+			{OverflowDropNewest, []string{"0", "1", "2"}, 3},
+			{OverflowGrow, []string{"0", "1", "2", "3", "4"}, 6},
+		}
+		for _, tt := range tests {
+			q := NewLockFreeQueue(WithCapacity(3), WithOverflow(tt.policy))
+			for i := 0; i < 5; i++ {
+				if err := q.Enqueue(fmt.Sprint(i)); err != nil {
+					t.Fatalf("%v: Enqueue(%d) failed: %v", tt.policy, i, err)
+				}
+			}
+			if q.Capacity() != tt.capacity {
+				t.Errorf("%v: Capacity() = %d, want %d", tt.policy, q.Capacity(), tt.capacity)
+			}
+			var got []string
+			for value, err := q.Dequeue(); err == nil; value, err = q.Dequeue() {
+				got = append(got, value)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("%v: queue held %v, want %v", tt.policy, got, tt.want)
+			}
+		}
+
+		unbounded := NewLockFreeQueue(Unbounded())
+		for i := 0; i < 2*MAX_SIZE; i++ {
+			if err := unbounded.Enqueue(fmt.Sprint(i)); err != nil {
+				t.Fatalf("Enqueue(%d) into an unbounded queue failed: %v", i, err)
+			}
+		}
+		if unbounded.Capacity() != 0 || unbounded.Size() != 2*MAX_SIZE {
+			t.Errorf("unbounded queue: Capacity() = %d, Size() = %d", unbounded.Capacity(), unbounded.Size())
+		}
+	})
+
+	t.Run("Stress", func(t *testing.T) {
+		const producers, consumers, perProducer = 8, 8, 2000
+		q := NewLockFreeQueue()
+
+		var produced sync.WaitGroup
+		for p := 0; p < producers; p++ {
+			produced.Add(1)
+			go func() {
+				defer produced.Done()
+				for i := 0; i < perProducer; {
+					if q.Enqueue(fmt.Sprintf("%d/%d", p, i)) == nil {
+						i++
+					} else {
+						runtime.Gosched()
+					}
+				}
+			}()
+		}
+
+		// Each consumer must see the values of one producer in the order
+		// they were enqueued, and all consumers together every value once.
+		var done atomic.Bool
+		taken := make([][]int, consumers)
+		var consumed sync.WaitGroup
+		for c := 0; c < consumers; c++ {
+			consumed.Add(1)
+			go func() {
+				defer consumed.Done()
+				last := make([]int, producers)
+				for i := range last {
+					last[i] = -1
+				}
+				for {
+					value, err := q.Dequeue()
+					if err != nil {
+						if done.Load() && q.Size() == 0 {
+							return
+						}
+						runtime.Gosched()
+						continue
+					}
+					var p, i int
+					if _, err := fmt.Sscanf(value, "%d/%d", &p, &i); err != nil {
+						t.Errorf("Dequeue() returned %q", value)
+						return
+					}
+					if i <= last[p] {
+						t.Errorf("consumer %d saw %d/%d after %d/%d", c, p, i, p, last[p])
+					}
+					last[p] = i
+					taken[c] = append(taken[c], p*perProducer+i)
+				}
+			}()
+		}
+
+		produced.Wait()
+		done.Store(true)
+		consumed.Wait()
+
+		seen := make([]bool, producers*perProducer)
+		for _, values := range taken {
+			for _, value := range values {
+				if seen[value] {
+					t.Fatalf("value %d was dequeued twice", value)
+				}
+				seen[value] = true
+			}
+		}
+		for value, ok := range seen {
+			if !ok {
+				t.Fatalf("value %d was never dequeued", value)
+			}
+		}
+	})
+
+	t.Run("NeverOverflows", func(t *testing.T) {
+		q := NewLockFreeQueue()
+		var wg sync.WaitGroup
+		var accepted atomic.Int64
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < MAX_SIZE/2; i++ {
+					if q.Enqueue("x") == nil {
+						accepted.Add(1)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		if accepted.Load() != MAX_SIZE || q.Size() != MAX_SIZE {
+			t.Errorf("accepted %d values, Size() = %d, want %d", accepted.Load(), q.Size(), MAX_SIZE)
+		}
+	})
+}
+
+// mutexQueue is a Queue behind a mutex, which is what LockFreeQueue
+// replaces.
+type mutexQueue struct {
+	mu sync.Mutex
+	q  *Queue
+}
+
+func (m *mutexQueue) Enqueue(value string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.q.Enqueue(value)
+}
+
+func (m *mutexQueue) Dequeue() (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.q.Dequeue()
+}
+
+type concurrentQueue interface {
+	Enqueue(value string) error
+	Dequeue() (string, error)
+}
+
+var concurrentQueues = []struct {
+	name string
+	new  func() concurrentQueue
+}{
+	{"Mutex", func() concurrentQueue { return &mutexQueue{q: NewQueue()} }},
+	{"LockFree", func() concurrentQueue { return NewLockFreeQueue() }},
+}
+
+// BenchmarkConcurrentQueue runs goroutines that each enqueue a value and
+// dequeue one, so the queue stays short and both ends are contended.
+func BenchmarkConcurrentQueue(b *testing.B) {
+	for _, parallelism := range []int{1, 4, 16} {
+		for _, cq := range concurrentQueues {
+			b.Run(fmt.Sprintf("%s/x%d", cq.name, parallelism), func(b *testing.B) {
+				q := cq.new()
+				b.SetParallelism(parallelism)
+				b.ReportAllocs()
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						q.Enqueue("value")
+						q.Dequeue()
+					}
+				})
+			})
+		}
+	}
+}
+
+// BenchmarkConcurrentQueueFanIn has many producers feed a single consumer.
+func BenchmarkConcurrentQueueFanIn(b *testing.B) {
+	for _, cq := range concurrentQueues {
+		b.Run(cq.name, func(b *testing.B) {
+			q := cq.new()
+			stop := make(chan struct{})
+			var consumer sync.WaitGroup
+			consumer.Add(1)
+			go func() {
+				defer consumer.Done()
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+					if _, err := q.Dequeue(); err != nil {
+						runtime.Gosched()
+					}
+				}
+			}()
+
+			b.SetParallelism(8)
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					for q.Enqueue("value") != nil {
+						runtime.Gosched()
+					}
+				}
+			})
+			close(stop)
+			consumer.Wait()
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package queue
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// OverflowPolicy decides what Enqueue does when the queue holds its
+// capacity.
+type OverflowPolicy int
+
+const (
+	// OverflowError makes Enqueue fail with ErrFull and leaves the queue
+	// unchanged.
+	OverflowError OverflowPolicy = iota
+	// OverflowDropOldest dequeues the value at the front to make room.
+	OverflowDropOldest
+	// OverflowDropNewest discards the enqueued value and reports success.
+	OverflowDropNewest
+	// OverflowGrow doubles the capacity.
+	OverflowGrow
+)
+
+var overflowNames = map[OverflowPolicy]string{
+	OverflowError:      "error",
+	OverflowDropOldest: "drop-oldest",
+	OverflowDropNewest: "drop-newest",
+	OverflowGrow:       "grow",
+}
+
+func (p OverflowPolicy) String() string {
+	if name, ok := overflowNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("OverflowPolicy(%d)", int(p))
+}
+
+// Option configures a queue created by NewQueue, NewRingQueue,
+// NewLockFreeQueue or NewBlockingQueue.
+type Option func(*settings)
+
+// settings holds what the options of a queue configure.
+type settings struct {
+	maxSize  int // 0 for an unbounded queue
+	overflow OverflowPolicy
+}
+
+// newSettings applies opts to the defaults: MAX_SIZE values and
+// OverflowError.
+func newSettings(opts []Option) settings {
+	s := settings{maxSize: MAX_SIZE}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	return s
+}
+
+// WithCapacity limits the queue to capacity values instead of MAX_SIZE. It
+// panics if capacity is less than 1.
+func WithCapacity(capacity int) Option {
+	if capacity < 1 {
+		panic(fmt.Sprintf("queue: invalid capacity %d", capacity))
+	}
+	return func(s *settings) {
+		s.maxSize = capacity
+	}
+}
+
+// Unbounded removes the limit on the number of values.
+func Unbounded() Option {
+	return func(s *settings) {
+		s.maxSize = 0
+	}
+}
+
+// WithOverflow selects what Enqueue does when the queue is full. The default
+// is OverflowError.
+func WithOverflow(policy OverflowPolicy) Option {
+	if _, ok := overflowNames[policy]; !ok {
+		panic(fmt.Sprintf("queue: invalid overflow policy %d", int(policy)))
+	}
+	return func(s *settings) {
+		s.overflow = policy
+	}
+}
+
+// Capacity returns the number of values the queue holds before its overflow
+// policy applies, or 0 if it is unbounded.
+func (q *Queue) Capacity() int {
+	return q.maxSize
+}
+
+// Overflow returns the overflow policy of the queue.
+func (q *Queue) Overflow() OverflowPolicy {
+	return q.overflow
+}
+
+// full reports whether one more value would go over the capacity.
+func (q *Queue) full() bool {
+	return q.maxSize != 0 && q.size >= q.maxSize
+}
+
+// fitCapacity returns the capacity of a queue of size values loaded from
+// input that does not record one: the given capacity, doubled as often as
+// needed if the overflow policy is OverflowGrow.
+func fitCapacity(capacity int, overflow OverflowPolicy, size int) (int, error) {
+	if capacity != 0 && size > capacity {
+		if overflow != OverflowGrow {
+			return 0, fmt.Errorf("queue size %d exceeds maximum size %d", size, capacity)
+		}
+		capacity = grownCapacity(capacity, size)
+	}
+	return capacity, nil
+}
+
+// grownCapacity returns capacity doubled as few times as it takes to hold
+// size, which is larger, or math.MaxInt if that would overflow an int.
+func grownCapacity(capacity, size int) int {
+	shift := bits.Len(uint((size - 1) / capacity))
+	if capacity > math.MaxInt>>shift {
+		return math.MaxInt
+	}
+	return capacity << shift
+}
+
+// recordedCapacity checks the capacity recorded in a file that holds size
+// values and returns it.
+func recordedCapacity(size uint64, recorded uint64) (int, error) {
+	if int64(recorded) < 0 {
+		return 0, fmt.Errorf("invalid queue capacity in file: %d", int64(recorded))
+	}
+	if recorded == 0 {
+		return 0, nil
+	}
+	if size > recorded {
+		return 0, fmt.Errorf("queue size %d in file exceeds its capacity %d", size, recorded)
+	}
+	return int(recorded), nil
+}
+
+// emptyCopy returns an empty queue with the given capacity and the overflow
+// policy of q.
+func (q *Queue) emptyCopy(capacity int) *Queue {
+	return &Queue{maxSize: capacity, overflow: q.overflow}
+}
@@ -0,0 +1,166 @@
+package queue
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// enqueueAll enqueues "0" to strconv.Itoa(n-1) and fails the test on any
+// error.
+func enqueueAll(t *testing.T, q *Queue, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := q.Enqueue(strconv.Itoa(i)); err != nil {
+			t.Fatalf("Enqueue(%d) failed: %v", i, err)
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+	t.Run("Capacity", func(t *testing.T) {
+		if got := NewQueue().Capacity(); got != MAX_SIZE {
+			t.Errorf("Capacity() = %d, want MAX_SIZE", got)
+		}
+		q := NewQueue(WithCapacity(5))
+		enqueueAll(t, q, 5)
+		if err := q.Enqueue("over"); !errors.Is(err, ErrFull) {
+			t.Errorf("Enqueue() on a full queue = %v, want ErrFull", err)
+		}
+
+		unbounded := NewQueue(Unbounded())
+		enqueueAll(t, unbounded, 2*MAX_SIZE)
+		if unbounded.Capacity() != 0 || unbounded.Size() != 2*MAX_SIZE {
+			t.Errorf("unbounded queue: Capacity() = %d, Size() = %d", unbounded.Capacity(), unbounded.Size())
+		}
+	})
+
+	t.Run("Overflow", func(t *testing.T) {
+		tests := []struct {
+			policy   OverflowPolicy
+			want     []string
+			capacity int
+		}{
+			{OverflowDropOldest, []string{"2", "3", "4"}, 3},
+			{OverflowDropNewest, []string{"0", "1", "2"}, 3},
+			{OverflowGrow, []string{"0", "1", "2", "3", "4"}, 6},
+		}
+		for _, tt := range tests {
+			t.Run(tt.policy.String(), func(t *testing.T) {
+				q := NewQueue(WithCapacity(3), WithOverflow(tt.policy))
+				enqueueAll(t, q, 5)
+				if got := slices.Collect(q.All()); !slices.Equal(got, tt.want) {
+					t.Errorf("queue holds %v, want %v", got, tt.want)
+				}
+				backward := slices.Clone(tt.want)
+				slices.Reverse(backward)
+				if got := slices.Collect(q.Backward()); !slices.Equal(got, backward) {
+					t.Errorf("Backward() yields %v, want %v", got, backward)
+				}
+				if q.Size() != len(tt.want) || q.Capacity() != tt.capacity {
+					t.Errorf("Size() = %d, Capacity() = %d, want %d, %d", q.Size(), q.Capacity(), len(tt.want), tt.capacity)
+				}
+			})
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for name, option := range map[string]func(){
+			"WithCapacity": func() { WithCapacity(-1) },
+			"WithOverflow": func() { WithOverflow(OverflowGrow + 1) },
+		} {
+			func() {
+				defer func() {
+					if recover() == nil {
+						t.Errorf("invalid %s did not panic", name)
+					}
+				}()
+				option()
+			}()
+		}
+	})
+}
+
+func TestCapacityFiles(t *testing.T) {
+	big := NewQueue(WithCapacity(5000))
+	enqueueAll(t, big, 1500)
+	want := slices.Collect(big.All())
+
+	t.Run("Binary", func(t *testing.T) {
+		data, err := big.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary() failed: %v", err)
+		}
+		loaded := NewQueue()
+		if err := loaded.UnmarshalBinary(data); err != nil {
+			t.Fatalf("UnmarshalBinary() failed: %v", err)
+		}
+		if got := slices.Collect(loaded.All()); !slices.Equal(got, want) || loaded.Capacity() != 5000 {
+			t.Errorf("loaded %d values with Capacity() = %d, want %d and 5000", len(got), loaded.Capacity(), len(want))
+		}
+	})
+
+	t.Run("Text", func(t *testing.T) {
+		var buf bytes.Buffer
+		if _, err := NewQueueWithItems("a", "b").WriteTextTo(&buf); err != nil {
+			t.Fatalf("WriteTextTo() failed: %v", err)
+		}
+		if got, want := buf.String(), "2 1000\na\nb\n"; got != want {
+			t.Errorf("WriteTextTo() wrote %q, want %q", got, want)
+		}
+
+		loaded := NewQueue(WithCapacity(1))
+		if _, err := loaded.ReadTextFrom(&buf); err != nil {
+			t.Fatalf("ReadTextFrom() failed: %v", err)
+		}
+		if loaded.Capacity() != MAX_SIZE || loaded.Size() != 2 {
+			t.Errorf("Capacity() = %d, Size() = %d, want %d, 2", loaded.Capacity(), loaded.Size(), MAX_SIZE)
+		}
+
+		if _, err := loaded.ReadTextFrom(strings.NewReader("3 2\na\nb\nc\n")); err == nil {
+			t.Error("ReadTextFrom() of more values than the recorded capacity succeeded")
+		}
+	})
+
+	t.Run("WithoutCapacity", func(t *testing.T) {
+		var buf bytes.Buffer
+		if _, err := big.WriteCppTo(&buf); err != nil {
+			t.Fatalf("WriteCppTo() failed: %v", err)
+		}
+		if _, err := NewQueue().ReadLegacyFrom(bytes.NewReader(buf.Bytes())); err == nil {
+			t.Error("ReadLegacyFrom() of 1500 values into a default queue succeeded")
+		}
+		q := NewQueue(WithOverflow(OverflowGrow))
+		if _, err := q.ReadLegacyFrom(bytes.NewReader(buf.Bytes())); err != nil {
+			t.Fatalf("ReadLegacyFrom() into a growing queue failed: %v", err)
+		}
+		if q.Size() != 1500 || q.Capacity() != 2*MAX_SIZE {
+			t.Errorf("Size() = %d, Capacity() = %d, want 1500, %d", q.Size(), q.Capacity(), 2*MAX_SIZE)
+		}
+		if err := q.UnmarshalJSON([]byte(`["a", "b"]`)); err != nil || q.Capacity() != 2*MAX_SIZE {
+			t.Errorf("UnmarshalJSON() changed Capacity() to %d, %v", q.Capacity(), err)
+		}
+	})
+}
+
+func TestGrownCapacity(t *testing.T) {
+	tests := []struct {
+		capacity, size, want int
+	}{
+		{10, 11, 20},
+		{10, 20, 20},
+		{10, 21, 40},
+		{1, 1 << 40, 1 << 40},
+		{3, 3<<61 + 1, math.MaxInt},
+		{1, math.MaxInt, math.MaxInt},
+	}
+	for _, tt := range tests {
+		if got := grownCapacity(tt.capacity, tt.size); got != tt.want {
+			t.Errorf("grownCapacity(%d, %d) = %d, want %d", tt.capacity, tt.size, got, tt.want)
+		}
+	}
+}
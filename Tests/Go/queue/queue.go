@@ -2,11 +2,13 @@ package queue
 
 import (
 	"bufio"
-	"encoding/binary"
-	"errors"
+	"encoding/json"
 	"fmt"
+	"io"
+	"iter"
 	"os"
-	"strconv"
+
+	"Go/persist"
 )
 
 const MAX_SIZE = 1000
@@ -18,18 +20,27 @@ type Node struct {
 }
 
 type Queue struct {
-	head   *Node
-	tail   *Node
-	size   int
-	maxSize int
+	head       *Node
+	tail       *Node
+	size       int
+	maxSize    int // 0 for an unbounded queue
+	version    int
+	encodeOpts persist.EncodeOptions
+	decodeOpts persist.DecodeOptions
+
+	overflow OverflowPolicy
 }
 
-func NewQueue() *Queue {
+// NewQueue creates an empty queue that holds up to MAX_SIZE values and
+// rejects any more, unless opts say otherwise.
+func NewQueue(opts ...Option) *Queue {
+	settings := newSettings(opts)
 	return &Queue{
-		head:    nil,
-		tail:    nil,
-		size:    0,
-		maxSize: MAX_SIZE,
+		head:     nil,
+		tail:     nil,
+		size:     0,
+		maxSize:  settings.maxSize,
+		overflow: settings.overflow,
 	}
 }
 
@@ -41,9 +52,20 @@ func NewQueueWithItems(items ...string) *Queue {
 	return q
 }
 
+// Enqueue adds value to the back of the queue. When the queue is full, the
+// overflow policy decides what happens.
 func (q *Queue) Enqueue(value string) error {
-	if q.size >= q.maxSize {
-		return errors.New("queue overflow")
+	if q.full() {
+		switch q.overflow {
+		case OverflowDropOldest:
+			q.Dequeue()
+		case OverflowDropNewest:
+			return nil
+		case OverflowGrow:
+			q.maxSize *= 2
+		default:
+			return ErrFull
+		}
 	}
 
 	newNode := &Node{
@@ -60,12 +82,13 @@ func (q *Queue) Enqueue(value string) error {
 		q.tail = newNode
 	}
 	q.size++
+	q.version++
 	return nil
 }
 
 func (q *Queue) Dequeue() (string, error) {
 	if q.size == 0 {
-		return "", errors.New("queue underflow")
+		return "", ErrEmpty
 	}
 
 	data := q.head.Data
@@ -78,6 +101,7 @@ func (q *Queue) Dequeue() (string, error) {
 		q.head = newHead
 	}
 	q.size--
+	q.version++
 	return data, nil
 }
 
@@ -104,12 +128,17 @@ func (q *Queue) Del(key string) {
 	}
 
 	q.size--
+	q.version++
 }
 
 func (q *Queue) Size() int {
 	return q.size
 }
 
+// Head returns the first node of the queue.
+//
+// Deprecated: the node can be used to corrupt the queue; iterate with All
+// instead.
 func (q *Queue) Head() *Node {
 	return q.head
 }
@@ -118,133 +147,229 @@ func (q *Queue) Clear() {
 	q.head = nil
 	q.tail = nil
 	q.size = 0
+	q.version++
 }
 
-func (q *Queue) WriteBinary(filename string) error {
-	file, err := os.Create(filename)
-	if err != nil {
-		return fmt.Errorf("failed to open file for writing: %w", err)
-	}
-	defer file.Close()
-
-	if err := binary.Write(file, binary.LittleEndian, uint64(q.size)); err != nil {
-		return fmt.Errorf("failed to write size: %w", err)
-	}
-
-	current := q.head
-	for current != nil {
-		key := current.Data
-		keyLength := uint64(len(key))
-		if err := binary.Write(file, binary.LittleEndian, keyLength); err != nil {
-			return fmt.Errorf("failed to write key length: %w", err)
-		}
-		if _, err := file.Write([]byte(key)); err != nil {
-			return fmt.Errorf("failed to write key: %w", err)
-		}
-		current = current.Next
-	}
+// WriteTo writes the queue in its binary format: the capacity and the size
+// followed by each value in dequeue order.
+func (q *Queue) WriteTo(w io.Writer) (int64, error) {
+	return writeTo(w, q, q.encodeOpts)
+}
 
-	return nil
+// WriteCppTo writes the queue in the layout of the C++
+// Queue::writeBinary, which is the headerless layout read by
+// ReadLegacyFrom.
+func (q *Queue) WriteCppTo(w io.Writer) (int64, error) {
+	return writeBinary(persist.NewEncoder(w), q)
 }
 
-func (q *Queue) ReadBinary(filename string) error {
-	file, err := os.Open(filename)
+// ReadFrom replaces the contents of the queue with the binary data in r and
+// takes over the capacity recorded with them. Files written before the
+// capacity was recorded keep the capacity of the queue. The queue is left
+// unchanged if the data cannot be decoded.
+func (q *Queue) ReadFrom(r io.Reader) (int64, error) {
+	dec := persist.NewDecoder(r, q.decodeOpts)
+	h, err := dec.ExpectHeader(header(q.encodeOpts))
 	if err != nil {
-		return fmt.Errorf("failed to open file: %w", err)
+		return dec.Offset(), err
 	}
-	defer file.Close()
+	err = q.load(readBinary(dec, h.Flags&persist.FlagCapacity != 0, q.settings()))
+	return dec.Offset(), err
+}
 
-	q.Clear()
+// ReadLegacyFrom is like ReadFrom but reads the headerless format written
+// before the container header was introduced.
+func (q *Queue) ReadLegacyFrom(r io.Reader) (int64, error) {
+	dec := persist.NewDecoder(r, q.decodeOpts)
+	err := q.load(readBinary(dec, false, q.settings()))
+	return dec.Offset(), err
+}
 
-	var size uint64
-	if err := binary.Read(file, binary.LittleEndian, &size); err != nil {
-		return fmt.Errorf("failed to read size: %w", err)
-	}
+// ReadCppFrom replaces the contents of the queue with a file written by the
+// C++ Queue::writeBinary.
+func (q *Queue) ReadCppFrom(r io.Reader) (int64, error) {
+	return q.ReadLegacyFrom(r)
+}
 
-	if size > uint64(q.maxSize) {
-		return fmt.Errorf("queue size in file exceeds maximum size %d", q.maxSize)
-	}
+// SetEncodeOptions changes the optional parts of the binary format written by
+// WriteTo and WriteBinary. Its Compression also applies to WriteTextTo and
+// WriteText; readers detect compressed files on their own.
+func (q *Queue) SetEncodeOptions(opts persist.EncodeOptions) {
+	q.encodeOpts = opts
+}
 
-	for i := uint64(0); i < size; i++ {
-		var keyLength uint64
-		if err := binary.Read(file, binary.LittleEndian, &keyLength); err != nil {
-			return fmt.Errorf("failed to read key length: %w", err)
-		}
+// SetDecodeOptions changes the resource limits enforced by every Read*
+// method. Input that goes over a limit fails with persist.ErrLimitExceeded.
+func (q *Queue) SetDecodeOptions(opts persist.DecodeOptions) {
+	q.decodeOpts = opts
+}
 
-		keyBytes := make([]byte, keyLength)
-		if _, err := file.Read(keyBytes); err != nil {
-			return fmt.Errorf("failed to read key: %w", err)
-		}
+// settings returns the capacity and overflow policy of q.
+func (q *Queue) settings() settings {
+	return settings{maxSize: q.maxSize, overflow: q.overflow}
+}
 
-		if err := q.Enqueue(string(keyBytes)); err != nil {
+// load replaces the contents of q with values and its capacity with
+// capacity, unless err is set. It takes the results of the read functions.
+func (q *Queue) load(capacity int, values []string, err error) error {
+	if err != nil {
+		return err
+	}
+	loaded := q.emptyCopy(capacity)
+	for _, value := range values {
+		if err := loaded.Enqueue(value); err != nil {
 			return err
 		}
 	}
-
+	q.replace(loaded)
 	return nil
 }
 
-func (q *Queue) WriteText(filename string) error {
-	file, err := os.Create(filename)
-	if err != nil {
-		return fmt.Errorf("failed to open file for writing: %w", err)
+func (q *Queue) replace(other *Queue) {
+	q.head = other.head
+	q.tail = other.tail
+	q.size = other.size
+	q.maxSize = other.maxSize
+	q.version++
+}
+
+func (q *Queue) MarshalBinary() ([]byte, error) {
+	return persist.MarshalBinary(q.WriteTo)
+}
+
+func (q *Queue) UnmarshalBinary(data []byte) error {
+	return persist.UnmarshalBinary(data, q.ReadFrom)
+}
+
+// MarshalJSON encodes the queue as a JSON array in dequeue order.
+func (q *Queue) MarshalJSON() ([]byte, error) {
+	values := make([]string, 0, q.size)
+	for value := range q.All() {
+		values = append(values, value)
 	}
-	defer file.Close()
+	return json.Marshal(values)
+}
 
-	if _, err := fmt.Fprintf(file, "%d\n", q.size); err != nil {
-		return fmt.Errorf("failed to write size: %w", err)
+// UnmarshalJSON replaces the contents of the queue with the strings of a JSON
+// array, front first. Arrays longer than the queue's maximum size are
+// rejected.
+func (q *Queue) UnmarshalJSON(data []byte) error {
+	var values []string
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
 	}
+	capacity, err := fitCapacity(q.maxSize, q.overflow, len(values))
+	return q.load(capacity, values, err)
+}
 
-	current := q.head
-	for current != nil {
-		if _, err := fmt.Fprintln(file, current.Data); err != nil {
-			return fmt.Errorf("failed to write element: %w", err)
-		}
-		current = current.Next
+func (q *Queue) WriteBinary(filename string) error {
+	return persist.WriteFile(filename, q.WriteTo)
+}
+
+func (q *Queue) ReadBinary(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
 	}
+	defer file.Close()
 
-	return nil
+	_, err = q.ReadFrom(bufio.NewReader(file))
+	return err
 }
 
-func (q *Queue) ReadText(filename string) error {
+// ReadBinaryLegacy reads a file written before the container header was
+// introduced.
+func (q *Queue) ReadBinaryLegacy(filename string) error {
 	file, err := os.Open(filename)
 	if err != nil {
 		return fmt.Errorf("failed to open file: %w", err)
 	}
 	defer file.Close()
 
-	q.Clear()
+	_, err = q.ReadLegacyFrom(bufio.NewReader(file))
+	return err
+}
 
-	scanner := bufio.NewScanner(file)
-	if !scanner.Scan() {
-		return errors.New("file is empty")
+// WriteTextTo writes the size and capacity on one line and then one value per
+// line in dequeue order. Values that cannot be written verbatim are quoted
+// with persist.QuoteLine.
+func (q *Queue) WriteTextTo(w io.Writer) (int64, error) {
+	enc := persist.NewEncoder(w)
+	if err := enc.CompressText(q.encodeOpts); err != nil {
+		return enc.Len(), err
 	}
+	return writeText(enc, q, persist.QuotedLines, true)
+}
 
-	sizeStr := scanner.Text()
-	size, err := strconv.Atoi(sizeStr)
-	if err != nil {
-		return fmt.Errorf("invalid size format: %w", err)
+// WriteCppTextTo writes the queue in the format of the C++
+// Queue::writeText. Values containing a newline cannot be written.
+func (q *Queue) WriteCppTextTo(w io.Writer) (int64, error) {
+	return writeText(persist.NewEncoder(w), q, persist.CppLines, false)
+}
+
+// ReadTextFrom replaces the contents of the queue with the text data in r.
+// Like ReadFrom it takes over the capacity if the file records one.
+func (q *Queue) ReadTextFrom(r io.Reader) (int64, error) {
+	dec := persist.NewDecoder(r, q.decodeOpts)
+	if err := dec.DetectCompression(); err != nil {
+		return dec.Offset(), err
 	}
+	err := q.load(readText(dec, persist.QuotedLines, true, q.settings()))
+	return dec.Offset(), err
+}
+
+// ReadCppTextFrom replaces the contents of the queue with a file written by
+// the C++ Queue::writeText.
+func (q *Queue) ReadCppTextFrom(r io.Reader) (int64, error) {
+	dec := persist.NewDecoder(r, q.decodeOpts)
+	err := q.load(readText(dec, persist.CppLines, false, q.settings()))
+	return dec.Offset(), err
+}
+
+func (q *Queue) WriteText(filename string) error {
+	return persist.WriteFile(filename, q.WriteTextTo)
+}
 
-	if size > q.maxSize {
-		return fmt.Errorf("queue size in file exceeds maximum size %d", q.maxSize)
+func (q *Queue) ReadText(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
 	}
+	defer file.Close()
 
-	for i := 0; i < size; i++ {
-		if !scanner.Scan() {
-			return errors.New("unexpected end of file")
-		}
-		value := scanner.Text()
-		if err := q.Enqueue(value); err != nil {
-			return err
+	_, err = q.ReadTextFrom(file)
+	return err
+}
+
+// All yields the values from head to tail, in dequeue order. Enqueueing or
+// dequeueing while iterating panics.
+func (q *Queue) All() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		version := q.version
+		for current := q.head; current != nil; current = current.Next {
+			if !yield(current.Data) {
+				return
+			}
+			if q.version != version {
+				panic("queue: queue modified during iteration")
+			}
 		}
 	}
+}
 
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("error reading file: %w", err)
+// Backward yields the values from tail to head.
+func (q *Queue) Backward() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		version := q.version
+		for current := q.tail; current != nil; current = current.Prev {
+			if !yield(current.Data) {
+				return
+			}
+			if q.version != version {
+				panic("queue: queue modified during iteration")
+			}
+		}
 	}
-
-	return nil
 }
 
 func (q *Queue) Print() {
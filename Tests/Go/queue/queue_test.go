@@ -2,9 +2,16 @@ package queue
 
 import (
 	"bytes"
+	"encoding/json"
+	"io"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
 	"testing"
+
+	"Go/persist"
+	"Go/persist/persisttest"
 )
 
 func captureOutput(f func()) string {
@@ -272,10 +279,11 @@ func TestReadBinaryOverflow(t *testing.T) {
 	q := NewQueue()
 	q.maxSize = 2
 	
+	// Only files that do not record a capacity are held to the reader's.
 	original := NewQueueWithItems("a", "b", "c")
-	original.WriteBinary(filename)
+	persist.WriteFile(filename, original.WriteCppTo)
 	
-	err := q.ReadBinary(filename)
+	err := q.ReadBinaryLegacy(filename)
 	if err == nil {
 		t.Error("Expected error for queue size exceeding max")
 	}
@@ -326,8 +334,8 @@ func TestReadTextOverflow(t *testing.T) {
 	q := NewQueue()
 	q.maxSize = 2
 	
-	original := NewQueueWithItems("a", "b", "c")
-	original.WriteText(filename)
+	// Only files that do not record a capacity are held to the reader's.
+	os.WriteFile(filename, []byte("3\na\nb\nc\n"), 0644)
 	
 	err := q.ReadText(filename)
 	if err == nil {
@@ -1025,4 +1033,131 @@ func TestWriteReadTextLargeQueue(t *testing.T) {
 	if q2.Size() != 100 {
 		t.Error("Size should be 100 after reading large queue")
 	}
-}
\ No newline at end of file
+}
+
+func TestIterators(t *testing.T) {
+	q := NewQueueWithItems("a", "b", "c")
+
+	if got := slices.Collect(q.All()); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Errorf("All() = %v", got)
+	}
+	if got := slices.Collect(q.Backward()); !reflect.DeepEqual(got, []string{"c", "b", "a"}) {
+		t.Errorf("Backward() = %v", got)
+	}
+	if got := slices.Collect(NewQueue().All()); len(got) != 0 {
+		t.Errorf("All() on empty queue = %v", got)
+	}
+
+	for v := range q.Backward() {
+		if v != "c" {
+			t.Errorf("Backward() with break yielded %q first", v)
+		}
+		break
+	}
+
+	q.Del("missing")
+	for range q.All() {
+		q.Del("missing")
+	}
+
+	mutations := map[string]func(q *Queue){
+		"Enqueue": func(q *Queue) { q.Enqueue("x") },
+		"Dequeue": func(q *Queue) { q.Dequeue() },
+		"Del":     func(q *Queue) { q.Del("b") },
+		"Clear":   func(q *Queue) { q.Clear() },
+	}
+	for name, mutate := range mutations {
+		t.Run(name, func(t *testing.T) {
+			q := NewQueueWithItems("a", "b", "c")
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s during iteration did not panic", name)
+				}
+			}()
+			for range q.Backward() {
+				mutate(q)
+			}
+		})
+	}
+}
+
+func TestReaderWriter(t *testing.T) {
+	persisttest.TestContainer(t, persisttest.Fixture[*Queue]{
+		New:      func() *Queue { return NewQueue() },
+		Make:     func(values []string) *Queue { return NewQueueWithItems(values...) },
+		Contents: func(q *Queue) any { return slices.Collect(q.All()) },
+		// The legacy format lacks the capacity after the header.
+		LegacySkip: 8,
+	})
+}
+
+func TestJSON(t *testing.T) {
+	q := NewQueueWithItems("first", "second")
+	data, err := json.Marshal(q)
+	if err != nil {
+		t.Fatalf("json.Marshal() failed: %v", err)
+	}
+	if string(data) != `["first","second"]` {
+		t.Errorf("json.Marshal() = %s", data)
+	}
+
+	loaded := NewQueue()
+	if err := json.Unmarshal(data, loaded); err != nil {
+		t.Fatalf("json.Unmarshal() failed: %v", err)
+	}
+	if got, _ := loaded.Dequeue(); got != "first" {
+		t.Errorf("Dequeue() after json.Unmarshal() = %q, want first", got)
+	}
+
+	small := NewQueueWithItems("keep")
+	small.maxSize = 1
+	if err := json.Unmarshal(data, small); err == nil {
+		t.Error("json.Unmarshal() over maxSize returned nil error")
+	}
+	if got := slices.Collect(small.All()); !reflect.DeepEqual(got, []string{"keep"}) {
+		t.Errorf("failed json.Unmarshal() changed the queue to %q", got)
+	}
+
+	if data, _ := json.Marshal(NewQueue()); string(data) != "[]" {
+		t.Errorf("json.Marshal() of empty queue = %s, want []", data)
+	}
+}
+
+// TestCppGolden checks the C++ formats against files written by the C++
+// Queue; see Serialization/C++/Golden.
+func TestCppGolden(t *testing.T) {
+	want := []string{"alpha", "b c", "", "юникод"}
+	tests := []struct {
+		file  string
+		write func(*Queue, io.Writer) (int64, error)
+		read  func(*Queue, io.Reader) (int64, error)
+	}{
+		{"queue.bin", (*Queue).WriteCppTo, (*Queue).ReadCppFrom},
+		{"queue.txt", (*Queue).WriteCppTextTo, (*Queue).ReadCppTextFrom},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			golden, err := os.ReadFile(filepath.Join("testdata", "cpp", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			loaded := NewQueue()
+			if _, err := tt.read(loaded, bytes.NewReader(golden)); err != nil {
+				t.Fatalf("reading the C++ file failed: %v", err)
+			}
+			if got := slices.Collect(loaded.All()); !reflect.DeepEqual(got, want) {
+				t.Errorf("read %q, want %q", got, want)
+			}
+
+			original := NewQueueWithItems(want...)
+			var buf bytes.Buffer
+			if _, err := tt.write(original, &buf); err != nil {
+				t.Fatalf("writing the C++ format failed: %v", err)
+			}
+			if !bytes.Equal(buf.Bytes(), golden) {
+				t.Errorf("wrote\n%q\nwant\n%q", buf.Bytes(), golden)
+			}
+		})
+	}
+}
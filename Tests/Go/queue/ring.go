@@ -0,0 +1,307 @@
+package queue
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+
+	"Go/persist"
+)
+
+// minRingCapacity is the smallest buffer a RingQueue allocates.
+const minRingCapacity = 8
+
+// RingQueue is a queue with the methods and file formats of Queue that keeps
+// its values in a circular buffer instead of a linked list, so Enqueue does
+// not allocate unless the buffer is full. The buffer doubles when it fills
+// up, but never beyond the capacity of a bounded queue.
+//
+// Its files are byte for byte those Queue writes for the same values and
+// options, so the two types can read each other's files.
+type RingQueue struct {
+	buf        []string
+	head       int
+	size       int
+	maxSize    int // 0 for an unbounded queue
+	overflow   OverflowPolicy
+	version    int
+	encodeOpts persist.EncodeOptions
+	decodeOpts persist.DecodeOptions
+}
+
+// NewRingQueue creates an empty queue with the same defaults and options as
+// NewQueue.
+func NewRingQueue(opts ...Option) *RingQueue {
+	settings := newSettings(opts)
+	return &RingQueue{maxSize: settings.maxSize, overflow: settings.overflow}
+}
+
+// index returns the buffer index of the i-th value from the front.
+func (rq *RingQueue) index(i int) int {
+	i += rq.head
+	if i >= len(rq.buf) {
+		i -= len(rq.buf)
+	}
+	return i
+}
+
+// grow moves the values into a buffer twice as large, or as large as the
+// capacity if that is smaller.
+func (rq *RingQueue) grow() {
+	capacity := max(2*len(rq.buf), minRingCapacity)
+	if rq.maxSize != 0 {
+		capacity = min(capacity, rq.maxSize)
+	}
+	buf := make([]string, capacity)
+	n := copy(buf, rq.buf[rq.head:])
+	copy(buf[n:], rq.buf[:rq.head])
+	rq.buf = buf
+	rq.head = 0
+}
+
+// Enqueue adds value to the back of the queue. When the queue is full, the
+// overflow policy decides what happens.
+func (rq *RingQueue) Enqueue(value string) error {
+	if rq.maxSize != 0 && rq.size >= rq.maxSize {
+		switch rq.overflow {
+		case OverflowDropOldest:
+			rq.Dequeue()
+		case OverflowDropNewest:
+			return nil
+		case OverflowGrow:
+			rq.maxSize *= 2
+		default:
+			return ErrFull
+		}
+	}
+
+	if rq.size == len(rq.buf) {
+		rq.grow()
+	}
+	rq.buf[rq.index(rq.size)] = value
+	rq.size++
+	rq.version++
+	return nil
+}
+
+func (rq *RingQueue) Dequeue() (string, error) {
+	if rq.size == 0 {
+		return "", ErrEmpty
+	}
+
+	value := rq.buf[rq.head]
+	rq.buf[rq.head] = ""
+	rq.head = rq.index(1)
+	rq.size--
+	rq.version++
+	return value, nil
+}
+
+// Del removes the first occurrence of key and moves the values behind it one
+// place forward.
+func (rq *RingQueue) Del(key string) {
+	found := -1
+	for i := 0; i < rq.size; i++ {
+		if rq.buf[rq.index(i)] == key {
+			found = i
+			break
+		}
+	}
+	if found < 0 {
+		return
+	}
+
+	for i := found; i < rq.size-1; i++ {
+		rq.buf[rq.index(i)] = rq.buf[rq.index(i+1)]
+	}
+	rq.buf[rq.index(rq.size-1)] = ""
+	rq.size--
+	rq.version++
+}
+
+func (rq *RingQueue) Size() int {
+	return rq.size
+}
+
+// Capacity returns the number of values the queue holds before its overflow
+// policy applies, or 0 if it is unbounded.
+func (rq *RingQueue) Capacity() int {
+	return rq.maxSize
+}
+
+// Overflow returns the overflow policy of the queue.
+func (rq *RingQueue) Overflow() OverflowPolicy {
+	return rq.overflow
+}
+
+// Clear removes every value and releases the buffer.
+func (rq *RingQueue) Clear() {
+	rq.buf = nil
+	rq.head = 0
+	rq.size = 0
+	rq.version++
+}
+
+// All yields the values from front to back, in dequeue order. Enqueueing or
+// dequeueing while iterating panics.
+func (rq *RingQueue) All() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		version := rq.version
+		for i := 0; i < rq.size; i++ {
+			if !yield(rq.buf[rq.index(i)]) {
+				return
+			}
+			if rq.version != version {
+				panic("queue: queue modified during iteration")
+			}
+		}
+	}
+}
+
+// Backward yields the values from back to front.
+func (rq *RingQueue) Backward() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		version := rq.version
+		for i := rq.size - 1; i >= 0; i-- {
+			if !yield(rq.buf[rq.index(i)]) {
+				return
+			}
+			if rq.version != version {
+				panic("queue: queue modified during iteration")
+			}
+		}
+	}
+}
+
+// WriteTo writes the queue in the binary format of Queue.WriteTo.
+func (rq *RingQueue) WriteTo(w io.Writer) (int64, error) {
+	return writeTo(w, rq, rq.encodeOpts)
+}
+
+// ReadFrom replaces the contents of the queue with the binary data in r, as
+// Queue.ReadFrom does. The queue is left unchanged if the data cannot be
+// decoded.
+func (rq *RingQueue) ReadFrom(r io.Reader) (int64, error) {
+	dec := persist.NewDecoder(r, rq.decodeOpts)
+	h, err := dec.ExpectHeader(header(rq.encodeOpts))
+	if err != nil {
+		return dec.Offset(), err
+	}
+	err = rq.load(readBinary(dec, h.Flags&persist.FlagCapacity != 0, rq.settings()))
+	return dec.Offset(), err
+}
+
+// SetEncodeOptions changes the optional parts of the binary format written by
+// WriteTo and WriteBinary. Its Compression also applies to WriteTextTo and
+// WriteText; readers detect compressed files on their own.
+func (rq *RingQueue) SetEncodeOptions(opts persist.EncodeOptions) {
+	rq.encodeOpts = opts
+}
+
+// SetDecodeOptions changes the resource limits enforced by every Read*
+// method. Input that goes over a limit fails with persist.ErrLimitExceeded.
+func (rq *RingQueue) SetDecodeOptions(opts persist.DecodeOptions) {
+	rq.decodeOpts = opts
+}
+
+// settings returns the capacity and overflow policy of rq.
+func (rq *RingQueue) settings() settings {
+	return settings{maxSize: rq.maxSize, overflow: rq.overflow}
+}
+
+// load replaces the contents of rq with values and its capacity with
+// capacity, unless err is set. It takes the results of the read functions.
+func (rq *RingQueue) load(capacity int, values []string, err error) error {
+	if err != nil {
+		return err
+	}
+	buf := make([]string, max(len(values), min(capacity, minRingCapacity)))
+	copy(buf, values)
+	rq.buf = buf
+	rq.head = 0
+	rq.size = len(values)
+	rq.maxSize = capacity
+	rq.version++
+	return nil
+}
+
+func (rq *RingQueue) MarshalBinary() ([]byte, error) {
+	return persist.MarshalBinary(rq.WriteTo)
+}
+
+func (rq *RingQueue) UnmarshalBinary(data []byte) error {
+	return persist.UnmarshalBinary(data, rq.ReadFrom)
+}
+
+// MarshalJSON encodes the queue as a JSON array in dequeue order.
+func (rq *RingQueue) MarshalJSON() ([]byte, error) {
+	values := make([]string, 0, rq.size)
+	for value := range rq.All() {
+		values = append(values, value)
+	}
+	return json.Marshal(values)
+}
+
+// UnmarshalJSON replaces the contents of the queue with the strings of a JSON
+// array, front first, as Queue.UnmarshalJSON does.
+func (rq *RingQueue) UnmarshalJSON(data []byte) error {
+	var values []string
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	capacity, err := fitCapacity(rq.maxSize, rq.overflow, len(values))
+	return rq.load(capacity, values, err)
+}
+
+func (rq *RingQueue) WriteBinary(filename string) error {
+	return persist.WriteFile(filename, rq.WriteTo)
+}
+
+func (rq *RingQueue) ReadBinary(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	_, err = rq.ReadFrom(bufio.NewReader(file))
+	return err
+}
+
+// WriteTextTo writes the queue in the text format of Queue.WriteTextTo.
+func (rq *RingQueue) WriteTextTo(w io.Writer) (int64, error) {
+	enc := persist.NewEncoder(w)
+	if err := enc.CompressText(rq.encodeOpts); err != nil {
+		return enc.Len(), err
+	}
+	return writeText(enc, rq, persist.QuotedLines, true)
+}
+
+// ReadTextFrom replaces the contents of the queue with the text data in r.
+// Like ReadFrom it takes over the capacity if the file records one.
+func (rq *RingQueue) ReadTextFrom(r io.Reader) (int64, error) {
+	dec := persist.NewDecoder(r, rq.decodeOpts)
+	if err := dec.DetectCompression(); err != nil {
+		return dec.Offset(), err
+	}
+	err := rq.load(readText(dec, persist.QuotedLines, true, rq.settings()))
+	return dec.Offset(), err
+}
+
+func (rq *RingQueue) WriteText(filename string) error {
+	return persist.WriteFile(filename, rq.WriteTextTo)
+}
+
+func (rq *RingQueue) ReadText(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	_, err = rq.ReadTextFrom(file)
+	return err
+}
@@ -0,0 +1,274 @@
+package queue
+
+import (
+	"bytes"
+	"math/rand"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+
+	"Go/persist"
+	"Go/persist/persisttest"
+)
+
+// sameQueues fails the test unless rq holds the values of q in the same
+// order.
+func sameQueues(t *testing.T, rq *RingQueue, q *Queue) {
+	t.Helper()
+	if got, want := slices.Collect(rq.All()), slices.Collect(q.All()); !slices.Equal(got, want) {
+		t.Fatalf("RingQueue holds %v, Queue holds %v", got, want)
+	}
+	if got, want := slices.Collect(rq.Backward()), slices.Collect(q.Backward()); !slices.Equal(got, want) {
+		t.Fatalf("RingQueue.Backward() yields %v, Queue.Backward() yields %v", got, want)
+	}
+	if rq.Size() != q.Size() || rq.Capacity() != q.Capacity() {
+		t.Fatalf("RingQueue has Size() = %d, Capacity() = %d; Queue has %d, %d", rq.Size(), rq.Capacity(), q.Size(), q.Capacity())
+	}
+}
+
+func TestRingQueue(t *testing.T) {
+	t.Run("LikeQueue", func(t *testing.T) {
+		configs := map[string][]Option{
+			"Default":    nil,
+			"Unbounded":  {Unbounded()},
+			"DropOldest": {WithCapacity(13), WithOverflow(OverflowDropOldest)},
+			"DropNewest": {WithCapacity(13), WithOverflow(OverflowDropNewest)},
+			"Grow":       {WithCapacity(5), WithOverflow(OverflowGrow)},
+		}
+		for name, opts := range configs {
+			t.Run(name, func(t *testing.T) {
+				rng := rand.New(rand.NewSource(1))
+				rq := NewRingQueue(opts...)
+				q := NewQueue(opts...)
+				for i := 0; i < 5000; i++ {
+					switch op := rng.Intn(10); {
+					case op < 6:
+						value := strconv.Itoa(rng.Intn(50))
+						if got, want := rq.Enqueue(value), q.Enqueue(value); got != want {
+							t.Fatalf("Enqueue() = %v, Queue returned %v", got, want)
+						}
+					case op < 9:
+						got, gotErr := rq.Dequeue()
+						want, wantErr := q.Dequeue()
+						if got != want || gotErr != wantErr {
+							t.Fatalf("Dequeue() = %q, %v; Queue returned %q, %v", got, gotErr, want, wantErr)
+						}
+					default:
+						value := strconv.Itoa(rng.Intn(50))
+						rq.Del(value)
+						q.Del(value)
+					}
+					sameQueues(t, rq, q)
+				}
+				rq.Clear()
+				q.Clear()
+				sameQueues(t, rq, q)
+			})
+		}
+	})
+
+	t.Run("Bounded", func(t *testing.T) {
+		rq := NewRingQueue(WithCapacity(20))
+		for i := 0; i < 20; i++ {
+			if err := rq.Enqueue(strconv.Itoa(i)); err != nil {
+				t.Fatalf("Enqueue(%d) failed: %v", i, err)
+			}
+		}
+		if err := rq.Enqueue("over"); err != ErrFull {
+			t.Errorf("Enqueue() on a full queue = %v, want ErrFull", err)
+		}
+		if len(rq.buf) != 20 {
+			t.Errorf("buffer holds %d slots, want 20", len(rq.buf))
+		}
+
+		// Wrap the buffer around its end.
+		for i := 0; i < 15; i++ {
+			rq.Dequeue()
+			rq.Enqueue(strconv.Itoa(20 + i))
+		}
+		if len(rq.buf) != 20 {
+			t.Errorf("buffer grew to %d slots", len(rq.buf))
+		}
+		if value, err := rq.Dequeue(); err != nil || value != "15" {
+			t.Errorf("Dequeue() = %q, %v, want \"15\"", value, err)
+		}
+	})
+
+	t.Run("Unbounded", func(t *testing.T) {
+		rq := NewRingQueue(Unbounded())
+		for i := 0; i < 100; i++ {
+			rq.Enqueue(strconv.Itoa(i))
+		}
+		if len(rq.buf) != 128 {
+			t.Errorf("buffer holds %d slots, want 128", len(rq.buf))
+		}
+		if allocs := testing.AllocsPerRun(100, func() {
+			rq.Enqueue("x")
+			rq.Dequeue()
+		}); allocs != 0 {
+			t.Errorf("Enqueue() and Dequeue() allocate %.1f times", allocs)
+		}
+	})
+
+	t.Run("ModifiedDuringIteration", func(t *testing.T) {
+		rq := NewRingQueue()
+		rq.Enqueue("a")
+		rq.Enqueue("b")
+		defer func() {
+			if recover() == nil {
+				t.Error("enqueueing during All() did not panic")
+			}
+		}()
+		for value := range rq.All() {
+			rq.Enqueue(value)
+		}
+	})
+}
+
+func TestRingQueueFiles(t *testing.T) {
+	q := NewQueue(WithCapacity(64))
+	rq := NewRingQueue(WithCapacity(64))
+	for i := 0; i < 40; i++ {
+		value := "value " + strconv.Itoa(i)
+		if i%7 == 0 {
+			value += "\nwith a newline"
+		}
+		q.Enqueue(value)
+		rq.Enqueue(value)
+	}
+	// Move the ring's front away from index 0.
+	for i := 0; i < 10; i++ {
+		q.Enqueue(strconv.Itoa(i))
+		q.Dequeue()
+		rq.Enqueue(strconv.Itoa(i))
+		rq.Dequeue()
+	}
+
+	options := map[string]persist.EncodeOptions{
+		"Plain":     {},
+		"Checksums": {RecordChecksums: true},
+		"Gzip":      {Compression: persist.CompressionGzip},
+	}
+	for name, opts := range options {
+		t.Run(name, func(t *testing.T) {
+			q.SetEncodeOptions(opts)
+			rq.SetEncodeOptions(opts)
+
+			var want, got bytes.Buffer
+			if _, err := q.WriteTo(&want); err != nil {
+				t.Fatalf("Queue.WriteTo() failed: %v", err)
+			}
+			if _, err := rq.WriteTo(&got); err != nil {
+				t.Fatalf("WriteTo() failed: %v", err)
+			}
+			if !bytes.Equal(got.Bytes(), want.Bytes()) {
+				t.Errorf("WriteTo() wrote %x, Queue wrote %x", got.Bytes(), want.Bytes())
+			}
+
+			want.Reset()
+			got.Reset()
+			if _, err := q.WriteTextTo(&want); err != nil {
+				t.Fatalf("Queue.WriteTextTo() failed: %v", err)
+			}
+			if _, err := rq.WriteTextTo(&got); err != nil {
+				t.Fatalf("WriteTextTo() failed: %v", err)
+			}
+			if !bytes.Equal(got.Bytes(), want.Bytes()) {
+				t.Errorf("WriteTextTo() wrote %q, Queue wrote %q", got.Bytes(), want.Bytes())
+			}
+		})
+	}
+
+	t.Run("CrossRead", func(t *testing.T) {
+		dir := t.TempDir()
+		ringFile := filepath.Join(dir, "ring.bin")
+		if err := rq.WriteBinary(ringFile); err != nil {
+			t.Fatalf("WriteBinary() failed: %v", err)
+		}
+		fromRing := NewQueue()
+		if err := fromRing.ReadBinary(ringFile); err != nil {
+			t.Fatalf("Queue.ReadBinary() failed: %v", err)
+		}
+		sameQueues(t, rq, fromRing)
+
+		listFile := filepath.Join(dir, "list.txt")
+		if err := q.WriteText(listFile); err != nil {
+			t.Fatalf("Queue.WriteText() failed: %v", err)
+		}
+		fromList := NewRingQueue(WithCapacity(1))
+		if err := fromList.ReadText(listFile); err != nil {
+			t.Fatalf("ReadText() failed: %v", err)
+		}
+		sameQueues(t, fromList, q)
+
+		data, err := q.MarshalJSON()
+		if err != nil {
+			t.Fatalf("Queue.MarshalJSON() failed: %v", err)
+		}
+		fromJSON := NewRingQueue(WithCapacity(64))
+		if err := fromJSON.UnmarshalJSON(data); err != nil {
+			t.Fatalf("UnmarshalJSON() failed: %v", err)
+		}
+		sameQueues(t, fromJSON, q)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		data, err := rq.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary() failed: %v", err)
+		}
+		loaded := NewRingQueue()
+		loaded.Enqueue("kept")
+		if err := loaded.UnmarshalBinary(data[:len(data)-1]); err == nil {
+			t.Error("UnmarshalBinary() of truncated data succeeded")
+		}
+		if err := loaded.ReadBinary(filepath.Join(t.TempDir(), "missing.bin")); err == nil {
+			t.Error("ReadBinary() of a missing file succeeded")
+		}
+		if got := slices.Collect(loaded.All()); !slices.Equal(got, []string{"kept"}) {
+			t.Errorf("failed reads left %v", got)
+		}
+	})
+}
+
+func BenchmarkQueueEnqueueDequeue(b *testing.B) {
+	for _, size := range []int{16, 512} {
+		b.Run("List/"+strconv.Itoa(size), func(b *testing.B) {
+			q := NewQueue(Unbounded())
+			for i := 0; i < size; i++ {
+				q.Enqueue("value")
+			}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				q.Enqueue("value")
+				q.Dequeue()
+			}
+		})
+		b.Run("Ring/"+strconv.Itoa(size), func(b *testing.B) {
+			rq := NewRingQueue(Unbounded())
+			for i := 0; i < size; i++ {
+				rq.Enqueue("value")
+			}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				rq.Enqueue("value")
+				rq.Dequeue()
+			}
+		})
+	}
+}
+
+func TestRingQueueReaderWriter(t *testing.T) {
+	persisttest.TestContainer(t, persisttest.Fixture[*RingQueue]{
+		New: func() *RingQueue { return NewRingQueue() },
+		Make: func(values []string) *RingQueue {
+			rq := NewRingQueue()
+			for _, value := range values {
+				rq.Enqueue(value)
+			}
+			return rq
+		},
+		Contents: func(rq *RingQueue) any { return slices.Collect(rq.All()) },
+	})
+}
@@ -0,0 +1,1085 @@
+package redblack
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"math/bits"
+	"os"
+	"strconv"
+	"strings"
+
+	"Go/persist"
+)
+
+const (
+	black = false
+	red   = true
+)
+
+type RBTNode struct {
+	key    int
+	value  string
+	left   *RBTNode
+	right  *RBTNode
+	parent *RBTNode
+	color  bool
+}
+
+type Tree struct {
+	root       *RBTNode
+	size       int
+	version    int
+	encodeOpts persist.EncodeOptions
+	decodeOpts persist.DecodeOptions
+}
+
+func NewTree() *Tree {
+	return &Tree{
+		root: nil,
+		size: 0,
+	}
+}
+
+func isRed(n *RBTNode) bool {
+	return n != nil && n.color == red
+}
+
+func (t *Tree) leftRotate(x *RBTNode) {
+	y := x.right
+	x.right = y.left
+
+	if y.left != nil {
+		y.left.parent = x
+	}
+
+	y.parent = x.parent
+
+	if x.parent == nil {
+		t.root = y
+	} else if x == x.parent.left {
+		x.parent.left = y
+	} else {
+		x.parent.right = y
+	}
+
+	y.left = x
+	x.parent = y
+}
+
+func (t *Tree) rightRotate(y *RBTNode) {
+	x := y.left
+	y.left = x.right
+
+	if x.right != nil {
+		x.right.parent = y
+	}
+
+	x.parent = y.parent
+
+	if y.parent == nil {
+		t.root = x
+	} else if y == y.parent.right {
+		y.parent.right = x
+	} else {
+		y.parent.left = x
+	}
+
+	x.right = y
+	y.parent = x
+}
+
+func (t *Tree) fixViolation(z *RBTNode) {
+	for z != t.root && isRed(z.parent) {
+		grandparent := z.parent.parent
+		if z.parent == grandparent.left {
+			uncle := grandparent.right
+			if isRed(uncle) {
+				z.parent.color = black
+				uncle.color = black
+				grandparent.color = red
+				z = grandparent
+				continue
+			}
+			if z == z.parent.right {
+				z = z.parent
+				t.leftRotate(z)
+			}
+			z.parent.color = black
+			z.parent.parent.color = red
+			t.rightRotate(z.parent.parent)
+		} else {
+			uncle := grandparent.left
+			if isRed(uncle) {
+				z.parent.color = black
+				uncle.color = black
+				grandparent.color = red
+				z = grandparent
+				continue
+			}
+			if z == z.parent.left {
+				z = z.parent
+				t.rightRotate(z)
+			}
+			z.parent.color = black
+			z.parent.parent.color = red
+			t.leftRotate(z.parent.parent)
+		}
+	}
+	t.root.color = black
+}
+
+func (t *Tree) findNode(key int) *RBTNode {
+	current := t.root
+	for current != nil {
+		if key == current.key {
+			return current
+		} else if key < current.key {
+			current = current.left
+		} else {
+			current = current.right
+		}
+	}
+	return nil
+}
+
+func (t *Tree) Insert(key int, value string) {
+	var parent *RBTNode
+	current := t.root
+	for current != nil {
+		parent = current
+		if key == current.key {
+			current.value = value
+			return
+		} else if key < current.key {
+			current = current.left
+		} else {
+			current = current.right
+		}
+	}
+
+	newNode := &RBTNode{key: key, value: value, parent: parent, color: red}
+	if parent == nil {
+		t.root = newNode
+	} else if key < parent.key {
+		parent.left = newNode
+	} else {
+		parent.right = newNode
+	}
+	t.size++
+	t.version++
+
+	t.fixViolation(newNode)
+}
+
+func (t *Tree) transplant(u, v *RBTNode) {
+	if u.parent == nil {
+		t.root = v
+	} else if u == u.parent.left {
+		u.parent.left = v
+	} else {
+		u.parent.right = v
+	}
+
+	if v != nil {
+		v.parent = u.parent
+	}
+}
+
+func (t *Tree) fixDelete(x, xParent *RBTNode) {
+	for x != t.root && !isRed(x) && xParent != nil {
+		if x == xParent.left {
+			w := xParent.right
+			if isRed(w) {
+				w.color = black
+				xParent.color = red
+				t.leftRotate(xParent)
+				w = xParent.right
+			}
+			if w == nil {
+				break
+			}
+
+			if !isRed(w.left) && !isRed(w.right) {
+				w.color = red
+				x = xParent
+				xParent = x.parent
+				continue
+			}
+			if !isRed(w.right) {
+				w.left.color = black
+				w.color = red
+				t.rightRotate(w)
+				w = xParent.right
+			}
+			w.color = xParent.color
+			if w.right != nil {
+				w.right.color = black
+			}
+			xParent.color = black
+			t.leftRotate(xParent)
+			x = t.root
+		} else {
+			w := xParent.left
+			if isRed(w) {
+				w.color = black
+				xParent.color = red
+				t.rightRotate(xParent)
+				w = xParent.left
+			}
+			if w == nil {
+				break
+			}
+
+			if !isRed(w.right) && !isRed(w.left) {
+				w.color = red
+				x = xParent
+				xParent = x.parent
+				continue
+			}
+			if !isRed(w.left) {
+				w.right.color = black
+				w.color = red
+				t.leftRotate(w)
+				w = xParent.left
+			}
+			w.color = xParent.color
+			if w.left != nil {
+				w.left.color = black
+			}
+			xParent.color = black
+			t.rightRotate(xParent)
+			x = t.root
+		}
+	}
+
+	if x != nil {
+		x.color = black
+	}
+}
+
+func (t *Tree) Delete(key int) error {
+	if t.root == nil {
+		return errors.New("tree is empty")
+	}
+
+	z := t.findNode(key)
+	if z == nil {
+		return errors.New("key not found")
+	}
+
+	var x, xParent *RBTNode
+	yOriginalColor := z.color
+
+	if z.left == nil {
+		x = z.right
+		xParent = z.parent
+		t.transplant(z, z.right)
+	} else if z.right == nil {
+		x = z.left
+		xParent = z.parent
+		t.transplant(z, z.left)
+	} else {
+		y := minNode(z.right)
+		yOriginalColor = y.color
+		x = y.right
+
+		if y.parent == z {
+			xParent = y
+		} else {
+			xParent = y.parent
+			t.transplant(y, y.right)
+			y.right = z.right
+			y.right.parent = y
+		}
+
+		t.transplant(z, y)
+		y.left = z.left
+		y.left.parent = y
+		y.color = z.color
+	}
+	t.size--
+	t.version++
+
+	if yOriginalColor == black {
+		t.fixDelete(x, xParent)
+	}
+	return nil
+}
+
+func (t *Tree) Get(key int) (string, error) {
+	node := t.findNode(key)
+	if node == nil {
+		return "", errors.New("key not found")
+	}
+	return node.value, nil
+}
+
+func (t *Tree) Contains(key int) bool {
+	return t.findNode(key) != nil
+}
+
+func minNode(n *RBTNode) *RBTNode {
+	for n.left != nil {
+		n = n.left
+	}
+	return n
+}
+
+func maxNode(n *RBTNode) *RBTNode {
+	for n.right != nil {
+		n = n.right
+	}
+	return n
+}
+
+func (t *Tree) Min() (int, string, error) {
+	if t.root == nil {
+		return 0, "", errors.New("tree is empty")
+	}
+	n := minNode(t.root)
+	return n.key, n.value, nil
+}
+
+func (t *Tree) Max() (int, string, error) {
+	if t.root == nil {
+		return 0, "", errors.New("tree is empty")
+	}
+	n := maxNode(t.root)
+	return n.key, n.value, nil
+}
+
+// Floor returns the entry with the largest key less than or equal to key.
+func (t *Tree) Floor(key int) (int, string, error) {
+	var found *RBTNode
+	current := t.root
+	for current != nil {
+		if key == current.key {
+			return current.key, current.value, nil
+		} else if key < current.key {
+			current = current.left
+		} else {
+			found = current
+			current = current.right
+		}
+	}
+	if found == nil {
+		return 0, "", errors.New("no key less than or equal to the given one")
+	}
+	return found.key, found.value, nil
+}
+
+// Ceiling returns the entry with the smallest key greater than or equal to key.
+func (t *Tree) Ceiling(key int) (int, string, error) {
+	var found *RBTNode
+	current := t.root
+	for current != nil {
+		if key == current.key {
+			return current.key, current.value, nil
+		} else if key > current.key {
+			current = current.right
+		} else {
+			found = current
+			current = current.left
+		}
+	}
+	if found == nil {
+		return 0, "", errors.New("no key greater than or equal to the given one")
+	}
+	return found.key, found.value, nil
+}
+
+// InOrder visits the entries in ascending key order until visit returns false.
+func (t *Tree) InOrder(visit func(key int, value string) bool) {
+	var walk func(n *RBTNode) bool
+	walk = func(n *RBTNode) bool {
+		if n == nil {
+			return true
+		}
+		return walk(n.left) && visit(n.key, n.value) && walk(n.right)
+	}
+	walk(t.root)
+}
+
+// All yields the entries in ascending key order. Inserting or deleting keys
+// while iterating panics.
+func (t *Tree) All() iter.Seq2[int, string] {
+	return func(yield func(int, string) bool) {
+		version := t.version
+		for n := t.first(); n != nil; n = successor(n) {
+			if !yield(n.key, n.value) {
+				return
+			}
+			if t.version != version {
+				panic("redblack: tree modified during iteration")
+			}
+		}
+	}
+}
+
+// Backward yields the entries in descending key order.
+func (t *Tree) Backward() iter.Seq2[int, string] {
+	return func(yield func(int, string) bool) {
+		version := t.version
+		for n := t.last(); n != nil; n = predecessor(n) {
+			if !yield(n.key, n.value) {
+				return
+			}
+			if t.version != version {
+				panic("redblack: tree modified during iteration")
+			}
+		}
+	}
+}
+
+func (t *Tree) first() *RBTNode {
+	if t.root == nil {
+		return nil
+	}
+	return minNode(t.root)
+}
+
+func (t *Tree) last() *RBTNode {
+	if t.root == nil {
+		return nil
+	}
+	return maxNode(t.root)
+}
+
+func successor(n *RBTNode) *RBTNode {
+	if n.right != nil {
+		return minNode(n.right)
+	}
+	for n.parent != nil && n == n.parent.right {
+		n = n.parent
+	}
+	return n.parent
+}
+
+func predecessor(n *RBTNode) *RBTNode {
+	if n.left != nil {
+		return maxNode(n.left)
+	}
+	for n.parent != nil && n == n.parent.left {
+		n = n.parent
+	}
+	return n.parent
+}
+
+func (t *Tree) Keys() []int {
+	keys := make([]int, 0, t.size)
+	t.InOrder(func(key int, _ string) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+func (t *Tree) Size() int {
+	return t.size
+}
+
+func (t *Tree) IsEmpty() bool {
+	return t.size == 0
+}
+
+func (t *Tree) Clear() {
+	t.root = nil
+	t.size = 0
+	t.version++
+}
+
+func (t *Tree) Print() {
+	if t.root == nil {
+		fmt.Println("Дерево пустое")
+		return
+	}
+	fmt.Print("In-order обход: ")
+	printInOrder(t.root)
+	fmt.Println()
+}
+
+func printInOrder(n *RBTNode) {
+	if n == nil {
+		return
+	}
+	printInOrder(n.left)
+	color := "B"
+	if n.color == red {
+		color = "R"
+	}
+	fmt.Printf("%d:%s(%s) ", n.key, n.value, color)
+	printInOrder(n.right)
+}
+
+// errTooDeep is wrapped by the CorruptionError returned for a file whose
+// tree is deeper than any red-black tree of its size.
+var errTooDeep = errors.New("tree is deeper than a red-black tree of its size")
+
+// maxDepth returns the greatest depth, counting the root as 1, a node of a
+// red-black tree with size nodes can have: 2*ceil(log2(size+1)). Readers
+// stop at it so that a degenerate tree in a file cannot exhaust the stack.
+func maxDepth(size uint64) int {
+	return 2 * bits.Len64(size)
+}
+
+// validate checks the search-tree ordering and the red-black invariants of
+// a freshly loaded tree, returning the number of nodes it holds. Trees
+// deeper than maxDepth of their size are rejected before the recursion can
+// follow them down.
+func (t *Tree) validate() (int, error) {
+	if isRed(t.root) {
+		return 0, errors.New("root must be black")
+	}
+	count, limit := 0, maxDepth(uint64(t.size))
+	var check func(n *RBTNode, lo, hi *int, depth int) (int, error)
+	check = func(n *RBTNode, lo, hi *int, depth int) (int, error) {
+		if n == nil {
+			return 1, nil
+		}
+		if depth > limit {
+			return 0, errTooDeep
+		}
+		count++
+		if (lo != nil && n.key <= *lo) || (hi != nil && n.key >= *hi) {
+			return 0, fmt.Errorf("key %d breaks the search order", n.key)
+		}
+		if isRed(n) && (isRed(n.left) || isRed(n.right)) {
+			return 0, fmt.Errorf("red node %d has a red child", n.key)
+		}
+		leftHeight, err := check(n.left, lo, &n.key, depth+1)
+		if err != nil {
+			return 0, err
+		}
+		rightHeight, err := check(n.right, &n.key, hi, depth+1)
+		if err != nil {
+			return 0, err
+		}
+		if leftHeight != rightHeight {
+			return 0, fmt.Errorf("black height differs under node %d", n.key)
+		}
+		if n.color == black {
+			leftHeight++
+		}
+		return leftHeight, nil
+	}
+	if _, err := check(t.root, nil, nil, 1); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func boolByte(b bool) uint8 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func writeBinaryNode(enc *persist.Encoder, n *RBTNode) error {
+	if err := persist.Int.Encode(enc, n.key); err != nil {
+		return err
+	}
+	if err := persist.String64.Encode(enc, n.value); err != nil {
+		return err
+	}
+	flags := []uint8{boolByte(n.color), boolByte(n.left != nil), boolByte(n.right != nil)}
+	if _, err := enc.Write(flags); err != nil {
+		return err
+	}
+	if err := enc.EndRecord(); err != nil {
+		return err
+	}
+	if n.left != nil {
+		if err := writeBinaryNode(enc, n.left); err != nil {
+			return err
+		}
+	}
+	if n.right != nil {
+		if err := writeBinaryNode(enc, n.right); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteTo writes the tree in its binary format: the size followed by the
+// nodes in pre-order, each with its color and child flags.
+func (t *Tree) WriteTo(w io.Writer) (int64, error) {
+	enc := persist.NewEncoder(w)
+	if err := enc.WriteHeader(t.header()); err != nil {
+		return enc.Len(), err
+	}
+	if err := enc.Uint64(uint64(t.size)); err != nil {
+		return enc.Len(), err
+	}
+	if t.root != nil {
+		if err := writeBinaryNode(enc, t.root); err != nil {
+			return enc.Len(), err
+		}
+	}
+	err := enc.Finish()
+	return enc.Len(), err
+}
+
+// readBinaryNode reads the subtree written by writeBinaryNode. depth is the
+// number of levels it may still descend, starting from maxDepth.
+func readBinaryNode(dec *persist.Decoder, parent *RBTNode, remaining *uint64, depth int) (*RBTNode, error) {
+	if *remaining == 0 {
+		return nil, errors.New("more nodes in file than declared")
+	}
+	if depth == 0 {
+		return nil, &persist.CorruptionError{Offset: dec.Offset(), Err: errTooDeep}
+	}
+	*remaining--
+
+	key, err := persist.Int.Decode(dec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %w", err)
+	}
+	value, err := persist.String64.Decode(dec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read value: %w", err)
+	}
+	var flags [3]uint8
+	for i := range flags {
+		if flags[i], err = dec.Uint8(); err != nil {
+			return nil, fmt.Errorf("failed to read node flags: %w", err)
+		}
+	}
+	if err := dec.EndRecord(); err != nil {
+		return nil, err
+	}
+
+	n := &RBTNode{key: key, value: value, parent: parent, color: flags[0] == 1}
+	if flags[1] == 1 {
+		if n.left, err = readBinaryNode(dec, n, remaining, depth-1); err != nil {
+			return nil, err
+		}
+	}
+	if flags[2] == 1 {
+		if n.right, err = readBinaryNode(dec, n, remaining, depth-1); err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+// ReadFrom replaces the contents of the tree with the binary data in r. The
+// tree is left unchanged if the data cannot be decoded or does not describe a
+// valid red-black tree.
+func (t *Tree) ReadFrom(r io.Reader) (int64, error) {
+	dec := persist.NewDecoder(r, t.decodeOpts)
+	if _, err := dec.ExpectHeader(t.header()); err != nil {
+		return dec.Offset(), err
+	}
+	return t.readBinary(dec)
+}
+
+// ReadLegacyFrom is like ReadFrom but reads the headerless format written
+// before the container header was introduced.
+func (t *Tree) ReadLegacyFrom(r io.Reader) (int64, error) {
+	return t.readBinary(persist.NewDecoder(r, t.decodeOpts))
+}
+
+// header describes the binary format written by WriteTo.
+func (t *Tree) header() persist.Header {
+	return persist.Header{Type: persist.TypeRedBlack, Key: persist.EncodingInt64, Value: persist.EncodingString64, Flags: t.encodeOpts.Flags()}
+}
+
+// SetEncodeOptions changes the optional parts of the binary format written by
+// WriteTo and WriteBinary. Its Compression also applies to WriteTextTo and
+// WriteText; readers detect compressed files on their own.
+func (t *Tree) SetEncodeOptions(opts persist.EncodeOptions) {
+	t.encodeOpts = opts
+}
+
+// SetDecodeOptions changes the resource limits enforced by every Read*
+// method. Input that goes over a limit fails with persist.ErrLimitExceeded.
+func (t *Tree) SetDecodeOptions(opts persist.DecodeOptions) {
+	t.decodeOpts = opts
+}
+
+func (t *Tree) readBinary(dec *persist.Decoder) (int64, error) {
+	size, err := dec.Uint64()
+	if err != nil {
+		return dec.Offset(), fmt.Errorf("failed to read size: %w", err)
+	}
+	if err := dec.CheckElements(size); err != nil {
+		return dec.Offset(), err
+	}
+
+	var root *RBTNode
+	if size > 0 {
+		remaining := size
+		if root, err = readBinaryNode(dec, nil, &remaining, maxDepth(size)); err != nil {
+			return dec.Offset(), err
+		}
+	}
+	if err := dec.Finish(); err != nil {
+		return dec.Offset(), err
+	}
+	return dec.Offset(), t.load(root, size)
+}
+
+// load installs a decoded tree after making sure it is a valid red-black tree.
+func (t *Tree) load(root *RBTNode, size uint64) error {
+	candidate := &Tree{root: root, size: int(size)}
+	count, err := candidate.validate()
+	if err != nil {
+		return fmt.Errorf("invalid tree in file: %w", err)
+	}
+	if uint64(count) != size {
+		return fmt.Errorf("tree in file has %d nodes, header says %d", count, size)
+	}
+	t.root = root
+	t.size = count
+	t.version++
+	return nil
+}
+
+// checkCpp reports an error unless every node of the tree can be stored by
+// the C++ RBTree, which has int32 keys and no values.
+func (t *Tree) checkCpp() error {
+	for key, value := range t.All() {
+		if key != int(int32(key)) {
+			return fmt.Errorf("redblack: key %d does not fit the C++ format's 32-bit keys", key)
+		}
+		if value != "" {
+			return fmt.Errorf("redblack: the C++ format cannot store the value of key %d", key)
+		}
+	}
+	return nil
+}
+
+// writeCppNode writes n the way RBTree::writeBinaryNode does: the key and
+// color, then each child flag directly followed by that child's subtree.
+func writeCppNode(enc *persist.Encoder, n *RBTNode) error {
+	if err := enc.Uint32(uint32(int32(n.key))); err != nil {
+		return err
+	}
+	if err := enc.Uint8(boolByte(n.color)); err != nil {
+		return err
+	}
+	for _, child := range []*RBTNode{n.left, n.right} {
+		if err := enc.Uint8(boolByte(child != nil)); err != nil {
+			return err
+		}
+		if child != nil {
+			if err := writeCppNode(enc, child); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WriteCppTo writes the tree in the layout of the C++ RBTree::writeBinary:
+// an int32 node count followed by the nodes in pre-order. The C++ tree has
+// no values, so every value must be empty and every key must fit in 32
+// bits.
+func (t *Tree) WriteCppTo(w io.Writer) (int64, error) {
+	if err := t.checkCpp(); err != nil {
+		return 0, err
+	}
+	enc := persist.NewEncoder(w)
+	if err := enc.Uint32(uint32(t.size)); err != nil {
+		return enc.Len(), err
+	}
+	if t.root != nil {
+		if err := writeCppNode(enc, t.root); err != nil {
+			return enc.Len(), err
+		}
+	}
+	err := enc.Flush()
+	return enc.Len(), err
+}
+
+// readCppNode reads the subtree written by writeCppNode, descending at most
+// depth levels like readBinaryNode.
+func readCppNode(dec *persist.Decoder, parent *RBTNode, remaining *uint64, depth int) (*RBTNode, error) {
+	if *remaining == 0 {
+		return nil, errors.New("more nodes in file than declared")
+	}
+	if depth == 0 {
+		return nil, &persist.CorruptionError{Offset: dec.Offset(), Err: errTooDeep}
+	}
+	*remaining--
+
+	key, err := dec.Uint32()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %w", err)
+	}
+	color, err := dec.Uint8()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read color: %w", err)
+	}
+
+	n := &RBTNode{key: int(int32(key)), parent: parent, color: color == 1}
+	for _, child := range []**RBTNode{&n.left, &n.right} {
+		hasChild, err := dec.Uint8()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read child flag: %w", err)
+		}
+		if hasChild == 1 {
+			if *child, err = readCppNode(dec, n, remaining, depth-1); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// ReadCppFrom replaces the contents of the tree with a file written by the
+// C++ RBTree::writeBinary. The loaded keys all have empty values.
+func (t *Tree) ReadCppFrom(r io.Reader) (int64, error) {
+	dec := persist.NewDecoder(r, t.decodeOpts)
+	rawSize, err := dec.Uint32()
+	if err != nil {
+		return dec.Offset(), fmt.Errorf("failed to read size: %w", err)
+	}
+	size := int32(rawSize)
+	if size < 0 {
+		return dec.Offset(), fmt.Errorf("invalid size %d", size)
+	}
+	if err := dec.CheckElements(uint64(size)); err != nil {
+		return dec.Offset(), err
+	}
+
+	var root *RBTNode
+	if size > 0 {
+		remaining := uint64(size)
+		if root, err = readCppNode(dec, nil, &remaining, maxDepth(uint64(size))); err != nil {
+			return dec.Offset(), err
+		}
+	}
+	return dec.Offset(), t.load(root, uint64(size))
+}
+
+func (t *Tree) MarshalBinary() ([]byte, error) {
+	return persist.MarshalBinary(t.WriteTo)
+}
+
+func (t *Tree) UnmarshalBinary(data []byte) error {
+	return persist.UnmarshalBinary(data, t.ReadFrom)
+}
+
+// MarshalJSON encodes the tree as a JSON object mapping each key, written as
+// a decimal string, to its value.
+func (t *Tree) MarshalJSON() ([]byte, error) {
+	pairs := make(map[int]string, t.size)
+	for key, value := range t.All() {
+		pairs[key] = value
+	}
+	return json.Marshal(pairs)
+}
+
+// UnmarshalJSON replaces the contents of the tree with the members of a JSON
+// object whose keys are decimal integers.
+func (t *Tree) UnmarshalJSON(data []byte) error {
+	var pairs map[int]string
+	if err := json.Unmarshal(data, &pairs); err != nil {
+		return err
+	}
+
+	loaded := NewTree()
+	for key, value := range pairs {
+		loaded.Insert(key, value)
+	}
+	t.root = loaded.root
+	t.size = loaded.size
+	t.version++
+	return nil
+}
+
+func (t *Tree) WriteBinary(filename string) error {
+	return persist.WriteFile(filename, t.WriteTo)
+}
+
+func (t *Tree) ReadBinary(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	_, err = t.ReadFrom(bufio.NewReader(file))
+	return err
+}
+
+// ReadBinaryLegacy reads a file written before the container header was
+// introduced.
+func (t *Tree) ReadBinaryLegacy(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	_, err = t.ReadLegacyFrom(bufio.NewReader(file))
+	return err
+}
+
+// writeTextNode writes the subtree at n in pre-order. The C++ format has no
+// value field.
+func writeTextNode(w io.Writer, n *RBTNode, cpp bool) error {
+	line := fmt.Sprintf("%d %d %d %d", n.key, boolByte(n.color), boolByte(n.left != nil), boolByte(n.right != nil))
+	if !cpp {
+		line += " " + persist.QuoteLine(n.value)
+	}
+	if _, err := fmt.Fprintln(w, line); err != nil {
+		return err
+	}
+	if n.left != nil {
+		if err := writeTextNode(w, n.left, cpp); err != nil {
+			return err
+		}
+	}
+	if n.right != nil {
+		if err := writeTextNode(w, n.right, cpp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteTextTo writes the size and then one "key color left right value" line
+// per node in pre-order. Values are quoted with persist.QuoteLine when they
+// cannot be written verbatim.
+func (t *Tree) WriteTextTo(w io.Writer) (int64, error) {
+	enc := persist.NewEncoder(w)
+	if err := enc.CompressText(t.encodeOpts); err != nil {
+		return enc.Len(), err
+	}
+	return t.writeText(enc, false)
+}
+
+// WriteCppTextTo writes the tree in the format of the C++ RBTree::writeText,
+// whose "key color left right" lines have no value. It has the same
+// restrictions as WriteCppTo.
+func (t *Tree) WriteCppTextTo(w io.Writer) (int64, error) {
+	if err := t.checkCpp(); err != nil {
+		return 0, err
+	}
+	return t.writeText(persist.NewEncoder(w), true)
+}
+
+func (t *Tree) writeText(enc *persist.Encoder, cpp bool) (int64, error) {
+	if _, err := fmt.Fprintf(enc, "%d\n", t.size); err != nil {
+		return enc.Len(), err
+	}
+	if t.root != nil {
+		if err := writeTextNode(enc, t.root, cpp); err != nil {
+			return enc.Len(), err
+		}
+	}
+	err := enc.Finish()
+	return enc.Len(), err
+}
+
+// readTextNode reads the subtree written by writeTextNode, descending at
+// most depth levels like readBinaryNode. Running out of depth returns
+// errTooDeep for readText to turn into a CorruptionError.
+func readTextNode(lines *persist.LineReader, parent *RBTNode, remaining *int, depth int, cpp bool) (*RBTNode, error) {
+	if *remaining == 0 {
+		return nil, errors.New("more nodes in file than declared")
+	}
+	if depth == 0 {
+		return nil, errTooDeep
+	}
+	*remaining--
+
+	if !lines.Scan() {
+		return nil, persist.ScanFailure(lines, errors.New("unexpected end of file"))
+	}
+	fields, want := strings.SplitN(lines.Text(), " ", 5), 5
+	if cpp {
+		fields, want = strings.Fields(lines.Text()), 4
+	}
+	if len(fields) != want {
+		return nil, fmt.Errorf("invalid node line: %q", lines.Text())
+	}
+	key, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid key: %w", err)
+	}
+
+	var value string
+	if !cpp {
+		if value, err = persist.UnquoteLine(fields[4]); err != nil {
+			return nil, fmt.Errorf("invalid value: %w", err)
+		}
+	}
+
+	n := &RBTNode{key: key, value: value, parent: parent, color: fields[1] == "1"}
+	if fields[2] == "1" {
+		if n.left, err = readTextNode(lines, n, remaining, depth-1, cpp); err != nil {
+			return nil, err
+		}
+	}
+	if fields[3] == "1" {
+		if n.right, err = readTextNode(lines, n, remaining, depth-1, cpp); err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+// ReadTextFrom replaces the contents of the tree with the text data in r.
+func (t *Tree) ReadTextFrom(r io.Reader) (int64, error) {
+	dec := persist.NewDecoder(r, t.decodeOpts)
+	if err := dec.DetectCompression(); err != nil {
+		return dec.Offset(), err
+	}
+	return t.readText(dec, false)
+}
+
+// ReadCppTextFrom replaces the contents of the tree with a file written by
+// the C++ RBTree::writeText. The loaded keys all have empty values.
+func (t *Tree) ReadCppTextFrom(r io.Reader) (int64, error) {
+	return t.readText(persist.NewDecoder(r, t.decodeOpts), true)
+}
+
+func (t *Tree) readText(dec *persist.Decoder, cpp bool) (int64, error) {
+	lines := persist.NewLineReader(dec)
+	if !lines.Scan() {
+		return dec.Offset(), persist.ScanFailure(lines, errors.New("file is empty"))
+	}
+	size, err := dec.ParseCount(lines.Text())
+	if err != nil {
+		return dec.Offset(), err
+	}
+
+	var root *RBTNode
+	if size > 0 {
+		remaining := size
+		if root, err = readTextNode(lines, nil, &remaining, maxDepth(uint64(size)), cpp); err != nil {
+			if errors.Is(err, errTooDeep) {
+				err = &persist.CorruptionError{Offset: dec.Offset(), Err: err}
+			}
+			return dec.Offset(), persist.ScanFailure(lines, err)
+		}
+	}
+	if err := dec.FinishText(lines); err != nil {
+		return dec.Offset(), fmt.Errorf("error reading file: %w", err)
+	}
+	return dec.Offset(), t.load(root, uint64(size))
+}
+
+func (t *Tree) WriteText(filename string) error {
+	return persist.WriteFile(filename, t.WriteTextTo)
+}
+
+func (t *Tree) ReadText(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	_, err = t.ReadTextFrom(file)
+	return err
+}
@@ -0,0 +1,720 @@
+package redblack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"Go/persist"
+	"Go/persist/persisttest"
+)
+
+func captureOutput(f func()) string {
+	old := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+	defer func() {
+		os.Stdout = old
+	}()
+
+	f()
+	w.Close()
+
+	var buf bytes.Buffer
+	buf.ReadFrom(r)
+	return buf.String()
+}
+
+func assertValid(t *testing.T, tree *Tree) {
+	t.Helper()
+	count, err := tree.validate()
+	if err != nil {
+		t.Fatalf("tree invariants broken: %v", err)
+	}
+	if count != tree.size {
+		t.Fatalf("tree holds %d nodes, size = %d", count, tree.size)
+	}
+}
+
+func TestConstructor(t *testing.T) {
+	tree := NewTree()
+	if tree.root != nil {
+		t.Errorf("NewTree() root = %v, want nil", tree.root)
+	}
+	if tree.Size() != 0 || !tree.IsEmpty() {
+		t.Errorf("NewTree() size = %d, want 0", tree.Size())
+	}
+}
+
+func TestInsertAndGet(t *testing.T) {
+	t.Run("Ascending", func(t *testing.T) {
+		tree := NewTree()
+		for i := 0; i < 100; i++ {
+			tree.Insert(i, strconv.Itoa(i))
+			assertValid(t, tree)
+		}
+		if tree.Size() != 100 {
+			t.Errorf("Size() = %d, want 100", tree.Size())
+		}
+		for i := 0; i < 100; i++ {
+			value, err := tree.Get(i)
+			if err != nil {
+				t.Fatalf("Get(%d) failed: %v", i, err)
+			}
+			if value != strconv.Itoa(i) {
+				t.Errorf("Get(%d) = %q, want %q", i, value, strconv.Itoa(i))
+			}
+		}
+	})
+
+	t.Run("Descending", func(t *testing.T) {
+		tree := NewTree()
+		for i := 100; i > 0; i-- {
+			tree.Insert(i, "v")
+			assertValid(t, tree)
+		}
+		if tree.Size() != 100 {
+			t.Errorf("Size() = %d, want 100", tree.Size())
+		}
+	})
+
+	t.Run("UpdateExisting", func(t *testing.T) {
+		tree := NewTree()
+		tree.Insert(5, "old")
+		tree.Insert(5, "new")
+		if tree.Size() != 1 {
+			t.Errorf("Size() after update = %d, want 1", tree.Size())
+		}
+		value, _ := tree.Get(5)
+		if value != "new" {
+			t.Errorf("Get(5) = %q, want %q", value, "new")
+		}
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		tree := NewTree()
+		if _, err := tree.Get(1); err == nil {
+			t.Error("Get() on empty tree returned nil error")
+		}
+		tree.Insert(2, "two")
+		if _, err := tree.Get(1); err == nil {
+			t.Error("Get(1) returned nil error for missing key")
+		}
+		if tree.Contains(1) || !tree.Contains(2) {
+			t.Error("Contains() reports wrong membership")
+		}
+	})
+}
+
+func TestDelete(t *testing.T) {
+	t.Run("Errors", func(t *testing.T) {
+		tree := NewTree()
+		if err := tree.Delete(1); err == nil {
+			t.Error("Delete() on empty tree returned nil error")
+		}
+		tree.Insert(1, "one")
+		if err := tree.Delete(2); err == nil {
+			t.Error("Delete() of missing key returned nil error")
+		}
+	})
+
+	t.Run("AllShapes", func(t *testing.T) {
+		tree := NewTree()
+		for i := 0; i < 64; i++ {
+			tree.Insert(i, "")
+		}
+		for _, key := range []int{31, 0, 63, 15, 47, 1, 62, 32} {
+			if err := tree.Delete(key); err != nil {
+				t.Fatalf("Delete(%d) failed: %v", key, err)
+			}
+			assertValid(t, tree)
+			if tree.Contains(key) {
+				t.Errorf("Contains(%d) = true after delete", key)
+			}
+		}
+		if tree.Size() != 56 {
+			t.Errorf("Size() = %d, want 56", tree.Size())
+		}
+	})
+
+	t.Run("Randomized", func(t *testing.T) {
+		rng := rand.New(rand.NewSource(1))
+		tree := NewTree()
+		reference := map[int]string{}
+		for i := 0; i < 5000; i++ {
+			key := rng.Intn(500)
+			if rng.Intn(3) == 0 {
+				err := tree.Delete(key)
+				_, present := reference[key]
+				if (err == nil) != present {
+					t.Fatalf("Delete(%d) error = %v, present = %v", key, err, present)
+				}
+				delete(reference, key)
+			} else {
+				value := strconv.Itoa(rng.Int())
+				tree.Insert(key, value)
+				reference[key] = value
+			}
+			if i%250 == 0 {
+				assertValid(t, tree)
+			}
+		}
+		assertValid(t, tree)
+
+		keys := make([]int, 0, len(reference))
+		for key := range reference {
+			keys = append(keys, key)
+		}
+		sort.Ints(keys)
+		if !reflect.DeepEqual(tree.Keys(), keys) {
+			t.Errorf("Keys() = %v, want %v", tree.Keys(), keys)
+		}
+	})
+
+	t.Run("ToEmpty", func(t *testing.T) {
+		tree := NewTree()
+		for i := 0; i < 20; i++ {
+			tree.Insert(i, "")
+		}
+		for i := 19; i >= 0; i-- {
+			if err := tree.Delete(i); err != nil {
+				t.Fatalf("Delete(%d) failed: %v", i, err)
+			}
+			assertValid(t, tree)
+		}
+		if !tree.IsEmpty() || tree.root != nil {
+			t.Error("tree not empty after deleting every key")
+		}
+	})
+}
+
+func TestOrderedQueries(t *testing.T) {
+	tree := NewTree()
+
+	if _, _, err := tree.Min(); err == nil {
+		t.Error("Min() on empty tree returned nil error")
+	}
+	if _, _, err := tree.Max(); err == nil {
+		t.Error("Max() on empty tree returned nil error")
+	}
+
+	for _, key := range []int{50, 20, 80, 10, 30, 70, 90} {
+		tree.Insert(key, "v"+strconv.Itoa(key))
+	}
+
+	key, value, err := tree.Min()
+	if err != nil || key != 10 || value != "v10" {
+		t.Errorf("Min() = %d, %q, %v; want 10, v10, nil", key, value, err)
+	}
+	key, value, err = tree.Max()
+	if err != nil || key != 90 || value != "v90" {
+		t.Errorf("Max() = %d, %q, %v; want 90, v90, nil", key, value, err)
+	}
+
+	tests := []struct {
+		name      string
+		key       int
+		floor     int
+		floorOK   bool
+		ceiling   int
+		ceilingOK bool
+	}{
+		{"Exact", 30, 30, true, 30, true},
+		{"Between", 55, 50, true, 70, true},
+		{"BelowMin", 5, 0, false, 10, true},
+		{"AboveMax", 95, 90, true, 0, false},
+		{"LeftSubtree", 25, 20, true, 30, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, value, err := tree.Floor(tt.key)
+			if (err == nil) != tt.floorOK {
+				t.Fatalf("Floor(%d) error = %v, want ok %v", tt.key, err, tt.floorOK)
+			}
+			if tt.floorOK && (key != tt.floor || value != "v"+strconv.Itoa(tt.floor)) {
+				t.Errorf("Floor(%d) = %d, %q; want %d", tt.key, key, value, tt.floor)
+			}
+
+			key, value, err = tree.Ceiling(tt.key)
+			if (err == nil) != tt.ceilingOK {
+				t.Fatalf("Ceiling(%d) error = %v, want ok %v", tt.key, err, tt.ceilingOK)
+			}
+			if tt.ceilingOK && (key != tt.ceiling || value != "v"+strconv.Itoa(tt.ceiling)) {
+				t.Errorf("Ceiling(%d) = %d, %q; want %d", tt.key, key, value, tt.ceiling)
+			}
+		})
+	}
+}
+
+func TestInOrder(t *testing.T) {
+	tree := NewTree()
+	for _, key := range []int{5, 3, 8, 1, 4, 7, 9} {
+		tree.Insert(key, strconv.Itoa(key*10))
+	}
+
+	var keys []int
+	var values []string
+	tree.InOrder(func(key int, value string) bool {
+		keys = append(keys, key)
+		values = append(values, value)
+		return true
+	})
+	if !reflect.DeepEqual(keys, []int{1, 3, 4, 5, 7, 8, 9}) {
+		t.Errorf("InOrder keys = %v", keys)
+	}
+	if !reflect.DeepEqual(values, []string{"10", "30", "40", "50", "70", "80", "90"}) {
+		t.Errorf("InOrder values = %v", values)
+	}
+
+	var visited []int
+	tree.InOrder(func(key int, _ string) bool {
+		visited = append(visited, key)
+		return key < 4
+	})
+	if !reflect.DeepEqual(visited, []int{1, 3, 4}) {
+		t.Errorf("InOrder with early stop visited %v, want [1 3 4]", visited)
+	}
+}
+
+func TestClear(t *testing.T) {
+	tree := NewTree()
+	tree.Insert(1, "a")
+	tree.Insert(2, "b")
+	tree.Clear()
+	if !tree.IsEmpty() || tree.root != nil {
+		t.Error("Clear() left elements in the tree")
+	}
+}
+
+func TestPrint(t *testing.T) {
+	tree := NewTree()
+	output := captureOutput(tree.Print)
+	if output != "Дерево пустое\n" {
+		t.Errorf("Print() on empty tree = %q", output)
+	}
+
+	tree.Insert(2, "b")
+	tree.Insert(1, "a")
+	output = captureOutput(tree.Print)
+	if output != "In-order обход: 1:a(R) 2:b(B) \n" {
+		t.Errorf("Print() = %q", output)
+	}
+}
+
+func buildTree(n int) *Tree {
+	tree := NewTree()
+	for i := 0; i < n; i++ {
+		tree.Insert(i*7%n, "value "+strconv.Itoa(i))
+	}
+	return tree
+}
+
+func assertSameTree(t *testing.T, got, want *Tree) {
+	t.Helper()
+	assertValid(t, got)
+	if got.Size() != want.Size() {
+		t.Fatalf("size = %d, want %d", got.Size(), want.Size())
+	}
+	var walk func(a, b *RBTNode)
+	walk = func(a, b *RBTNode) {
+		if (a == nil) != (b == nil) {
+			t.Fatalf("tree shapes differ")
+		}
+		if a == nil {
+			return
+		}
+		if a.key != b.key || a.value != b.value || a.color != b.color {
+			t.Fatalf("node (%d, %q, %v) != (%d, %q, %v)", a.key, a.value, a.color, b.key, b.value, b.color)
+		}
+		if a.left != nil && a.left.parent != a || a.right != nil && a.right.parent != a {
+			t.Fatalf("parent links broken under %d", a.key)
+		}
+		walk(a.left, b.left)
+		walk(a.right, b.right)
+	}
+	walk(got.root, want.root)
+}
+
+func TestFileOperations(t *testing.T) {
+	tempDir := t.TempDir()
+
+	t.Run("BinaryRoundTrip", func(t *testing.T) {
+		for _, n := range []int{0, 1, 2, 33} {
+			filename := filepath.Join(tempDir, "tree"+strconv.Itoa(n)+".bin")
+			original := buildTree(n)
+			if n > 0 {
+				original.Insert(-5, "with spaces\tand tabs")
+			}
+			if err := original.WriteBinary(filename); err != nil {
+				t.Fatalf("WriteBinary() failed: %v", err)
+			}
+
+			loaded := NewTree()
+			loaded.Insert(100, "stale")
+			if err := loaded.ReadBinary(filename); err != nil {
+				t.Fatalf("ReadBinary() failed: %v", err)
+			}
+			assertSameTree(t, loaded, original)
+		}
+	})
+
+	t.Run("TextRoundTrip", func(t *testing.T) {
+		for _, n := range []int{0, 1, 2, 33} {
+			filename := filepath.Join(tempDir, "tree"+strconv.Itoa(n)+".txt")
+			original := buildTree(n)
+			if n > 0 {
+				original.Insert(-5, "with spaces")
+				original.Insert(-6, "")
+			}
+			if err := original.WriteText(filename); err != nil {
+				t.Fatalf("WriteText() failed: %v", err)
+			}
+
+			loaded := NewTree()
+			loaded.Insert(100, "stale")
+			if err := loaded.ReadText(filename); err != nil {
+				t.Fatalf("ReadText() failed: %v", err)
+			}
+			assertSameTree(t, loaded, original)
+		}
+	})
+
+	t.Run("TextLayout", func(t *testing.T) {
+		filename := filepath.Join(tempDir, "layout.txt")
+		tree := NewTree()
+		tree.Insert(2, "b")
+		tree.Insert(1, "a")
+		tree.Insert(3, "c")
+		if err := tree.WriteText(filename); err != nil {
+			t.Fatalf("WriteText() failed: %v", err)
+		}
+		content, _ := os.ReadFile(filename)
+		want := "3\n2 0 1 1 b\n1 1 0 0 a\n3 1 0 0 c\n"
+		if string(content) != want {
+			t.Errorf("WriteText() content = %q, want %q", content, want)
+		}
+	})
+
+	t.Run("MissingFiles", func(t *testing.T) {
+		tree := NewTree()
+		missing := filepath.Join(tempDir, "missing")
+		if err := tree.ReadBinary(missing); err == nil {
+			t.Error("ReadBinary() of missing file returned nil error")
+		}
+		if err := tree.ReadText(missing); err == nil {
+			t.Error("ReadText() of missing file returned nil error")
+		}
+		badPath := filepath.Join(tempDir, "no", "such", "dir")
+		if err := tree.WriteBinary(badPath); err == nil {
+			t.Error("WriteBinary() to bad path returned nil error")
+		}
+		if err := tree.WriteText(badPath); err == nil {
+			t.Error("WriteText() to bad path returned nil error")
+		}
+	})
+
+	t.Run("InvalidBinary", func(t *testing.T) {
+		node := func(key int64, color, hasLeft, hasRight uint8) []byte {
+			var buf bytes.Buffer
+			binary.Write(&buf, binary.LittleEndian, key)
+			binary.Write(&buf, binary.LittleEndian, uint64(0))
+			buf.Write([]byte{color, hasLeft, hasRight})
+			return buf.Bytes()
+		}
+		header := func(n uint64) []byte {
+			var buf bytes.Buffer
+			enc := persist.NewEncoder(&buf)
+			enc.WriteHeader(persist.Header{Type: persist.TypeRedBlack, Key: persist.EncodingInt64, Value: persist.EncodingString64})
+			enc.Uint64(n)
+			enc.Flush()
+			return buf.Bytes()
+		}
+		join := func(parts ...[]byte) []byte {
+			return bytes.Join(parts, nil)
+		}
+
+		tests := []struct {
+			name string
+			data []byte
+		}{
+			{"Empty", nil},
+			{"Truncated", join(header(1), node(1, 0, 0, 0)[:5])},
+			{"RedRoot", join(header(1), node(1, 1, 0, 0))},
+			{"BadOrder", join(header(2), node(5, 0, 1, 0), node(9, 1, 0, 0))},
+			{"RedRed", join(header(3), node(5, 0, 1, 0), node(3, 1, 1, 0), node(1, 1, 0, 0))},
+			{"BlackHeight", join(header(2), node(5, 0, 1, 0), node(3, 0, 0, 0))},
+			{"CountTooSmall", join(header(1), node(5, 0, 1, 0), node(3, 1, 0, 0))},
+			{"CountTooLarge", join(header(3), node(5, 0, 1, 0), node(3, 1, 0, 0))},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				filename := filepath.Join(tempDir, "invalid_"+tt.name+".bin")
+				os.WriteFile(filename, tt.data, 0644)
+				tree := NewTree()
+				if err := tree.ReadBinary(filename); err == nil {
+					t.Error("ReadBinary() returned nil error")
+				}
+			})
+		}
+
+		// Cut short in the node flags, after the key and value decoded.
+		short := join(header(1), node(1, 0, 0, 0)[:17])
+		var corruption *persist.CorruptionError
+		if _, err := NewTree().ReadFrom(bytes.NewReader(short)); !errors.As(err, &corruption) || !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("ReadFrom() of truncated node flags = %v, want a CorruptionError for io.ErrUnexpectedEOF", err)
+		}
+	})
+
+	t.Run("InvalidText", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			content string
+		}{
+			{"Empty", ""},
+			{"BadSize", "abc\n"},
+			{"NegativeSize", "-1\n"},
+			{"MissingNode", "1\n"},
+			{"ShortLine", "1\n5 0 0\n"},
+			{"BadKey", "1\nx 0 0 0 v\n"},
+			{"MissingChild", "2\n5 0 1 0 v\n"},
+			{"RedRoot", "1\n5 1 0 0 v\n"},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				filename := filepath.Join(tempDir, "invalid_"+tt.name+".txt")
+				os.WriteFile(filename, []byte(tt.content), 0644)
+				tree := NewTree()
+				err := tree.ReadText(filename)
+				if err == nil {
+					t.Error("ReadText() returned nil error")
+				}
+				if strings.TrimSpace(tt.content) == "" && err != nil && !strings.Contains(err.Error(), "empty") {
+					t.Errorf("ReadText() error = %v, want empty-file error", err)
+				}
+			})
+		}
+	})
+
+	t.Run("Degenerate", func(t *testing.T) {
+		// A chain of left children, far deeper than a red-black tree of
+		// its size can be.
+		const size = 100
+		var bin, cppBin bytes.Buffer
+		var text, cppText strings.Builder
+		enc := persist.NewEncoder(&bin)
+		enc.WriteHeader(persist.Header{Type: persist.TypeRedBlack, Key: persist.EncodingInt64, Value: persist.EncodingString64})
+		enc.Uint64(size)
+		cppEnc := persist.NewEncoder(&cppBin)
+		cppEnc.Uint32(size)
+		fmt.Fprintln(&text, size)
+		fmt.Fprintln(&cppText, size)
+		for key := size; key > 0; key-- {
+			hasLeft := boolByte(key > 1)
+			persist.Int.Encode(enc, key)
+			persist.String64.Encode(enc, "")
+			enc.Write([]byte{0, hasLeft, 0})
+			cppEnc.Uint32(uint32(key))
+			cppEnc.Write([]byte{0, hasLeft})
+			fmt.Fprintf(&text, "%d 0 %d 0 v\n", key, hasLeft)
+			fmt.Fprintf(&cppText, "%d 0 %d 0\n", key, hasLeft)
+		}
+		for key := 0; key < size; key++ {
+			cppEnc.Uint8(0) // the right child flags, innermost node first
+		}
+		enc.Flush()
+		cppEnc.Flush()
+
+		readers := map[string]func(*Tree) (int64, error){
+			"ReadFrom":        func(tree *Tree) (int64, error) { return tree.ReadFrom(bytes.NewReader(bin.Bytes())) },
+			"ReadCppFrom":     func(tree *Tree) (int64, error) { return tree.ReadCppFrom(bytes.NewReader(cppBin.Bytes())) },
+			"ReadTextFrom":    func(tree *Tree) (int64, error) { return tree.ReadTextFrom(strings.NewReader(text.String())) },
+			"ReadCppTextFrom": func(tree *Tree) (int64, error) { return tree.ReadCppTextFrom(strings.NewReader(cppText.String())) },
+		}
+		for name, read := range readers {
+			tree := NewTree()
+			tree.Insert(1, "kept")
+			var corruption *persist.CorruptionError
+			if _, err := read(tree); !errors.As(err, &corruption) || !errors.Is(err, errTooDeep) {
+				t.Errorf("%s() of a degenerate tree = %v, want a CorruptionError for its depth", name, err)
+			}
+			if value, err := tree.Get(1); err != nil || value != "kept" || tree.Size() != 1 {
+				t.Errorf("%s() failed but changed the tree", name)
+			}
+		}
+	})
+}
+
+func TestIterators(t *testing.T) {
+	tree := NewTree()
+	for _, key := range []int{5, 3, 8, 1, 4, 7, 9, 2, 6} {
+		tree.Insert(key, strconv.Itoa(key))
+	}
+
+	var keys []int
+	for key, value := range tree.All() {
+		if value != strconv.Itoa(key) {
+			t.Errorf("All() yielded %d => %q", key, value)
+		}
+		keys = append(keys, key)
+	}
+	if !reflect.DeepEqual(keys, []int{1, 2, 3, 4, 5, 6, 7, 8, 9}) {
+		t.Errorf("All() keys = %v", keys)
+	}
+
+	keys = nil
+	for key := range tree.Backward() {
+		keys = append(keys, key)
+		if key == 6 {
+			break
+		}
+	}
+	if !reflect.DeepEqual(keys, []int{9, 8, 7, 6}) {
+		t.Errorf("Backward() with break = %v", keys)
+	}
+
+	for range NewTree().All() {
+		t.Error("All() on empty tree yielded an entry")
+	}
+	for range NewTree().Backward() {
+		t.Error("Backward() on empty tree yielded an entry")
+	}
+
+	for key := range tree.All() {
+		tree.Insert(key, "updated")
+	}
+	if value, _ := tree.Get(3); value != "updated" {
+		t.Errorf("Get(3) after updating during iteration = %q", value)
+	}
+
+	mutations := map[string]func(){
+		"Insert": func() { tree.Insert(100, "x") },
+		"Delete": func() { tree.Delete(100) },
+		"Clear":  func() { tree.Clear() },
+	}
+	for _, name := range []string{"Insert", "Delete", "Clear"} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s during iteration did not panic", name)
+				}
+			}()
+			for range tree.All() {
+				mutations[name]()
+			}
+		})
+	}
+}
+
+func TestReaderWriter(t *testing.T) {
+	persisttest.TestContainer(t, persisttest.Fixture[*Tree]{
+		New: NewTree,
+		Make: func(values []string) *Tree {
+			tree := NewTree()
+			for i, v := range values {
+				tree.Insert(i*10, v)
+			}
+			return tree
+		},
+		Contents: func(tree *Tree) any { return maps.Collect(tree.All()) },
+	})
+}
+
+func TestJSON(t *testing.T) {
+	tree := buildTree(20)
+	tree.Insert(-5, "negative")
+	data, err := json.Marshal(tree)
+	if err != nil {
+		t.Fatalf("json.Marshal() failed: %v", err)
+	}
+	if !strings.Contains(string(data), `"-5":"negative"`) {
+		t.Errorf("json.Marshal() = %s", data)
+	}
+
+	loaded := NewTree()
+	if err := json.Unmarshal(data, loaded); err != nil {
+		t.Fatalf("json.Unmarshal() failed: %v", err)
+	}
+	assertValid(t, loaded)
+	if got, want := maps.Collect(loaded.All()), maps.Collect(tree.All()); !reflect.DeepEqual(got, want) {
+		t.Errorf("json.Unmarshal() loaded %v, want %v", got, want)
+	}
+
+	if err := json.Unmarshal([]byte(`{"x":"y"}`), loaded); err == nil {
+		t.Error("json.Unmarshal() with a non-integer key returned nil error")
+	}
+	if loaded.Size() != 21 {
+		t.Errorf("failed json.Unmarshal() changed the size to %d", loaded.Size())
+	}
+}
+
+// TestCppGolden checks the C++ formats against files written by the C++
+// RBTree; see Serialization/C++/Golden. Both trees insert the same way, so
+// the same keys produce the same shape.
+func TestCppGolden(t *testing.T) {
+	keys := []int{50, 20, 80, 10, 30, 70, 90, 25, 35, -5}
+	want := make(map[int]string)
+	original := NewTree()
+	for _, key := range keys {
+		original.Insert(key, "")
+		want[key] = ""
+	}
+
+	tests := []struct {
+		file  string
+		write func(*Tree, io.Writer) (int64, error)
+		read  func(*Tree, io.Reader) (int64, error)
+	}{
+		{"redblack.bin", (*Tree).WriteCppTo, (*Tree).ReadCppFrom},
+		{"redblack.txt", (*Tree).WriteCppTextTo, (*Tree).ReadCppTextFrom},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			golden, err := os.ReadFile(filepath.Join("testdata", "cpp", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			loaded := NewTree()
+			if _, err := tt.read(loaded, bytes.NewReader(golden)); err != nil {
+				t.Fatalf("reading the C++ file failed: %v", err)
+			}
+			if got := maps.Collect(loaded.All()); !reflect.DeepEqual(got, want) {
+				t.Errorf("read %v, want %v", got, want)
+			}
+
+			var buf bytes.Buffer
+			if _, err := tt.write(original, &buf); err != nil {
+				t.Fatalf("writing the C++ format failed: %v", err)
+			}
+			if !bytes.Equal(buf.Bytes(), golden) {
+				t.Errorf("wrote\n%q\nwant\n%q", buf.Bytes(), golden)
+			}
+		})
+	}
+
+	withValue := NewTree()
+	withValue.Insert(1, "x")
+	if _, err := withValue.WriteCppTo(io.Discard); err == nil {
+		t.Error("WriteCppTo() of a tree with values succeeded")
+	}
+	wideKey := NewTree()
+	wideKey.Insert(1<<40, "")
+	if _, err := wideKey.WriteCppTextTo(io.Discard); err == nil {
+		t.Error("WriteCppTextTo() of a 64-bit key succeeded")
+	}
+}
@@ -0,0 +1,146 @@
+package stack
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// OverflowPolicy decides what Push does when the stack holds its capacity.
+type OverflowPolicy int
+
+const (
+	// OverflowError makes Push fail with ErrFull and leaves the stack
+	// unchanged.
+	OverflowError OverflowPolicy = iota
+	// OverflowDropOldest removes the bottom element to make room. The
+	// bottom is found by walking the stack, so such a Push takes time
+	// linear in the capacity.
+	OverflowDropOldest
+	// OverflowDropNewest discards the pushed element and reports success.
+	OverflowDropNewest
+	// OverflowGrow doubles the capacity.
+	OverflowGrow
+)
+
+var overflowNames = map[OverflowPolicy]string{
+	OverflowError:      "error",
+	OverflowDropOldest: "drop-oldest",
+	OverflowDropNewest: "drop-newest",
+	OverflowGrow:       "grow",
+}
+
+func (p OverflowPolicy) String() string {
+	if name, ok := overflowNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("OverflowPolicy(%d)", int(p))
+}
+
+// Option configures a Stack created by NewStack.
+type Option func(*Stack)
+
+// WithCapacity limits the stack to capacity elements instead of MAX_SIZE. It
+// panics if capacity is less than 1.
+func WithCapacity(capacity int) Option {
+	if capacity < 1 {
+		panic(fmt.Sprintf("stack: invalid capacity %d", capacity))
+	}
+	return func(s *Stack) {
+		s.maxSize = capacity
+	}
+}
+
+// Unbounded removes the limit on the number of elements.
+func Unbounded() Option {
+	return func(s *Stack) {
+		s.maxSize = 0
+	}
+}
+
+// WithOverflow selects what Push does when the stack is full. The default is
+// OverflowError.
+func WithOverflow(policy OverflowPolicy) Option {
+	if _, ok := overflowNames[policy]; !ok {
+		panic(fmt.Sprintf("stack: invalid overflow policy %d", int(policy)))
+	}
+	return func(s *Stack) {
+		s.overflow = policy
+	}
+}
+
+// Capacity returns the number of elements the stack holds before its
+// overflow policy applies, or 0 if it is unbounded.
+func (s *Stack) Capacity() int {
+	return s.maxSize
+}
+
+// Overflow returns the overflow policy of the stack.
+func (s *Stack) Overflow() OverflowPolicy {
+	return s.overflow
+}
+
+// full reports whether one more element would go over the capacity.
+func (s *Stack) full() bool {
+	return s.maxSize != 0 && s.size >= s.maxSize
+}
+
+// dropBottom removes the element at the bottom of the stack.
+func (s *Stack) dropBottom() {
+	if s.size == 1 {
+		s.head = nil
+	} else {
+		current := s.head
+		for current.next.next != nil {
+			current = current.next
+		}
+		current.next = nil
+	}
+	s.size--
+}
+
+// fitCapacity returns the capacity of a stack of size elements loaded from
+// input that does not record one: the capacity of s, doubled as often as
+// needed if its overflow policy is OverflowGrow.
+func (s *Stack) fitCapacity(size int) (int, error) {
+	capacity := s.maxSize
+	if capacity != 0 && size > capacity {
+		if s.overflow != OverflowGrow {
+			return 0, errors.New("размер стека в файле превышает максимально допустимый")
+		}
+		capacity = grownCapacity(capacity, size)
+	}
+	return capacity, nil
+}
+
+// grownCapacity returns capacity doubled as few times as it takes to hold
+// size, which is larger, or math.MaxInt if that would overflow an int.
+func grownCapacity(capacity, size int) int {
+	shift := bits.Len(uint((size - 1) / capacity))
+	if capacity > math.MaxInt>>shift {
+		return math.MaxInt
+	}
+	return capacity << shift
+}
+
+// recordedCapacity checks the capacity recorded in a file that holds size
+// elements and returns it.
+func recordedCapacity(size int, recorded uint64) (int, error) {
+	if int64(recorded) < 0 {
+		return 0, fmt.Errorf("неверная ёмкость стека в файле: %d", int64(recorded))
+	}
+	if recorded == 0 {
+		return 0, nil
+	}
+	if uint64(size) > recorded {
+		return 0, errors.New("размер стека в файле превышает его ёмкость")
+	}
+	return int(recorded), nil
+}
+
+// emptyCopy returns an empty stack with the given capacity and the overflow
+// policy of s.
+func (s *Stack) emptyCopy(capacity int) *Stack {
+	return &Stack{maxSize: capacity, overflow: s.overflow}
+}
@@ -0,0 +1,179 @@
+package stack
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// pushAll pushes "0" to strconv.Itoa(n-1) and fails the test on any error.
+func pushAll(t *testing.T, s *Stack, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := s.Push(strconv.Itoa(i)); err != nil {
+			t.Fatalf("Push(%d) failed: %v", i, err)
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+	t.Run("Capacity", func(t *testing.T) {
+		if got := NewStack().Capacity(); got != MAX_SIZE {
+			t.Errorf("Capacity() = %d, want MAX_SIZE", got)
+		}
+		s := NewStack(WithCapacity(100))
+		pushAll(t, s, 100)
+		if err := s.Push("over"); !errors.Is(err, ErrFull) {
+			t.Errorf("Push() on a full stack = %v, want ErrFull", err)
+		}
+
+		unbounded := NewStack(Unbounded())
+		pushAll(t, unbounded, 1000)
+		if unbounded.Capacity() != 0 || unbounded.GetSize() != 1000 {
+			t.Errorf("unbounded stack: Capacity() = %d, GetSize() = %d", unbounded.Capacity(), unbounded.GetSize())
+		}
+	})
+
+	t.Run("Overflow", func(t *testing.T) {
+		tests := []struct {
+			policy   OverflowPolicy
+			want     []string
+			capacity int
+		}{
+			{OverflowDropOldest, []string{"4", "3", "2"}, 3},
+			{OverflowDropNewest, []string{"2", "1", "0"}, 3},
+			{OverflowGrow, []string{"4", "3", "2", "1", "0"}, 6},
+		}
+		for _, tt := range tests {
+			t.Run(tt.policy.String(), func(t *testing.T) {
+				s := NewStack(WithCapacity(3), WithOverflow(tt.policy))
+				pushAll(t, s, 5)
+				if got := slices.Collect(s.All()); !slices.Equal(got, tt.want) {
+					t.Errorf("stack holds %v, want %v", got, tt.want)
+				}
+				if s.GetSize() != len(tt.want) || s.Capacity() != tt.capacity {
+					t.Errorf("GetSize() = %d, Capacity() = %d, want %d, %d", s.GetSize(), s.Capacity(), len(tt.want), tt.capacity)
+				}
+			})
+		}
+
+		s := NewStack(WithCapacity(1), WithOverflow(OverflowDropOldest))
+		pushAll(t, s, 3)
+		if got := slices.Collect(s.All()); !slices.Equal(got, []string{"2"}) {
+			t.Errorf("stack of capacity 1 holds %v, want [2]", got)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for name, option := range map[string]func(){
+			"WithCapacity": func() { WithCapacity(0) },
+			"WithOverflow": func() { WithOverflow(OverflowPolicy(-1)) },
+		} {
+			func() {
+				defer func() {
+					if recover() == nil {
+						t.Errorf("invalid %s did not panic", name)
+					}
+				}()
+				option()
+			}()
+		}
+	})
+}
+
+func TestCapacityFiles(t *testing.T) {
+	big := NewStack(WithCapacity(50))
+	pushAll(t, big, 20)
+	want := slices.Collect(big.All())
+
+	formats := []struct {
+		name  string
+		write func(s *Stack, buf *bytes.Buffer) error
+		read  func(s *Stack, data []byte) error
+	}{
+		{
+			"Binary",
+			func(s *Stack, buf *bytes.Buffer) error { _, err := s.WriteTo(buf); return err },
+			func(s *Stack, data []byte) error { return s.UnmarshalBinary(data) },
+		},
+		{
+			"Text",
+			func(s *Stack, buf *bytes.Buffer) error { _, err := s.WriteTextTo(buf); return err },
+			func(s *Stack, data []byte) error { _, err := s.ReadTextFrom(bytes.NewReader(data)); return err },
+		},
+	}
+	for _, format := range formats {
+		t.Run(format.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := format.write(big, &buf); err != nil {
+				t.Fatalf("write failed: %v", err)
+			}
+
+			// A default stack could not hold the file, but takes over the
+			// capacity it records.
+			loaded := NewStack()
+			if err := format.read(loaded, buf.Bytes()); err != nil {
+				t.Fatalf("read failed: %v", err)
+			}
+			if got := slices.Collect(loaded.All()); !slices.Equal(got, want) {
+				t.Errorf("loaded %v, want %v", got, want)
+			}
+			if loaded.Capacity() != 50 {
+				t.Errorf("Capacity() = %d, want 50", loaded.Capacity())
+			}
+
+			buf.Reset()
+			if err := format.write(NewStack(Unbounded()), &buf); err != nil {
+				t.Fatalf("write failed: %v", err)
+			}
+			if err := format.read(loaded, buf.Bytes()); err != nil || loaded.Capacity() != 0 {
+				t.Errorf("reading an unbounded stack: Capacity() = %d, %v", loaded.Capacity(), err)
+			}
+		})
+	}
+
+	t.Run("SizeOverCapacity", func(t *testing.T) {
+		text := "3 2\na\nb\nc\n"
+		if _, err := NewStack().ReadTextFrom(strings.NewReader(text)); err == nil {
+			t.Error("ReadTextFrom() of more elements than the recorded capacity succeeded")
+		}
+	})
+
+	t.Run("WithoutCapacity", func(t *testing.T) {
+		// Files from before the capacity was recorded only fit a stack
+		// that may grow.
+		text := "12\n" + strings.Repeat("x\n", 12)
+		if _, err := NewStack().ReadTextFrom(strings.NewReader(text)); err == nil {
+			t.Error("ReadTextFrom() of 12 elements into a default stack succeeded")
+		}
+		s := NewStack(WithOverflow(OverflowGrow))
+		if _, err := s.ReadTextFrom(strings.NewReader(text)); err != nil {
+			t.Fatalf("ReadTextFrom() into a growing stack failed: %v", err)
+		}
+		if s.GetSize() != 12 || s.Capacity() != 2*MAX_SIZE {
+			t.Errorf("GetSize() = %d, Capacity() = %d, want 12, %d", s.GetSize(), s.Capacity(), 2*MAX_SIZE)
+		}
+	})
+}
+
+func TestGrownCapacity(t *testing.T) {
+	tests := []struct {
+		capacity, size, want int
+	}{
+		{10, 11, 20},
+		{10, 20, 20},
+		{10, 21, 40},
+		{1, 1 << 40, 1 << 40},
+		{3, 3<<61 + 1, math.MaxInt},
+		{1, math.MaxInt, math.MaxInt},
+	}
+	for _, tt := range tests {
+		if got := grownCapacity(tt.capacity, tt.size); got != tt.want {
+			t.Errorf("grownCapacity(%d, %d) = %d, want %d", tt.capacity, tt.size, got, tt.want)
+		}
+	}
+}
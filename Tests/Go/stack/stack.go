@@ -1,32 +1,55 @@
 package stack
 
 import (
-	"encoding/binary"
+	"bufio"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"bufio"
+	"iter"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
+
+	"Go/persist"
 )
 
 const MAX_SIZE = 10
 
+// ErrFull is returned by Push when the stack holds its capacity and the
+// overflow policy is OverflowError.
+var ErrFull = errors.New("stack overflow: maximum size reached")
+
 type SNode struct {
 	key  string
 	next *SNode
 }
 
 type Stack struct {
-	head *SNode
-	size int
+	head       *SNode
+	size       int
+	version    int
+	encodeOpts persist.EncodeOptions
+	decodeOpts persist.DecodeOptions
+
+	// maxSize is the capacity, or 0 for an unbounded stack.
+	maxSize  int
+	overflow OverflowPolicy
 }
 
-func NewStack() *Stack {
-	return &Stack{
-	 head: nil,
-	 size: 0,
+// NewStack creates an empty stack that holds up to MAX_SIZE elements and
+// rejects any more, unless opts say otherwise.
+func NewStack(opts ...Option) *Stack {
+	s := &Stack{
+		head:    nil,
+		size:    0,
+		maxSize: MAX_SIZE,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 func NewStackFromSlice(items ...string) *Stack {
@@ -37,9 +60,20 @@ func NewStackFromSlice(items ...string) *Stack {
 	return s
 }
 
+// Push adds data to the top of the stack. When the stack is full, the
+// overflow policy decides what happens.
 func (s *Stack) Push(data string) error {
-	if s.size >= MAX_SIZE {
-	 return errors.New("stack overflow: maximum size reached")
+	if s.full() {
+		switch s.overflow {
+		case OverflowDropOldest:
+			s.dropBottom()
+		case OverflowDropNewest:
+			return nil
+		case OverflowGrow:
+			s.maxSize *= 2
+		default:
+			return ErrFull
+		}
 	}
 	
 	newNode := &SNode{
@@ -48,6 +82,7 @@ func (s *Stack) Push(data string) error {
 	}
 	s.head = newNode
 	s.size++
+	s.version++
 	return nil
 }
 
@@ -59,6 +94,7 @@ func (s *Stack) Pop() (string, error) {
 	data := s.head.key
 	s.head = s.head.next
 	s.size--
+	s.version++
 	return data, nil
 }
 
@@ -70,83 +106,263 @@ func (s *Stack) GetSize() int {
 	return s.size
 }
 
-func (s *Stack) WriteBinary(filename string) error {
-	file, err := os.Create(filename)
-	if err != nil {
-	 return fmt.Errorf("не удалось открыть файл для записи: %s", filename)
+// WriteTo writes the stack in its binary format: the uint64 capacity, an
+// int32 size and the elements from the top of the stack to the bottom.
+func (s *Stack) WriteTo(w io.Writer) (int64, error) {
+	enc := persist.NewEncoder(w)
+	if err := enc.WriteHeader(s.header()); err != nil {
+		return enc.Len(), err
 	}
-	defer file.Close()
+	if err := enc.Uint64(uint64(s.maxSize)); err != nil {
+		return enc.Len(), err
+	}
+	return s.writeBinary(enc, persist.String)
+}
 
-	if err := binary.Write(file, binary.LittleEndian, int32(s.size)); err != nil {
-		return err
+// WriteCppTo writes the stack in the layout of the C++ Stack::writeBinary,
+// which differs from the legacy layout in prefixing every element with a
+// 64-bit length.
+func (s *Stack) WriteCppTo(w io.Writer) (int64, error) {
+	return s.writeBinary(persist.NewEncoder(w), persist.String64)
+}
+
+func (s *Stack) writeBinary(enc *persist.Encoder, keyCodec persist.Codec[string]) (int64, error) {
+	if err := enc.Uint32(uint32(int32(s.size))); err != nil {
+		return enc.Len(), err
 	}
 
 	current := s.head
 	for current != nil {
-	 keyBytes := []byte(current.key)
-	 if err := binary.Write(file, binary.LittleEndian, int32(len(keyBytes))); err != nil {
-	  return err
-	 }
-	 if _, err := file.Write(keyBytes); err != nil {
-	  return err
-	 }
-	 current = current.next
+		if err := keyCodec.Encode(enc, current.key); err != nil {
+			return enc.Len(), err
+		}
+		if err := enc.EndRecord(); err != nil {
+			return enc.Len(), err
+		}
+		current = current.next
 	}
-	
-	return nil
+
+	err := enc.Finish()
+	return enc.Len(), err
 }
 
-func (s *Stack) ReadBinary(filename string) error {
-	file, err := os.Open(filename)
+// ReadFrom replaces the contents of the stack with the binary data in r and
+// takes over the capacity recorded with them. Files written before the
+// capacity was recorded keep the capacity of the stack. The stack is left
+// unchanged if the data cannot be decoded.
+func (s *Stack) ReadFrom(r io.Reader) (int64, error) {
+	dec := persist.NewDecoder(r, s.decodeOpts)
+	h, err := dec.ExpectHeader(s.header())
 	if err != nil {
-	 return fmt.Errorf("не удалось открыть файл: %s", filename)
+		return dec.Offset(), err
 	}
-	defer file.Close()
+	return s.readBinary(dec, persist.String, h.Flags&persist.FlagCapacity != 0)
+}
 
-	s.Clear()
+// ReadLegacyFrom is like ReadFrom but reads the headerless format written
+// before the container header was introduced.
+func (s *Stack) ReadLegacyFrom(r io.Reader) (int64, error) {
+	return s.readBinary(persist.NewDecoder(r, s.decodeOpts), persist.String, false)
+}
 
-	var fileSize int32
-	if err := binary.Read(file, binary.LittleEndian, &fileSize); err != nil {
-	 return err
-	}
+// ReadCppFrom replaces the contents of the stack with a file written by the
+// C++ Stack::writeBinary.
+func (s *Stack) ReadCppFrom(r io.Reader) (int64, error) {
+	return s.readBinary(persist.NewDecoder(r, s.decodeOpts), persist.String64, false)
+}
 
-	if fileSize > MAX_SIZE {
-	 return errors.New("размер стека в файле превышает максимально допустимый")
+// header describes the binary format written by WriteTo.
+func (s *Stack) header() persist.Header {
+	return persist.Header{Type: persist.TypeStack, Value: persist.EncodingString32, Flags: s.encodeOpts.Flags() | persist.FlagCapacity}
+}
+
+// SetEncodeOptions changes the optional parts of the binary format written by
+// WriteTo and WriteBinary. Its Compression also applies to WriteTextTo and
+// WriteText; readers detect compressed files on their own.
+func (s *Stack) SetEncodeOptions(opts persist.EncodeOptions) {
+	s.encodeOpts = opts
+}
+
+// SetDecodeOptions changes the resource limits enforced by every Read*
+// method. Input that goes over a limit fails with persist.ErrLimitExceeded.
+func (s *Stack) SetDecodeOptions(opts persist.DecodeOptions) {
+	s.decodeOpts = opts
+}
+
+func (s *Stack) readBinary(dec *persist.Decoder, keyCodec persist.Codec[string], hasCapacity bool) (int64, error) {
+	var recorded uint64
+	if hasCapacity {
+		var err error
+		if recorded, err = dec.Uint64(); err != nil {
+			return dec.Offset(), err
+		}
+	}
+	rawSize, err := dec.Uint32()
+	if err != nil {
+		return dec.Offset(), err
 	}
 
-	tempArray := make([]string, fileSize)
-	
-	for i := int(fileSize) - 1; i >= 0; i-- {
-	 var keyLength int32
-	 if err := binary.Read(file, binary.LittleEndian, &keyLength); err != nil {
-	  return errors.New("ошибка чтения длины строки из файла")
-	 }
-	 
-	 keyBytes := make([]byte, keyLength)
-	 if _, err := io.ReadFull(file, keyBytes); err != nil {
-	  return errors.New("ошибка чтения строки из файла")
-	 }
-	 tempArray[i] = string(keyBytes)
+	fileSize := int32(rawSize)
+	if fileSize < 0 {
+		return dec.Offset(), errors.New("размер стека в файле превышает максимально допустимый")
+	}
+	if err := dec.CheckElements(uint64(fileSize)); err != nil {
+		return dec.Offset(), err
+	}
+	var capacity int
+	if hasCapacity {
+		capacity, err = recordedCapacity(int(fileSize), recorded)
+	} else {
+		capacity, err = s.fitCapacity(int(fileSize))
+	}
+	if err != nil {
+		return dec.Offset(), err
 	}
 
+	// The file lists the stack from the top down.
+	tempArray := make([]string, 0, min(int(fileSize), 1024))
 	for i := 0; i < int(fileSize); i++ {
-	 if err := s.Push(tempArray[i]); err != nil {
-	  return err
-	 }
+		key, err := keyCodec.Decode(dec)
+		if err != nil {
+			return dec.Offset(), fmt.Errorf("ошибка чтения строки из файла: %w", err)
+		}
+		if err := dec.EndRecord(); err != nil {
+			return dec.Offset(), err
+		}
+		tempArray = append(tempArray, key)
 	}
 
+	if err := dec.Finish(); err != nil {
+		return dec.Offset(), err
+	}
+
+	loaded := s.emptyCopy(capacity)
+	for _, key := range slices.Backward(tempArray) {
+		if err := loaded.Push(key); err != nil {
+			return dec.Offset(), err
+		}
+	}
+
+	s.replace(loaded)
+	return dec.Offset(), nil
+}
+
+func (s *Stack) replace(other *Stack) {
+	s.head = other.head
+	s.size = other.size
+	s.maxSize = other.maxSize
+	s.version++
+}
+
+func (s *Stack) MarshalBinary() ([]byte, error) {
+	return persist.MarshalBinary(s.WriteTo)
+}
+
+func (s *Stack) UnmarshalBinary(data []byte) error {
+	return persist.UnmarshalBinary(data, s.ReadFrom)
+}
+
+// MarshalJSON encodes the stack as a JSON array from the top of the stack to
+// the bottom, the order Pop returns them in. This is deliberately the reverse
+// of WriteTextTo, which lists elements from the bottom up so that a reader
+// can push them as they come.
+func (s *Stack) MarshalJSON() ([]byte, error) {
+	keys := make([]string, 0, s.size)
+	for key := range s.All() {
+		keys = append(keys, key)
+	}
+	return json.Marshal(keys)
+}
+
+// UnmarshalJSON replaces the contents of the stack with the strings of a JSON
+// array whose first element is the top of the stack.
+func (s *Stack) UnmarshalJSON(data []byte) error {
+	var keys []string
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return err
+	}
+	capacity, err := s.fitCapacity(len(keys))
+	if err != nil {
+		return errors.New("размер стека превышает максимально допустимый")
+	}
+
+	loaded := s.emptyCopy(capacity)
+	for i := len(keys) - 1; i >= 0; i-- {
+		if err := loaded.Push(keys[i]); err != nil {
+			return err
+		}
+	}
+	s.replace(loaded)
 	return nil
 }
 
-func (s *Stack) WriteText(filename string) error {
-	file, err := os.Create(filename)
+func (s *Stack) WriteBinary(filename string) error {
+	return persist.WriteFile(filename, s.WriteTo)
+}
+
+func (s *Stack) ReadBinary(filename string) error {
+	file, err := os.Open(filename)
 	if err != nil {
-		return fmt.Errorf("не удалось открыть файл для записи: %s", filename)
+	 return fmt.Errorf("не удалось открыть файл: %s", filename)
 	}
 	defer file.Close()
 
-	if _, err := file.WriteString(fmt.Sprintf("%d\n", s.size)); err != nil {
-		return err
+	_, err = s.ReadFrom(bufio.NewReader(file))
+	return err
+}
+
+// ReadBinaryLegacy reads a file written before the container header was
+// introduced.
+func (s *Stack) ReadBinaryLegacy(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+	 return fmt.Errorf("не удалось открыть файл: %s", filename)
+	}
+	defer file.Close()
+
+	_, err = s.ReadLegacyFrom(bufio.NewReader(file))
+	return err
+}
+
+// textLayout describes one of the text formats of a stack.
+type textLayout struct {
+	format persist.LineFormat
+	// topFirst lists the elements from the top of the stack to the bottom.
+	topFirst bool
+	// capacity follows the size on the first line with the capacity.
+	capacity bool
+}
+
+var (
+	quotedText = textLayout{format: persist.QuotedLines, capacity: true}
+	cppText    = textLayout{format: persist.CppLines, topFirst: true}
+)
+
+// WriteTextTo writes the size and capacity on one line and then one element
+// per line from the bottom of the stack to the top. Elements that cannot be
+// written verbatim are quoted with persist.QuoteLine.
+func (s *Stack) WriteTextTo(w io.Writer) (int64, error) {
+	enc := persist.NewEncoder(w)
+	if err := enc.CompressText(s.encodeOpts); err != nil {
+		return enc.Len(), err
+	}
+	return s.writeText(enc, quotedText)
+}
+
+// WriteCppTextTo writes the stack in the format of the C++
+// Stack::writeText, which lists the elements from the top of the stack to
+// the bottom. Elements containing a newline cannot be written.
+func (s *Stack) WriteCppTextTo(w io.Writer) (int64, error) {
+	return s.writeText(persist.NewEncoder(w), cppText)
+}
+
+func (s *Stack) writeText(enc *persist.Encoder, layout textLayout) (int64, error) {
+	sizeLine := strconv.Itoa(s.size)
+	if layout.capacity {
+		sizeLine += " " + strconv.Itoa(s.maxSize)
+	}
+	if _, err := fmt.Fprintln(enc, sizeLine); err != nil {
+		return enc.Len(), err
 	}
 
 	current := s.head
@@ -155,52 +371,147 @@ func (s *Stack) WriteText(filename string) error {
 		stack[i] = current.key
 		current = current.next
 	}
-	
-	for i := s.size - 1; i >= 0; i-- {
-		if _, err := file.WriteString(stack[i] + "\n"); err != nil {
-			return err
+	if !layout.topFirst {
+		slices.Reverse(stack)
+	}
+
+	for _, element := range stack {
+		line, err := layout.format.Quote(element)
+		if err != nil {
+			return enc.Len(), err
+		}
+		if _, err := fmt.Fprintln(enc, line); err != nil {
+			return enc.Len(), err
 		}
 	}
-	
-	return nil
+
+	err := enc.Finish()
+	return enc.Len(), err
 }
 
-func (s *Stack) ReadText(filename string) error {
-	file, err := os.Open(filename)
-	if err != nil {
-		return fmt.Errorf("не удалось открыть файл: %s", filename)
+// ReadTextFrom replaces the contents of the stack with the text data in r.
+// Like ReadFrom it takes over the capacity if the file records one.
+func (s *Stack) ReadTextFrom(r io.Reader) (int64, error) {
+	dec := persist.NewDecoder(r, s.decodeOpts)
+	if err := dec.DetectCompression(); err != nil {
+		return dec.Offset(), err
 	}
-	defer file.Close()
+	return s.readText(dec, quotedText)
+}
 
-	s.Clear()
+// ReadCppTextFrom replaces the contents of the stack with a file written by
+// the C++ Stack::writeText.
+func (s *Stack) ReadCppTextFrom(r io.Reader) (int64, error) {
+	return s.readText(persist.NewDecoder(r, s.decodeOpts), cppText)
+}
 
-	scanner := bufio.NewScanner(file)
-	
-	if !scanner.Scan() {
-		return errors.New("не удалось прочитать размер стека")
+func (s *Stack) readText(dec *persist.Decoder, layout textLayout) (int64, error) {
+	lines := persist.NewLineReader(dec)
+
+	if !lines.Scan() {
+		return dec.Offset(), persist.ScanFailure(lines, errors.New("не удалось прочитать размер стека"))
 	}
-	
-	sizeStr := scanner.Text()
-	fileSize, err := strconv.Atoi(sizeStr)
+
+	sizeStr, capacityStr, hasCapacity := strings.Cut(lines.Text(), " ")
+	hasCapacity = hasCapacity && layout.capacity
+	fileSize, err := dec.ParseCount(sizeStr)
 	if err != nil {
-		return err
+		return dec.Offset(), err
 	}
 
-	if fileSize > MAX_SIZE {
-		return errors.New("размер стека в файле превышает максимально допустимый")
+	var capacity int
+	if hasCapacity {
+		var recorded uint64
+		if recorded, err = strconv.ParseUint(capacityStr, 10, 64); err != nil {
+			return dec.Offset(), fmt.Errorf("неверная ёмкость стека: %w", err)
+		}
+		capacity, err = recordedCapacity(fileSize, recorded)
+	} else {
+		capacity, err = s.fitCapacity(fileSize)
+	}
+	if err != nil {
+		return dec.Offset(), err
 	}
 
+	elements := make([]string, 0, min(fileSize, 1024))
 	for i := 0; i < fileSize; i++ {
-		if !scanner.Scan() {
-			return errors.New("не удалось прочитать элемент стека")
+		if !lines.Scan() {
+			return dec.Offset(), persist.ScanFailure(lines, errors.New("не удалось прочитать элемент стека"))
 		}
-		element := scanner.Text()
-		if err := s.Push(element); err != nil {
-			return err
+		element, err := layout.format.Unquote(lines.Text())
+		if err != nil {
+			return dec.Offset(), fmt.Errorf("неверный элемент стека в строке %d: %w", i+2, err)
 		}
+		elements = append(elements, element)
 	}
 
-	return scanner.Err()
+	if err := dec.FinishText(lines); err != nil {
+		return dec.Offset(), err
+	}
+	if layout.topFirst {
+		slices.Reverse(elements)
+	}
+
+	loaded := s.emptyCopy(capacity)
+	for _, element := range elements {
+		if err := loaded.Push(element); err != nil {
+			return dec.Offset(), err
+		}
+	}
+
+	s.replace(loaded)
+	return dec.Offset(), nil
+}
+
+func (s *Stack) WriteText(filename string) error {
+	return persist.WriteFile(filename, s.WriteTextTo)
+}
+
+func (s *Stack) ReadText(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("не удалось открыть файл: %s", filename)
+	}
+	defer file.Close()
+
+	_, err = s.ReadTextFrom(file)
+	return err
+}
+
+// All yields the elements from the top of the stack to the bottom. Pushing
+// or popping while iterating panics.
+func (s *Stack) All() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		version := s.version
+		for current := s.head; current != nil; current = current.next {
+			if !yield(current.key) {
+				return
+			}
+			if s.version != version {
+				panic("stack: stack modified during iteration")
+			}
+		}
+	}
+}
+
+// Backward yields the elements from the bottom of the stack to the top. The
+// elements are copied before the first one is yielded.
+func (s *Stack) Backward() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		version := s.version
+		keys := make([]string, 0, s.size)
+		for current := s.head; current != nil; current = current.next {
+			keys = append(keys, current.key)
+		}
+		for i := len(keys) - 1; i >= 0; i-- {
+			if !yield(keys[i]) {
+				return
+			}
+			if s.version != version {
+				panic("stack: stack modified during iteration")
+			}
+		}
+	}
 }
 
 func (s *Stack) Print() {
@@ -220,4 +531,5 @@ func (s *Stack) Print() {
 func (s *Stack) Clear() {
 	s.head = nil
 	s.size = 0
+	s.version++
 }
\ No newline at end of file
@@ -2,10 +2,19 @@ package stack
 
 import (
 	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
 	"os"
 	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
 	"testing"
 	"strconv"
+	"strings"
+
+	"Go/persist/persisttest"
 )
 
 func captureOutput(f func()) string {
@@ -1050,4 +1059,169 @@ func TestStackWithEmptyStrings(t *testing.T) {
 	if !s.IsEmpty() {
 		t.Error("Stack should be empty after popping all items")
 	}
-}
\ No newline at end of file
+}
+
+func TestIterators(t *testing.T) {
+	s := NewStackFromSlice("bottom", "middle", "top")
+
+	if got := slices.Collect(s.All()); !reflect.DeepEqual(got, []string{"top", "middle", "bottom"}) {
+		t.Errorf("All() = %v", got)
+	}
+	if got := slices.Collect(s.Backward()); !reflect.DeepEqual(got, []string{"bottom", "middle", "top"}) {
+		t.Errorf("Backward() = %v", got)
+	}
+	if got := slices.Collect(NewStack().All()); len(got) != 0 {
+		t.Errorf("All() on empty stack = %v", got)
+	}
+
+	for v := range s.All() {
+		if v != "top" {
+			t.Errorf("All() with break yielded %q first", v)
+		}
+		break
+	}
+
+	mutations := map[string]func(s *Stack){
+		"Push":  func(s *Stack) { s.Push("x") },
+		"Pop":   func(s *Stack) { s.Pop() },
+		"Clear": func(s *Stack) { s.Clear() },
+	}
+	for name, mutate := range mutations {
+		for _, backward := range []bool{false, true} {
+			t.Run(name, func(t *testing.T) {
+				s := NewStackFromSlice("a", "b", "c")
+				seq := s.All()
+				if backward {
+					seq = s.Backward()
+				}
+				defer func() {
+					if recover() == nil {
+						t.Errorf("%s during iteration did not panic", name)
+					}
+				}()
+				for range seq {
+					mutate(s)
+				}
+			})
+		}
+	}
+}
+
+func TestReaderWriter(t *testing.T) {
+	persisttest.TestContainer(t, persisttest.Fixture[*Stack]{
+		New:      func() *Stack { return NewStack() },
+		Make:     func(values []string) *Stack { return NewStackFromSlice(values...) },
+		Contents: func(s *Stack) any { return slices.Collect(s.All()) },
+		// The legacy format lacks the capacity after the header.
+		LegacySkip: 8,
+	})
+
+	t.Run("UnboundedCount", func(t *testing.T) {
+		// Without MAX_SIZE to stop it, only the reader keeps a declared size
+		// from allocating room for that many elements up front.
+		for name, read := range map[string]func(s *Stack) error{
+			"text": func(s *Stack) error {
+				_, err := s.ReadTextFrom(strings.NewReader("16777216\n"))
+				return err
+			},
+			"binary": func(s *Stack) error {
+				_, err := s.ReadLegacyFrom(bytes.NewReader(binary.LittleEndian.AppendUint32(nil, 1<<24)))
+				return err
+			},
+		} {
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			if err := read(NewStack(Unbounded())); err == nil {
+				t.Errorf("%s read of a size past the end of the file returned nil error", name)
+			}
+			runtime.ReadMemStats(&after)
+			if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+				t.Errorf("%s read of a size of 16777216 allocated %d bytes", name, allocated)
+			}
+		}
+	})
+}
+
+func TestJSON(t *testing.T) {
+	s := NewStackFromSlice("bottom", "middle", "top")
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatalf("json.Marshal() failed: %v", err)
+	}
+	if string(data) != `["top","middle","bottom"]` {
+		t.Errorf("json.Marshal() = %s, want top first", data)
+	}
+
+	// The text format lists the same elements bottom first.
+	var text bytes.Buffer
+	if _, err := s.WriteTextTo(&text); err != nil {
+		t.Fatalf("WriteTextTo() failed: %v", err)
+	}
+	textLines := strings.Split(strings.TrimSuffix(text.String(), "\n"), "\n")[1:]
+	var jsonKeys []string
+	json.Unmarshal(data, &jsonKeys)
+	slices.Reverse(jsonKeys)
+	if !slices.Equal(jsonKeys, textLines) {
+		t.Errorf("json.Marshal() reversed = %q, WriteTextTo() lines = %q", jsonKeys, textLines)
+	}
+
+	loaded := NewStack()
+	if err := json.Unmarshal(data, loaded); err != nil {
+		t.Fatalf("json.Unmarshal() failed: %v", err)
+	}
+	if got, _ := loaded.Pop(); got != "top" {
+		t.Errorf("Pop() after json.Unmarshal() = %q, want top", got)
+	}
+
+	tooMany, _ := json.Marshal(make([]string, MAX_SIZE+1))
+	keep := NewStackFromSlice("keep")
+	if err := json.Unmarshal(tooMany, keep); err == nil {
+		t.Error("json.Unmarshal() over MAX_SIZE returned nil error")
+	}
+	if keep.GetSize() != 1 {
+		t.Errorf("failed json.Unmarshal() changed the stack size to %d", keep.GetSize())
+	}
+
+	if data, _ := json.Marshal(NewStack()); string(data) != "[]" {
+		t.Errorf("json.Marshal() of empty stack = %s, want []", data)
+	}
+}
+
+// TestCppGolden checks the C++ formats against files written by the C++
+// Stack; see Serialization/C++/Golden.
+func TestCppGolden(t *testing.T) {
+	want := []string{"top", "b c", "bottom"}
+	tests := []struct {
+		file  string
+		write func(*Stack, io.Writer) (int64, error)
+		read  func(*Stack, io.Reader) (int64, error)
+	}{
+		{"stack.bin", (*Stack).WriteCppTo, (*Stack).ReadCppFrom},
+		{"stack.txt", (*Stack).WriteCppTextTo, (*Stack).ReadCppTextFrom},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			golden, err := os.ReadFile(filepath.Join("testdata", "cpp", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			loaded := NewStack()
+			if _, err := tt.read(loaded, bytes.NewReader(golden)); err != nil {
+				t.Fatalf("reading the C++ file failed: %v", err)
+			}
+			if got := slices.Collect(loaded.All()); !reflect.DeepEqual(got, want) {
+				t.Errorf("read %q, want %q", got, want)
+			}
+
+			original := NewStackFromSlice("bottom", "b c", "top")
+			var buf bytes.Buffer
+			if _, err := tt.write(original, &buf); err != nil {
+				t.Fatalf("writing the C++ format failed: %v", err)
+			}
+			if !bytes.Equal(buf.Bytes(), golden) {
+				t.Errorf("wrote\n%q\nwant\n%q", buf.Bytes(), golden)
+			}
+		})
+	}
+}